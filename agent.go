@@ -0,0 +1,704 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+	"github.com/handsomefox/dnsbench/internal/sleep"
+)
+
+// SourceAgent prefixes the history source of runs reported by agents, e.g.
+// "agent:berlin".
+const SourceAgent = "agent"
+
+const (
+	// maxAgentJobs bounds the jobs a central server keeps in memory.
+	maxAgentJobs = 100
+	// maxAgentReport bounds the size of a report, which includes raw samples.
+	maxAgentReport = 64 << 20
+
+	agentFlushInterval = time.Second
+	agentBatchSize     = 500
+)
+
+// States of a job at one agent.
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+var (
+	errJobNotFound = errors.New("job not found")
+
+	agentNamePattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z._-]{0,63}$`)
+)
+
+// AgentJob is a benchmark the central server hands out to agents. Agents
+// apply the request like /api/run does, on top of their own flags.
+type AgentJob struct {
+	ID      string     `json:"id"`
+	Created time.Time  `json:"created"`
+	Request runRequest `json:"request"`
+	// Agents lists the vantage points that run the job; empty means every
+	// agent that polls the server.
+	Agents []string `json:"agents,omitempty"`
+}
+
+// agentJobRequest is the body of POST /api/agent/jobs: a run request as for
+// /api/run plus the agents that should run it.
+type agentJobRequest struct {
+	runRequest
+	Agents []string `json:"agents,omitempty"`
+}
+
+// AgentJobStatus is a job with the state of every agent that picked it up
+// and the comparison of their results.
+type AgentJobStatus struct {
+	AgentJob
+	Status map[string]string `json:"status"`
+	Matrix VantageMatrix     `json:"matrix"`
+}
+
+// AgentInfo describes an agent known to the central server.
+type AgentInfo struct {
+	Name     string    `json:"name"`
+	Addr     string    `json:"addr"`
+	LastSeen time.Time `json:"lastSeen"`
+	// Job is the job the agent is running, if any.
+	Job string `json:"job,omitempty"`
+}
+
+type agentPoll struct {
+	Agent string `json:"agent"`
+}
+
+// agentEventBatch carries reporter events from an agent to the central
+// server, which relays them to its dashboard clients.
+type agentEventBatch struct {
+	Agent  string     `json:"agent"`
+	JobID  string     `json:"jobId"`
+	Events []SSEEvent `json:"events"`
+}
+
+// agentReport is the outcome of a job at one agent.
+type agentReport struct {
+	Agent    string             `json:"agent"`
+	JobID    string             `json:"jobId"`
+	Manifest *Manifest          `json:"manifest,omitempty"`
+	Results  resultsWithSamples `json:"results"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// VantageMatrix compares each resolver across the vantage points that
+// reported results for a job.
+type VantageMatrix struct {
+	Vantages  []string     `json:"vantages"`
+	Resolvers []VantageRow `json:"resolvers"`
+}
+
+// VantageRow holds the results of one resolver, one cell per vantage point in
+// the order of VantageMatrix.Vantages. A cell is null when the resolver was
+// not measured there.
+type VantageRow struct {
+	Server bench.DNSServer `json:"server"`
+	Cells  []*VantageCell  `json:"cells"`
+	// Best is the vantage point with the lowest median and Spread the
+	// difference between the highest and lowest median, in milliseconds.
+	Best   string  `json:"best,omitempty"`
+	Spread float64 `json:"spread"`
+}
+
+// VantageCell summarizes a resolver at one vantage point.
+type VantageCell struct {
+	Median      float64 `json:"median"`
+	P95         float64 `json:"p95"`
+	SuccessRate float64 `json:"successRate"`
+	// Rank is the position among the resolvers measured at the same vantage
+	// point, 0 when the resolver failed there.
+	Rank    int    `json:"rank,omitempty"`
+	Failure string `json:"failure,omitempty"`
+}
+
+// MarshalJSON writes NaN latencies of failed resolvers as null.
+func (c VantageCell) MarshalJSON() ([]byte, error) {
+	type plain VantageCell
+	return jsonnan.Marshal(plain(c))
+}
+
+// vantageMatrix builds the resolver × vantage point comparison of reports,
+// keyed by agent. Rows are ordered by their best median, resolvers that
+// failed everywhere last.
+func vantageMatrix(reports map[string]*agentReport) VantageMatrix {
+	vantages := slices.Sorted(maps.Keys(reports))
+	m := VantageMatrix{Vantages: vantages, Resolvers: []VantageRow{}}
+
+	rows := make(map[string]int)
+	for col, vantage := range vantages {
+		valid, failed := rankResults(reports[vantage].Results, SortDefault)
+		for i, r := range append(valid, failed...) {
+			key := r.Server.Endpoint()
+			idx, ok := rows[key]
+			if !ok {
+				idx = len(m.Resolvers)
+				rows[key] = idx
+				m.Resolvers = append(m.Resolvers, VantageRow{Server: r.Server, Cells: make([]*VantageCell, len(vantages))})
+			}
+			cell := &VantageCell{Median: r.Stats.Median, P95: r.Stats.P95, SuccessRate: r.Stats.SuccessRate()}
+			if r.Failed() {
+				cell.Failure = r.FailureReason()
+			} else {
+				cell.Rank = i + 1
+			}
+			m.Resolvers[idx].Cells[col] = cell
+		}
+	}
+
+	best := make(map[string]float64, len(m.Resolvers))
+	for i := range m.Resolvers {
+		row := &m.Resolvers[i]
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for col, c := range row.Cells {
+			if c == nil || c.Failure != "" {
+				continue
+			}
+			if c.Median < lo {
+				lo, row.Best = c.Median, vantages[col]
+			}
+			hi = math.Max(hi, c.Median)
+		}
+		if row.Best != "" {
+			row.Spread = hi - lo
+		}
+		best[row.Server.Endpoint()] = lo
+	}
+	slices.SortStableFunc(m.Resolvers, func(a, b VantageRow) int {
+		return cmp.Compare(best[a.Server.Endpoint()], best[b.Server.Endpoint()])
+	})
+	return m
+}
+
+// Fleet tracks the agents and jobs of a central server.
+type Fleet struct {
+	mu     sync.Mutex
+	agents map[string]*AgentInfo
+	jobs   []*fleetJob
+}
+
+type fleetJob struct {
+	job     AgentJob
+	status  map[string]string
+	reports map[string]*agentReport
+}
+
+func newFleet() *Fleet {
+	return &Fleet{agents: make(map[string]*AgentInfo)}
+}
+
+// addJob queues a job for the agents it names, dropping the oldest job once
+// maxAgentJobs are kept.
+func (f *Fleet) addJob(req *agentJobRequest, now time.Time) AgentJob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	job := AgentJob{
+		ID:      strconv.FormatInt(now.UnixNano(), 10),
+		Created: now,
+		Request: req.runRequest,
+		Agents:  req.Agents,
+	}
+	f.jobs = append(f.jobs, &fleetJob{job: job, status: make(map[string]string), reports: make(map[string]*agentReport)})
+	if len(f.jobs) > maxAgentJobs {
+		f.jobs = slices.Delete(f.jobs, 0, len(f.jobs)-maxAgentJobs)
+	}
+	return job
+}
+
+// next records that agent polled from addr and claims the oldest job it has
+// not run yet. It returns nil when there is none.
+func (f *Fleet) next(agent, addr string, now time.Time) *AgentJob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, ok := f.agents[agent]
+	if !ok {
+		info = &AgentInfo{Name: agent}
+		f.agents[agent] = info
+	}
+	info.Addr, info.LastSeen, info.Job = addr, now, ""
+
+	for _, j := range f.jobs {
+		if _, claimed := j.status[agent]; claimed {
+			continue
+		}
+		if len(j.job.Agents) > 0 && !slices.Contains(j.job.Agents, agent) {
+			continue
+		}
+		j.status[agent] = jobRunning
+		info.Job = j.job.ID
+		job := j.job
+		return &job
+	}
+	return nil
+}
+
+// running reports whether agent has claimed the job and not reported it yet.
+func (f *Fleet) running(agent, jobID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	j := f.find(jobID)
+	return j != nil && j.status[agent] == jobRunning
+}
+
+// report stores the outcome of a job at an agent.
+func (f *Fleet) report(rep *agentReport, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	j := f.find(rep.JobID)
+	if j == nil || j.status[rep.Agent] == "" {
+		return errJobNotFound
+	}
+	if info, ok := f.agents[rep.Agent]; ok {
+		info.LastSeen, info.Job = now, ""
+	}
+	if rep.Error != "" {
+		j.status[rep.Agent] = jobFailed
+	} else {
+		j.status[rep.Agent] = jobDone
+	}
+	if len(rep.Results) > 0 {
+		j.reports[rep.Agent] = rep
+	}
+	return nil
+}
+
+func (f *Fleet) find(id string) *fleetJob {
+	for _, j := range f.jobs {
+		if j.job.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// Job returns the state of a job and the comparison of its results.
+func (f *Fleet) Job(id string) (AgentJobStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	j := f.find(id)
+	if j == nil {
+		return AgentJobStatus{}, errJobNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// Jobs returns every job, newest first.
+func (f *Fleet) Jobs() []AgentJobStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs := make([]AgentJobStatus, 0, len(f.jobs))
+	for _, j := range slices.Backward(f.jobs) {
+		jobs = append(jobs, j.snapshot())
+	}
+	return jobs
+}
+
+func (j *fleetJob) snapshot() AgentJobStatus {
+	return AgentJobStatus{
+		AgentJob: j.job,
+		Status:   maps.Clone(j.status),
+		Matrix:   vantageMatrix(j.reports),
+	}
+}
+
+// Agents returns the known agents ordered by name.
+func (f *Fleet) Agents() []AgentInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agents := make([]AgentInfo, 0, len(f.agents))
+	for _, name := range slices.Sorted(maps.Keys(f.agents)) {
+		agents = append(agents, *f.agents[name])
+	}
+	return agents
+}
+
+// registerAgentRoutes adds the endpoints agents and dashboards use to hand
+// out jobs and collect results.
+func (s *uiServer) registerAgentRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/agents", s.handleAgents)
+	mux.HandleFunc("/api/agent/jobs", s.handleAgentJobs)
+	mux.HandleFunc("/api/agent/jobs/", s.handleAgentJob)
+	mux.HandleFunc("/api/agent/next", s.agentOnly(s.handleAgentNext))
+	mux.HandleFunc("/api/agent/events", s.agentOnly(s.handleAgentEvents))
+	mux.HandleFunc("/api/agent/results", s.agentOnly(s.handleAgentResults))
+}
+
+// agentOnly accepts POST requests that carry the agent token, if one is set.
+func (s *uiServer) agentOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.agentAuthorized(w, r) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// agentAuthorized reports whether r carries the agent token, if one is set,
+// and answers 401 if it does not.
+func (s *uiServer) agentAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	token := s.baseConfig.AgentToken
+	if token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		http.Error(w, "invalid agent token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *uiServer) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.fleet.Agents())
+}
+
+func (s *uiServer) handleAgentJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.fleet.Jobs())
+	case http.MethodPost:
+		// Jobs run on every agent of the fleet, so queuing one takes the
+		// agent token too.
+		if !s.agentAuthorized(w, r) {
+			return
+		}
+		var req agentJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, _, _, err := buildRunConfig(s.baseConfig, &req.runRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, agent := range req.Agents {
+			if !agentNamePattern.MatchString(agent) {
+				http.Error(w, fmt.Sprintf("invalid agent name %q", agent), http.StatusBadRequest)
+				return
+			}
+		}
+		job := s.fleet.addJob(&req, time.Now())
+		slog.Info("Queued agent job", slog.String("id", job.ID), slog.Any("agents", job.Agents))
+		writeJSON(w, job)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *uiServer) handleAgentJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := s.fleet.Job(strings.TrimPrefix(r.URL.Path, "/api/agent/jobs/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (s *uiServer) handleAgentNext(w http.ResponseWriter, r *http.Request) {
+	var poll agentPoll
+	if err := json.NewDecoder(r.Body).Decode(&poll); err != nil || !agentNamePattern.MatchString(poll.Agent) {
+		http.Error(w, "invalid agent name", http.StatusBadRequest)
+		return
+	}
+	job := s.fleet.next(poll.Agent, r.RemoteAddr, time.Now())
+	if job == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	slog.Info("Agent picked up job", slog.String("agent", poll.Agent), slog.String("job", job.ID))
+	writeJSON(w, job)
+}
+
+func (s *uiServer) handleAgentEvents(w http.ResponseWriter, r *http.Request) {
+	var batch agentEventBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.fleet.running(batch.Agent, batch.JobID) {
+		http.Error(w, errJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	for _, evt := range batch.Events {
+		evt.RunID, evt.Agent = batch.JobID, batch.Agent
+		s.hub.Broadcast(evt)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *uiServer) handleAgentResults(w http.ResponseWriter, r *http.Request) {
+	var rep agentReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentReport)).Decode(&rep); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := s.fleet.report(&rep, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	slog.Info("Agent reported results",
+		slog.String("agent", rep.Agent),
+		slog.String("job", rep.JobID),
+		slog.Int("results", len(rep.Results)),
+		slog.String("error", rep.Error),
+	)
+
+	detail := map[string]interface{}{"results": len(rep.Results)}
+	if rep.Error != "" {
+		detail["error"] = rep.Error
+	}
+	s.hub.Broadcast(SSEEvent{Type: "agent_done", RunID: rep.JobID, Agent: rep.Agent, Detail: detail})
+
+	if rep.Error == "" && rep.Manifest != nil && rep.Manifest.Config != nil {
+		// Store the run with the options the agent used, in the history of
+		// this server.
+		cfg := *rep.Manifest.Config
+		cfg.HistoryDir, cfg.Retention = s.baseConfig.HistoryDir, s.baseConfig.Retention
+		servers := make([]bench.DNSServer, 0, len(rep.Results))
+		for _, res := range rep.Results {
+			servers = append(servers, res.Server)
+		}
+		job, err := s.fleet.Job(rep.JobID)
+		if err == nil {
+			recordRun(s.ctx, &cfg, SourceAgent+":"+rep.Agent, rep.Manifest, servers, job.Request.Domains, rep.Results) //nolint:contextcheck // stored after the request
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// agentClient talks to the central server on behalf of an agent.
+type agentClient struct {
+	server string
+	name   string
+	token  string
+	http   *http.Client
+}
+
+func newAgentClient(config *Config) *agentClient {
+	return &agentClient{
+		server: config.AgentServer,
+		name:   config.AgentName,
+		token:  config.AgentToken,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// post sends body as JSON and decodes a 200 response into out. It returns the
+// status code of the response.
+func (c *agentClient) post(ctx context.Context, path string, body, out any) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s request: %w", path, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.server+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }() //nolint:errcheck // body fully handled below
+
+	switch {
+	case resp.StatusCode == http.StatusOK && out != nil:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decoding %s response: %w", path, err)
+		}
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		//nolint:errcheck // the status is enough when the body cannot be read
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.StatusCode, nil
+}
+
+// next asks the central server for a job; it returns nil when there is none.
+func (c *agentClient) next(ctx context.Context) (*AgentJob, error) {
+	var job AgentJob
+	status, err := c.post(ctx, "/api/agent/next", agentPoll{Agent: c.name}, &job)
+	if err != nil || status == http.StatusNoContent {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// runJob runs job with the settings of base and reports the outcome. Progress
+// is streamed to the central server while the job runs.
+func (c *agentClient) runJob(ctx context.Context, base *Config, job *AgentJob) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "Running job", slog.String("job", job.ID))
+	rep := agentReport{Agent: c.name, JobID: job.ID}
+
+	cfg, servers, domains, err := buildRunConfig(base, &job.Request)
+	if err != nil {
+		rep.Error = err.Error()
+	} else {
+		sink := newHTTPSink(ctx, c, job.ID)
+		manifest := newManifest(cfg)
+		rep.Results, err = runBenchmark(ctx, cfg, manifest, servers, domains, NewSSEReporter(sink, job.ID))
+		sink.Close()
+		rep.Manifest = manifest
+		if err != nil {
+			rep.Error = err.Error()
+		}
+	}
+
+	// Report even when the agent is shutting down, so the job is not left
+	// running on the central server.
+	reportCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	if _, err := c.post(reportCtx, "/api/agent/results", rep, nil); err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Could not report job results", slog.String("job", job.ID), logattr.Err(err))
+		return
+	}
+	slog.LogAttrs(ctx, slog.LevelInfo, "Finished job", slog.String("job", job.ID), slog.String("error", rep.Error))
+}
+
+// httpSink forwards reporter events to the central server in batches, so
+// that per-query events do not each cost a request. Like a slow SSE client,
+// it drops events when the server cannot keep up.
+type httpSink struct {
+	client *agentClient
+	jobID  string
+	events chan SSEEvent
+	done   chan struct{}
+}
+
+func newHTTPSink(ctx context.Context, client *agentClient, jobID string) *httpSink {
+	s := &httpSink{
+		client: client,
+		jobID:  jobID,
+		events: make(chan SSEEvent, 4*agentBatchSize),
+		done:   make(chan struct{}),
+	}
+	// The last batch is sent after the run, even if it was canceled.
+	go s.loop(context.WithoutCancel(ctx))
+	return s
+}
+
+func (s *httpSink) Broadcast(evt SSEEvent) {
+	select {
+	case s.events <- evt:
+	default:
+		slog.Warn("dropping agent event", slog.String("type", evt.Type))
+	}
+}
+
+// Close sends the remaining events and waits until they are delivered.
+func (s *httpSink) Close() {
+	close(s.events)
+	<-s.done
+}
+
+func (s *httpSink) loop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(agentFlushInterval)
+	defer ticker.Stop()
+
+	var batch []SSEEvent
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		body := agentEventBatch{Agent: s.client.name, JobID: s.jobID, Events: batch}
+		if _, err := s.client.post(ctx, "/api/agent/events", body, nil); err != nil {
+			slog.LogAttrs(ctx, slog.LevelWarn, "Could not send events", slog.Int("events", len(batch)), logattr.Err(err))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case evt, ok := <-s.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, evt)
+			if len(batch) >= agentBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// runAgent polls the central server for jobs and runs them until ctx is
+// canceled.
+func runAgent(ctx context.Context, config *Config) error {
+	client := newAgentClient(config)
+	slog.LogAttrs(ctx, slog.LevelInfo, "Starting agent",
+		slog.String("server", config.AgentServer),
+		slog.String("name", config.AgentName),
+		slog.Duration("poll", config.AgentPoll),
+	)
+
+	for {
+		job, err := client.next(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			slog.LogAttrs(ctx, slog.LevelWarn, "Could not poll for jobs", logattr.Err(err))
+		case job != nil:
+			client.runJob(ctx, config, job)
+			continue
+		}
+		if !sleep.Until(ctx, time.Now().Add(config.AgentPoll)) {
+			return nil
+		}
+	}
+}
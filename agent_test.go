@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestVantageMatrix(t *testing.T) {
+	dead := deadResult("C", "C")
+	reports := map[string]*agentReport{
+		"berlin": {Results: []bench.BenchmarkResult{testResult("A", 30, 30, 30), testResult("B", 10, 10, 10), dead}},
+		"tokyo":  {Results: []bench.BenchmarkResult{testResult("A", 5, 5, 5), dead}},
+	}
+
+	m := vantageMatrix(reports)
+	if !slices.Equal(m.Vantages, []string{"berlin", "tokyo"}) {
+		t.Fatalf("Vantages = %v", m.Vantages)
+	}
+	names := make([]string, 0, len(m.Resolvers))
+	for _, row := range m.Resolvers {
+		names = append(names, row.Server.Name)
+	}
+	if !slices.Equal(names, []string{"A", "B", "C"}) {
+		t.Fatalf("rows = %v, want A, B, C by best median", names)
+	}
+
+	a, b, c := m.Resolvers[0], m.Resolvers[1], m.Resolvers[2]
+	if a.Best != "tokyo" || a.Spread != 25 || a.Cells[0].Rank != 2 || a.Cells[1].Rank != 1 {
+		t.Errorf("A = best %q, spread %v, ranks %d/%d, want tokyo, 25, 2/1", a.Best, a.Spread, a.Cells[0].Rank, a.Cells[1].Rank)
+	}
+	if b.Cells[1] != nil {
+		t.Errorf("B has a tokyo cell, want null")
+	}
+	if c.Best != "" || c.Cells[0].Failure == "" || c.Cells[0].Rank != 0 {
+		t.Errorf("C = %+v, want failed everywhere", c)
+	}
+}
+
+func newTestAgentServer(t *testing.T, token string) (*uiServer, *httptest.Server) {
+	t.Helper()
+	srv := &uiServer{
+		hub:        NewSSEHub(),
+		baseConfig: &Config{AgentToken: token},
+		ctx:        context.Background(),
+		fleet:      newFleet(),
+	}
+	mux := http.NewServeMux()
+	srv.registerAgentRoutes(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func TestAgentJobs_RequiresToken(t *testing.T) {
+	srv, ts := newTestAgentServer(t, "secret")
+	body := `{"domains": ["example.com"], "resolvers": [{"name": "nowhere", "addr": "127.0.0.254"}],
+		"options": {"repeats": 1, "timeoutMs": 1000, "backoffMs": 100, "maxBackoffMs": 100}}`
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "wrong token", token: "wrong", want: http.StatusUnauthorized},
+		{name: "agent token", token: "secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/agent/jobs", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close() //nolint:errcheck // test
+			if resp.StatusCode != tt.want {
+				t.Errorf("POST /api/agent/jobs status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+	if jobs := srv.fleet.Jobs(); len(jobs) != 1 {
+		t.Errorf("Jobs() = %d jobs, want only the authorized one", len(jobs))
+	}
+}
+
+func newTestAgent(ts *httptest.Server, name, token string) *agentClient {
+	return newAgentClient(&Config{AgentServer: ts.URL, AgentName: name, AgentToken: token})
+}
+
+func TestAgents_RunJob(t *testing.T) {
+	srv, ts := newTestAgentServer(t, "secret")
+	ctx := context.Background()
+
+	job := srv.fleet.addJob(&agentJobRequest{
+		runRequest: runRequest{
+			Domains:   []string{"example.com"},
+			Resolvers: []bench.DNSServer{{Name: "nowhere", Addr: "127.0.0.254"}},
+			Options:   runOptions{Repeats: 1, TimeoutMs: 100},
+		},
+		Agents: []string{"berlin", "tokyo"},
+	}, time.Now())
+
+	if _, err := newTestAgent(ts, "berlin", "wrong").next(ctx); err == nil {
+		t.Errorf("next() with a wrong token succeeded, want error")
+	}
+	if got, err := newTestAgent(ts, "paris", "secret").next(ctx); err != nil || got != nil {
+		t.Errorf("next() for an agent the job is not assigned to = %v, %v, want no job", got, err)
+	}
+
+	base := &Config{
+		Repeats: 1, MaxConcurrency: 1, LookupTimeout: time.Second, ScoreWeights: bench.DefaultScoreWeights,
+		Retry: bench.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Second},
+	}
+	for _, name := range []string{"berlin", "tokyo"} {
+		agent := newTestAgent(ts, name, "secret")
+		got, err := agent.next(ctx)
+		if err != nil || got == nil || got.ID != job.ID {
+			t.Fatalf("next(%s) = %v, %v, want job %s", name, got, err, job.ID)
+		}
+		agent.runJob(ctx, base, got)
+		if again, err := agent.next(ctx); err != nil || again != nil {
+			t.Errorf("next(%s) after the job = %v, %v, want no job", name, again, err)
+		}
+	}
+
+	status, err := srv.fleet.Job(job.ID)
+	if err != nil {
+		t.Fatalf("Job() error = %v", err)
+	}
+	if status.Status["berlin"] != jobDone || status.Status["tokyo"] != jobDone {
+		t.Errorf("Status = %v, want done at both agents", status.Status)
+	}
+	if len(status.Matrix.Vantages) != 2 || len(status.Matrix.Resolvers) != 1 {
+		t.Fatalf("Matrix = %+v, want one resolver at two vantage points", status.Matrix)
+	}
+	for i, cell := range status.Matrix.Resolvers[0].Cells {
+		if cell == nil || cell.Failure == "" {
+			t.Errorf("cell %d = %+v, want the dead resolver marked failed", i, cell)
+		}
+	}
+	agents := srv.fleet.Agents()
+	if len(agents) != 3 || agents[0].Name != "berlin" || agents[0].Job != "" {
+		t.Errorf("Agents() = %+v", agents)
+	}
+}
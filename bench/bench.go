@@ -0,0 +1,273 @@
+// Package bench measures the latency and reliability of DNS resolvers.
+//
+// Run queries a list of domains against each resolver in turn and returns
+// per-resolver statistics, raw samples and a composite score:
+//
+//	results, err := bench.Run(ctx,
+//		[]bench.DNSServer{{Name: "Cloudflare", Addr: "1.1.1.1"}},
+//		[]string{"example.com", "example.org"},
+//		bench.WithRepeats(5),
+//		bench.WithTimeout(2*time.Second),
+//	)
+//
+// A BenchmarkReporter passed with WithReporter receives progress callbacks
+// while the run is in flight. Results are returned in the order of servers;
+// callers decide how to rank them, for example with CompareRanking.
+package bench
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"time"
+)
+
+// Defaults used when the corresponding option is not given.
+const (
+	DefaultTimeout   = 3 * time.Second
+	DefaultRepeats   = 10
+	DefaultPreflight = 2 * time.Second
+	DefaultBreaker   = 10
+	DefaultQPS       = 5
+	DefaultTargetCI  = 2 * time.Millisecond
+)
+
+// DefaultConcurrency is the default number of concurrent queries per resolver.
+func DefaultConcurrency() int {
+	return max(runtime.NumCPU()/2, 2)
+}
+
+// runConfig holds the settings of a single run.
+type runConfig struct {
+	LookupTimeout  time.Duration
+	Repeats        int
+	MaxConcurrency int
+	Retry          RetryPolicy
+	WarmupRuns     int
+
+	PreflightTimeout time.Duration
+	BreakerThreshold int
+
+	// MaxQueries and MaxTime apply per resolver, RunQueries and RunTime to
+	// the whole run. When any is set queries are paced across the window
+	// instead of repeated Repeats times.
+	MaxQueries int
+	MaxTime    time.Duration
+	RunQueries int
+	RunTime    time.Duration
+	QPS        float64
+
+	Adaptive bool
+	TargetCI time.Duration
+
+	RTTProbes int
+	RTTMethod RTTMethod
+
+	QType QType
+
+	// Workload replaces the domains and repeats when set.
+	Workload []WorkloadQuery
+	Pacing   Pacing
+
+	// Capture receives the queries and responses of every resolver when set.
+	Capture *CaptureWriter
+
+	ScoreWeights ScoreWeights
+	Reporter     BenchmarkReporter
+	Seed         uint64
+
+	// Resume holds the results of an earlier, interrupted run.
+	Resume []BenchmarkResult
+
+	// dial replaces the transport of every resolver when set; tests use it
+	// to query fake resolvers.
+	dial func(ctx context.Context, server DNSServer, transport Transport) (net.Conn, bool, error)
+}
+
+func defaultRunConfig() runConfig {
+	return runConfig{
+		LookupTimeout:    DefaultTimeout,
+		Repeats:          DefaultRepeats,
+		MaxConcurrency:   DefaultConcurrency(),
+		PreflightTimeout: DefaultPreflight,
+		BreakerThreshold: DefaultBreaker,
+		QPS:              DefaultQPS,
+		TargetCI:         DefaultTargetCI,
+		RTTProbes:        DefaultRTTProbes,
+		RTTMethod:        RTTTCP,
+		QType:            QTypeA,
+		ScoreWeights:     DefaultScoreWeights,
+		Reporter:         NoopReporter{},
+	}
+}
+
+func (c *runConfig) validate() error {
+	switch {
+	case c.Repeats < 1:
+		return errors.New("repeats must be at least 1")
+	case c.MaxConcurrency < 1:
+		return errors.New("concurrency must be at least 1")
+	case c.LookupTimeout <= 0:
+		return errors.New("timeout must be positive")
+	case c.WarmupRuns < 0:
+		return errors.New("warmup must not be negative")
+	case c.PreflightTimeout < 0 || c.BreakerThreshold < 0:
+		return errors.New("preflight and breaker must not be negative")
+	case c.MaxQueries < 0 || c.MaxTime < 0 || c.RunQueries < 0 || c.RunTime < 0:
+		return errors.New("query and time budgets must not be negative")
+	case c.QPS < 0:
+		return errors.New("qps must not be negative")
+	case c.Adaptive && c.TargetCI <= 0:
+		return errors.New("target-ci must be positive")
+	case c.RTTProbes < 0:
+		return errors.New("rtt probes must not be negative")
+	case len(c.Workload) > 0 && (c.Adaptive || c.MaxQueries > 0 || c.MaxTime > 0 || c.RunQueries > 0 || c.RunTime > 0):
+		return errors.New("a workload replay cannot be combined with adaptive sampling or budgets")
+	case c.Pacing != "" && c.Pacing != PacingFast && c.Pacing != PacingOriginal:
+		return errors.New("pacing must be fast or original")
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return err
+	}
+	return c.ScoreWeights.Validate()
+}
+
+// Option configures a run.
+type Option func(*runConfig)
+
+// WithTimeout sets the timeout of each query attempt.
+func WithTimeout(d time.Duration) Option {
+	return func(c *runConfig) { c.LookupTimeout = d }
+}
+
+// WithRepeats sets how many times each domain is queried per resolver.
+func WithRepeats(n int) Option {
+	return func(c *runConfig) { c.Repeats = n }
+}
+
+// WithConcurrency sets the maximum number of concurrent queries per resolver.
+func WithConcurrency(n int) Option {
+	return func(c *runConfig) { c.MaxConcurrency = n }
+}
+
+// WithRetry sets how failed queries are retried. The default is NoRetry.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *runConfig) { c.Retry = p }
+}
+
+// WithWarmup runs n passes over all domains per resolver before measuring.
+// The first pass is reported as BenchmarkResult.Cold.
+func WithWarmup(n int) Option {
+	return func(c *runConfig) { c.WarmupRuns = n }
+}
+
+// WithPreflight sets the timeout of the reachability probe sent to every
+// resolver before the run. Zero disables the probe.
+func WithPreflight(timeout time.Duration) Option {
+	return func(c *runConfig) { c.PreflightTimeout = timeout }
+}
+
+// WithBreaker gives up on a resolver after n consecutive failures. Zero
+// disables the circuit breaker.
+func WithBreaker(n int) Option {
+	return func(c *runConfig) { c.BreakerThreshold = n }
+}
+
+// WithResolverBudget limits each resolver to a number of queries and/or a
+// wall-clock duration instead of WithRepeats. Zero leaves a limit unset.
+func WithResolverBudget(queries int, d time.Duration) Option {
+	return func(c *runConfig) { c.MaxQueries, c.MaxTime = queries, d }
+}
+
+// WithRunBudget splits a query budget and/or a wall-clock duration evenly
+// across all resolvers. Zero leaves a limit unset.
+func WithRunBudget(queries int, d time.Duration) Option {
+	return func(c *runConfig) { c.RunQueries, c.RunTime = queries, d }
+}
+
+// WithQPS sets the query rate of duration-based runs without a query budget.
+func WithQPS(qps float64) Option {
+	return func(c *runConfig) { c.QPS = qps }
+}
+
+// WithAdaptive samples each resolver until the 95% confidence interval of its
+// median is narrower than targetCI, instead of a fixed number of repeats.
+func WithAdaptive(targetCI time.Duration) Option {
+	return func(c *runConfig) { c.Adaptive, c.TargetCI = true, targetCI }
+}
+
+// WithRTT measures the network round-trip time to every resolver with probes
+// TCP connects or ICMP echoes before its queries, and reports it as
+// BenchmarkResult.RTT. Zero probes disables the measurement.
+func WithRTT(probes int, method RTTMethod) Option {
+	return func(c *runConfig) { c.RTTProbes, c.RTTMethod = probes, method }
+}
+
+// WithQType sets the type of the records queried; the default is QTypeA.
+// A NOERROR answer without records of that type counts as a failed query.
+func WithQType(qtype QType) Option {
+	return func(c *runConfig) { c.QType = qtype }
+}
+
+// WithWorkload replays queries against every resolver instead of querying
+// the domains repeatedly: each query once, with its own record type, as fast
+// as possible or at its recorded offset. Any response other than an error
+// RCODE counts, NXDOMAIN included. Run takes the names of the workload when
+// no domains are given. Adaptive sampling and budgets cannot be combined
+// with it.
+func WithWorkload(queries []WorkloadQuery, pacing Pacing) Option {
+	return func(c *runConfig) { c.Workload, c.Pacing = queries, pacing }
+}
+
+// WithCapture writes every query sent to the resolvers, and every response
+// received, to w. The reachability probe before a run is not captured. The
+// caller closes w after Run returns.
+func WithCapture(w *CaptureWriter) Option {
+	return func(c *runConfig) { c.Capture = w }
+}
+
+// WithScoreWeights sets the weights of the composite score.
+func WithScoreWeights(w ScoreWeights) Option {
+	return func(c *runConfig) { c.ScoreWeights = w }
+}
+
+// WithSeed makes the random jitter of retry backoffs reproducible. Zero, the
+// default, uses a random seed.
+func WithSeed(seed uint64) Option {
+	return func(c *runConfig) { c.Seed = seed }
+}
+
+// WithResume continues an interrupted run from its results. Complete results
+// are reused as they are. The samples of a resolver that was interrupted
+// (Stopped is StopCanceled) are kept and only the missing repeats are
+// queried; adaptive and budgeted runs measure such a resolver again.
+func WithResume(results []BenchmarkResult) Option {
+	return func(c *runConfig) { c.Resume = results }
+}
+
+// WithReporter receives progress callbacks during the run.
+func WithReporter(r BenchmarkReporter) Option {
+	return func(c *runConfig) {
+		if r != nil {
+			c.Reporter = r
+		}
+	}
+}
+
+// Run benchmarks servers against domains and returns one result per server,
+// in the order given. If ctx is canceled the results gathered so far are
+// returned together with the context error.
+func Run(ctx context.Context, servers []DNSServer, domains []string, opts ...Option) ([]BenchmarkResult, error) {
+	config := defaultRunConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		domains = WorkloadNames(config.Workload)
+	}
+	return runBenchmark(ctx, &config, servers, domains, config.Reporter)
+}
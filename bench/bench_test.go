@@ -0,0 +1,60 @@
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun_ValidatesOptions(t *testing.T) {
+	servers := []DNSServer{{Name: "a", Addr: "192.0.2.1"}}
+	domains := []string{"example.com"}
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Zero repeats", opts: []Option{WithRepeats(0)}},
+		{name: "Zero concurrency", opts: []Option{WithConcurrency(0)}},
+		{name: "Zero timeout", opts: []Option{WithTimeout(0)}},
+		{name: "Negative retries", opts: []Option{WithRetry(RetryPolicy{Retries: -1})}},
+		{name: "Negative budget", opts: []Option{WithRunBudget(-1, 0)}},
+		{name: "Adaptive without target", opts: []Option{WithAdaptive(0)}},
+		{name: "Zero weights", opts: []Option{WithScoreWeights(ScoreWeights{})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Run(context.Background(), servers, domains, tt.opts...); err == nil {
+				t.Error("Run() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestRun_Options(t *testing.T) {
+	config := defaultRunConfig()
+	for _, opt := range []Option{
+		WithRepeats(3),
+		WithTimeout(time.Second),
+		WithRetry(RetryPolicy{Retries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Second}),
+		WithResolverBudget(100, time.Minute),
+		WithAdaptive(time.Millisecond),
+		WithReporter(nil),
+	} {
+		opt(&config)
+	}
+
+	if err := config.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	if config.Repeats != 3 || config.LookupTimeout != time.Second || config.Retry.Retries != 2 {
+		t.Errorf("options not applied: %+v", config)
+	}
+	if config.MaxQueries != 100 || config.MaxTime != time.Minute || !config.Adaptive || config.TargetCI != time.Millisecond {
+		t.Errorf("budget options not applied: %+v", config)
+	}
+	if config.Reporter == nil {
+		t.Error("WithReporter(nil) cleared the default reporter")
+	}
+}
@@ -0,0 +1,581 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// DNSServer represents a resolver to be benchmarked
+type DNSServer struct {
+	Name      string    `json:"name"`
+	Addr      string    `json:"addr"`
+	Transport Transport `json:"transport,omitempty"`
+	// Hostname is the name verified in the certificate of a TLS resolver;
+	// it defaults to Addr.
+	Hostname string `json:"hostname,omitempty"`
+	// Provider groups the endpoints of one operator, for example its IPv4
+	// and IPv6 addresses.
+	Provider string `json:"provider,omitempty"`
+}
+
+// BenchmarkResult contains the results for a single resolver
+type BenchmarkResult struct {
+	Server  DNSServer `json:"server"`
+	Stats   Stats     `json:"stats"`
+	Score   float64   `json:"score"`
+	Stopped string    `json:"stopped,omitempty"`
+	Failure string    `json:"failure,omitempty"`
+	Cold    *Stats    `json:"cold,omitempty"`
+	RTT     *RTT      `json:"rtt,omitempty"`
+	// Samples are the raw queries of the result. They are left out of its
+	// JSON, which would grow with every query; the history and the sample
+	// export keep them.
+	Samples []Sample `json:"-"`
+}
+
+// Failed returns true if the resolver produced no usable results or was cut off
+func (r *BenchmarkResult) Failed() bool {
+	return r.Failure != "" || !r.Stats.IsValid()
+}
+
+// FailureReason describes why the resolver is in the failed section
+func (r *BenchmarkResult) FailureReason() string {
+	if r.Failure != "" {
+		return r.Failure
+	}
+	return "no successful queries"
+}
+
+// Interrupted returns true if the run was canceled before the resolver was
+// completely measured.
+func (r *BenchmarkResult) Interrupted() bool {
+	return r.Stopped == StopCanceled
+}
+
+// Latencies returns the latencies of all successful samples in milliseconds
+func (r *BenchmarkResult) Latencies() []float64 {
+	return successfulLatencies(r.Samples)
+}
+
+// Sample is the outcome of a single measured query
+type Sample struct {
+	Domain string `json:"domain"`
+	// QType is set when queries of a run ask for different record types.
+	QType    QType   `json:"qtype,omitempty"`
+	Latency  float64 `json:"latency"`
+	Total    float64 `json:"total"`
+	Attempts int     `json:"attempts"`
+	// RCode and Answers describe the final response; RCode is empty when
+	// none arrived.
+	RCode      string `json:"rcode,omitempty"`
+	Answers    int    `json:"answers,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// Stats contains latency statistics for a resolver
+type Stats struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	Jitter float64 `json:"jitter"`
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	Total  int     `json:"total"`
+
+	// Retry accounting. Min, Max and Mean only cover the final attempt of
+	// each query; these fields expose what the retries cost.
+	Attempts  int     `json:"attempts"`
+	FirstTry  int     `json:"firstTry"`
+	MeanTotal float64 `json:"meanTotal"`
+
+	// Bootstrap confidence intervals of the mean and median.
+	MeanCI   Interval `json:"meanCi"`
+	MedianCI Interval `json:"medianCi"`
+}
+
+// MarshalJSON encodes stats, writing undefined (NaN) values as null since
+// JSON has no representation for them.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type plain Stats
+	return jsonnan.Marshal(plain(s))
+}
+
+// UnmarshalJSON decodes stats written by MarshalJSON, restoring null and
+// missing values as NaN.
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	type plain Stats
+	p := plain(CalculateStats(nil, 0, 0))
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*s = Stats(p)
+	return nil
+}
+
+// IsValid returns true if the stats contain valid data
+func (s Stats) IsValid() bool {
+	return s.Count > 0 && !math.IsNaN(s.Mean)
+}
+
+// SuccessRate returns the success rate as a percentage
+func (s Stats) SuccessRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Count) / float64(s.Total)
+}
+
+// FirstTrySuccessRate returns the fraction of queries that succeeded without a retry
+func (s Stats) FirstTrySuccessRate() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.FirstTry) / float64(s.Total)
+}
+
+func runBenchmark(ctx context.Context, config *runConfig, servers []DNSServer, domains []string, reporter BenchmarkReporter) ([]BenchmarkResult, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("no DNS servers provided")
+	}
+
+	if len(domains) == 0 {
+		return nil, errors.New("no domains provided")
+	}
+
+	if reporter == nil {
+		reporter = NoopReporter{}
+	}
+
+	reporter.OnStart(len(servers), domains)
+
+	results := make([]BenchmarkResult, 0, len(servers))
+	var runErr error
+
+	// Upper bound of the best median seen so far, used by adaptive sampling
+	// to stop early on resolvers that are clearly slower.
+	fastest := math.Inf(1)
+	limits := resolverLimits(config, len(servers))
+
+	sampler, _ := reporter.(SampleReporter)
+
+	prior := make(map[string]BenchmarkResult, len(config.Resume))
+	for _, r := range config.Resume {
+		prior[r.Server.Endpoint()] = r
+	}
+	pending := slices.DeleteFunc(slices.Clone(servers), func(s DNSServer) bool {
+		r, ok := prior[s.Endpoint()]
+		return ok && !r.Interrupted()
+	})
+
+	var unreachable map[string]string
+	if config.PreflightTimeout > 0 && len(pending) > 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "Probing resolvers", slog.Int("count", len(pending)))
+		unreachable = ProbeResolvers(ctx, pending, domains[0], config.PreflightTimeout)
+	}
+
+	for i, server := range servers {
+		if cErr := ctx.Err(); cErr != nil {
+			runErr = cErr
+			slog.LogAttrs(ctx, slog.LevelWarn, "Benchmark canceled", logattr.Err(cErr))
+			break
+		}
+
+		slog.LogAttrs(ctx, slog.LevelInfo, "Benchmarking resolver",
+			slog.String("name", server.Name),
+			slog.String("addr", server.Addr),
+			slog.Int("progress", i+1),
+			slog.Int("total", len(servers)),
+		)
+
+		reporter.OnResolverStart(server, i+1, len(servers))
+
+		resumed, ok := prior[server.Endpoint()]
+		if ok && !resumed.Interrupted() {
+			results = append(results, resumed)
+			if !resumed.Failed() {
+				fastest = math.Min(fastest, resumed.Stats.MedianCI.High)
+			}
+			reporter.OnResolverDone(server, resumed.Stats, 0)
+			continue
+		}
+
+		if reason, ok := unreachable[server.Endpoint()]; ok {
+			result := BenchmarkResult{Server: server, Stats: CalculateStats(nil, 0, 0), Failure: reason}
+			results = append(results, result)
+			if sampler != nil {
+				sampler.OnResolverResult(result)
+			}
+			reporter.OnResolverDone(server, result.Stats, 0)
+			continue
+		}
+
+		start := time.Now()
+
+		limits.after = max(limits.window, config.replayDuration()) * time.Duration(len(servers)-i-1)
+		result := benchmarkResolver(ctx, config, server, domains, reporter, limits, fastest, resumed.Samples)
+		if ctx.Err() != nil && result.Stopped == "" {
+			result.Stopped = StopCanceled
+		}
+		results = append(results, result)
+		if sampler != nil && !result.Interrupted() {
+			sampler.OnResolverResult(result)
+		}
+		stats := result.Stats
+		if !result.Failed() {
+			fastest = math.Min(fastest, stats.MedianCI.High)
+		}
+
+		took := time.Since(start)
+		slog.LogAttrs(ctx, slog.LevelInfo, "Finished benchmarking resolver",
+			slog.String("name", server.Name),
+			slog.String("addr", server.Addr),
+			slog.Int64("took_ms", took.Milliseconds()),
+			slog.Float64("success_rate", stats.SuccessRate()*100),
+			slog.Float64("first_try_rate", stats.FirstTrySuccessRate()*100),
+			slog.Int("attempts", stats.Attempts),
+			slog.Int("queries", stats.Total),
+			slog.String("stopped", result.Stopped),
+			slog.String("failure", result.Failure),
+		)
+
+		reporter.OnResolverDone(server, stats, took)
+
+		// Cool off after each server.
+		gcAndWait()
+	}
+
+	// A run canceled while measuring the last resolver did not reach the
+	// check at the top of the loop.
+	if cErr := ctx.Err(); cErr != nil && runErr == nil {
+		runErr = cErr
+	}
+
+	scoreResults(results, config.ScoreWeights)
+
+	reporter.OnComplete(results, runErr)
+	return results, runErr
+}
+
+// benchmarkResolver measures a single resolver. resumed holds the samples of
+// an interrupted earlier run; they count towards the repeats of a fixed run.
+func benchmarkResolver(ctx context.Context, config *runConfig, server DNSServer, domains []string, reporter BenchmarkReporter, limits sampleLimits, fastest float64, resumed []Sample) BenchmarkResult {
+	resolver := NewServerResolver(server, config.MaxConcurrency)
+	resolver.SetQType(config.QType)
+	resolver.capture = config.Capture
+	if config.dial != nil {
+		resolver.dial = config.dial
+	}
+	if config.Seed != 0 {
+		resolver.seed(config.Seed)
+	}
+
+	parent := ctx
+	// The circuit breaker cancels the remaining queries of this resolver only.
+	ctx, trip := context.WithCancel(ctx)
+	defer trip()
+
+	run := &resolverRun{
+		server:      server,
+		reporter:    reporter,
+		threshold:   config.BreakerThreshold,
+		trip:        trip,
+		interrupted: func() bool { return parent.Err() != nil },
+	}
+	run.sampler, _ = reporter.(SampleReporter)
+
+	if config.WarmupRuns > 0 {
+		cold := warmupResolver(ctx, config, resolver, domains)
+		run.cold = &cold
+		reporter.OnWarmupDone(server, cold)
+	}
+	var rtt *RTT
+	if config.RTTProbes > 0 {
+		measured := MeasureRTT(ctx, server, config.RTTMethod, config.RTTProbes, config.LookupTimeout)
+		rtt = &measured
+	}
+
+	switch {
+	case len(config.Workload) > 0:
+		run.stopped = replayWorkload(ctx, config, resolver, run, limits)
+	case config.Adaptive:
+		run.stopped = sampleAdaptively(ctx, config, resolver, domains, run, limits, fastest)
+	case limits.bounded():
+		run.stopped = samplePaced(ctx, config, resolver, domains, run, limits)
+	case len(resumed) > 0:
+		run.samples = slices.Clone(resumed)
+		remaining := remainingQueries(domains, config.Repeats, resumed)
+		queryBatch(ctx, resolver, remaining, 1, config.LookupTimeout, config.Retry, run.add)
+	default:
+		queryBatch(ctx, resolver, domains, config.Repeats, config.LookupTimeout, config.Retry, run.add)
+	}
+
+	result := run.result()
+	if rtt != nil {
+		rtt.Overhead = result.Stats.Median - float64(rtt.RoundTrips)*rtt.Min
+		result.RTT = rtt
+	}
+	return result
+}
+
+// remainingQueries lists the queries of a fixed run that are not covered by
+// samples yet, in the order queryBatch would send them.
+func remainingQueries(domains []string, repeats int, samples []Sample) []string {
+	done := make(map[string]int, len(domains))
+	for _, s := range samples {
+		done[s.Domain]++
+	}
+	var remaining []string
+	for range repeats {
+		for _, domain := range domains {
+			if done[domain] > 0 {
+				done[domain]--
+				continue
+			}
+			remaining = append(remaining, domain)
+		}
+	}
+	return remaining
+}
+
+// queryBatch queries every domain repeats times concurrently and hands each
+// outcome to emit. emit is always called from the calling goroutine.
+func queryBatch(ctx context.Context, resolver *Resolver, domains []string, repeats int, timeout time.Duration, retry RetryPolicy, emit func(domain string, res QueryResult, err error)) {
+	type result struct {
+		domain string
+		query  QueryResult
+		err    error
+	}
+
+	total := len(domains) * repeats
+	results := make(chan result, total)
+
+	errg, ctx := errgroup.WithContext(ctx)
+
+	for range repeats {
+		for _, domain := range domains {
+			errg.Go(func() error {
+				res, err := resolver.QueryDNS(ctx, domain, timeout, retry)
+				results <- result{domain: domain, query: res, err: err}
+				return nil
+			})
+		}
+	}
+
+	// once all lookups are done (or parent ctx canceled), close the channel
+	go func() {
+		if err := errg.Wait(); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "Unexpected worker pool error", logattr.Err(err))
+		}
+		close(results)
+	}()
+
+	for r := range results {
+		emit(r.domain, r.query, r.err)
+	}
+}
+
+// resolverRun accumulates the samples of a single resolver.
+type resolverRun struct {
+	server   DNSServer
+	reporter BenchmarkReporter
+	samples  []Sample
+	stopped  string
+	cold     *Stats
+	sampler  SampleReporter
+
+	// interrupted reports whether the whole run was canceled.
+	interrupted func() bool
+
+	// Circuit breaker: after threshold consecutive failures, trip cancels
+	// the outstanding queries and failure records why.
+	threshold   int
+	consecutive int
+	trip        context.CancelFunc
+	failure     string
+}
+
+func newSample(domain string, res QueryResult, err error) Sample {
+	sample := Sample{
+		Domain:   domain,
+		Total:    res.Total.Seconds() * 1000,
+		Attempts: res.Attempts,
+		RCode:    res.RCode,
+		Answers:  res.Answers,
+	}
+	if err != nil {
+		sample.Error = err.Error()
+		sample.ErrorClass = ErrorClass(err)
+	} else {
+		sample.Latency = res.Latency.Seconds() * 1000
+	}
+	return sample
+}
+
+func (r *resolverRun) add(domain string, res QueryResult, err error) {
+	r.addSample(newSample(domain, res, err), err)
+}
+
+// addSample records the sample of a query that failed with err, if any.
+func (r *resolverRun) addSample(sample Sample, err error) {
+	if err != nil {
+		// Queries aborted by the breaker or by canceling the run were never
+		// answered or timed out; counting them would only inflate the error
+		// total.
+		if errors.Is(err, context.Canceled) && (r.failure != "" || r.interrupted != nil && r.interrupted()) {
+			return
+		}
+		r.record(sample)
+		r.reporter.OnQueryResult(r.server, sample.Domain, 0, err)
+
+		r.consecutive++
+		if r.threshold > 0 && r.consecutive >= r.threshold && r.failure == "" {
+			r.failure = fmt.Sprintf("circuit breaker opened after %d consecutive failures", r.consecutive)
+			slog.Warn("Circuit breaker opened",
+				slog.String("name", r.server.Name),
+				slog.String("addr", r.server.Addr),
+				slog.Int("consecutive_failures", r.consecutive),
+			)
+			r.trip()
+		}
+		return
+	}
+	r.consecutive = 0
+	r.record(sample)
+	r.reporter.OnQueryResult(r.server, sample.Domain, sample.Latency, nil)
+}
+
+func (r *resolverRun) record(sample Sample) {
+	r.samples = append(r.samples, sample)
+	if r.sampler != nil {
+		r.sampler.OnSample(r.server, sample)
+	}
+}
+
+func (r *resolverRun) result() BenchmarkResult {
+	return BenchmarkResult{
+		Server:  r.server,
+		Stats:   SummarizeSamples(r.samples),
+		Stopped: r.stopped,
+		Failure: r.failure,
+		Cold:    r.cold,
+		Samples: r.samples,
+	}
+}
+
+// SummarizeSamples computes Stats, including retry accounting, from raw samples.
+func SummarizeSamples(samples []Sample) Stats {
+	var (
+		latencies = make([]float64, 0, len(samples))
+		errs      int
+		attempts  int
+		firstTry  int
+		totalTime float64
+	)
+
+	for _, s := range samples {
+		attempts += s.Attempts
+		if s.Error != "" {
+			errs++
+			continue
+		}
+		if s.Attempts == 1 {
+			firstTry++
+		}
+		totalTime += s.Total
+		latencies = append(latencies, s.Latency)
+	}
+
+	stats := CalculateStats(latencies, errs, len(samples))
+	stats.Attempts = attempts
+	stats.FirstTry = firstTry
+	if stats.Count > 0 {
+		stats.MeanTotal = totalTime / float64(stats.Count)
+	}
+	return stats
+}
+
+// warmupResolver runs config.WarmupRuns passes over domains before any
+// measurement starts. Each pass completes before the next one begins, so the
+// first pass sees the resolver's cache cold; its latencies are returned as the
+// cold first query statistic. Warmup queries are never retried.
+func warmupResolver(ctx context.Context, config *runConfig, resolver *Resolver, domains []string) Stats {
+	slog.LogAttrs(ctx, slog.LevelDebug, "Performing warmup queries",
+		slog.Int("warmup_runs", config.WarmupRuns),
+		slog.Int("domains", len(domains)),
+		slog.String("resolver", resolver.serverAddr),
+	)
+
+	var cold []Sample
+	for pass := range config.WarmupRuns {
+		queryBatch(ctx, resolver, domains, 1, config.LookupTimeout, NoRetry, func(domain string, res QueryResult, err error) {
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelDebug, "Warmup query failed", logattr.Err(err))
+			}
+			if pass == 0 {
+				cold = append(cold, newSample(domain, res, err))
+			}
+		})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	gcAndWait()
+
+	return SummarizeSamples(cold)
+}
+
+// CalculateStats computes latency statistics and bootstrap confidence
+// intervals from the latencies, in milliseconds, of successful queries. It
+// sorts latencies in place. Without latencies every statistic is NaN.
+func CalculateStats(latencies []float64, errs, total int) Stats {
+	if len(latencies) == 0 {
+		nan := Interval{Low: math.NaN(), High: math.NaN()}
+		return Stats{
+			Min:       math.NaN(),
+			Max:       math.NaN(),
+			Mean:      math.NaN(),
+			Median:    math.NaN(),
+			P95:       math.NaN(),
+			Jitter:    math.NaN(),
+			Count:     0,
+			Errors:    errs,
+			Total:     total,
+			MeanTotal: math.NaN(),
+			MeanCI:    nan,
+			MedianCI:  nan,
+		}
+	}
+
+	sort.Float64s(latencies)
+
+	rng := newBootstrapRand()
+	return Stats{
+		Min:      latencies[0],
+		Max:      latencies[len(latencies)-1],
+		Mean:     mean(latencies),
+		Median:   percentile(latencies, 0.5),
+		P95:      percentile(latencies, 0.95),
+		Jitter:   stddev(latencies),
+		Count:    len(latencies),
+		Errors:   errs,
+		Total:    total,
+		MeanCI:   bootstrapCI(latencies, mean, rng),
+		MedianCI: bootstrapCI(latencies, median, rng),
+	}
+}
@@ -0,0 +1,314 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStats_IsValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats Stats
+		want  bool
+	}{
+		{
+			name: "Valid stats",
+			stats: Stats{
+				Min:    1.0,
+				Max:    10.0,
+				Mean:   5.0,
+				Count:  100,
+				Errors: 0,
+				Total:  100,
+			},
+			want: true,
+		},
+		{
+			name: "Zero count",
+			stats: Stats{
+				Min:    1.0,
+				Max:    10.0,
+				Mean:   5.0,
+				Count:  0,
+				Errors: 0,
+				Total:  100,
+			},
+			want: false,
+		},
+		{
+			name: "NaN mean",
+			stats: Stats{
+				Min:    1.0,
+				Max:    10.0,
+				Mean:   math.NaN(),
+				Count:  100,
+				Errors: 0,
+				Total:  100,
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.IsValid(); got != tt.want {
+				t.Errorf("Stats.IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats_SuccessRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats Stats
+		want  float64
+	}{
+		{
+			name: "All successful",
+			stats: Stats{
+				Count: 100,
+				Total: 100,
+			},
+			want: 1.0,
+		},
+		{
+			name: "50% success rate",
+			stats: Stats{
+				Count: 50,
+				Total: 100,
+			},
+			want: 0.5,
+		},
+		{
+			name: "Zero total",
+			stats: Stats{
+				Count: 0,
+				Total: 0,
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.SuccessRate(); got != tt.want {
+				t.Errorf("Stats.SuccessRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []float64
+		errors    int
+		total     int
+		want      Stats
+	}{
+		{
+			name:      "Empty latencies",
+			latencies: []float64{},
+			errors:    5,
+			total:     10,
+			want: Stats{
+				Min:    math.NaN(),
+				Max:    math.NaN(),
+				Mean:   math.NaN(),
+				Count:  0,
+				Errors: 5,
+				Total:  10,
+			},
+		},
+		{
+			name:      "Normal distribution",
+			latencies: []float64{1.0, 2.0, 3.0, 4.0, 5.0},
+			errors:    2,
+			total:     7,
+			want: Stats{
+				Min:    1.0,
+				Max:    5.0,
+				Mean:   3.0,
+				Count:  5,
+				Errors: 2,
+				Total:  7,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CalculateStats(tt.latencies, tt.errors, tt.total)
+
+			// Special handling for NaN comparisons
+			if math.IsNaN(got.Min) != math.IsNaN(tt.want.Min) ||
+				(!math.IsNaN(got.Min) && got.Min != tt.want.Min) {
+				t.Errorf("CalculateStats() Min = %v, want %v", got.Min, tt.want.Min)
+			}
+			if math.IsNaN(got.Max) != math.IsNaN(tt.want.Max) ||
+				(!math.IsNaN(got.Max) && got.Max != tt.want.Max) {
+				t.Errorf("CalculateStats() Max = %v, want %v", got.Max, tt.want.Max)
+			}
+			if math.IsNaN(got.Mean) != math.IsNaN(tt.want.Mean) ||
+				(!math.IsNaN(got.Mean) && got.Mean != tt.want.Mean) {
+				t.Errorf("CalculateStats() Mean = %v, want %v", got.Mean, tt.want.Mean)
+			}
+			if got.Count != tt.want.Count {
+				t.Errorf("CalculateStats() Count = %v, want %v", got.Count, tt.want.Count)
+			}
+			if got.Errors != tt.want.Errors {
+				t.Errorf("CalculateStats() Errors = %v, want %v", got.Errors, tt.want.Errors)
+			}
+			if got.Total != tt.want.Total {
+				t.Errorf("CalculateStats() Total = %v, want %v", got.Total, tt.want.Total)
+			}
+		})
+	}
+}
+
+func TestRunBenchmark_ValidatesInput(t *testing.T) {
+	ctx := context.Background()
+	cfg := &runConfig{Repeats: 1}
+
+	if _, err := runBenchmark(ctx, cfg, nil, []string{"example.com"}, NoopReporter{}); err == nil {
+		t.Fatalf("expected error for missing servers")
+	}
+
+	if _, err := runBenchmark(ctx, cfg, []DNSServer{{Name: "a", Addr: "1.1.1.1"}}, nil, NoopReporter{}); err == nil {
+		t.Fatalf("expected error for missing domains")
+	}
+}
+
+func TestResolverRun_CircuitBreaker(t *testing.T) {
+	tripped := false
+	run := &resolverRun{
+		server:    DNSServer{Name: "dead", Addr: "192.0.2.1"},
+		reporter:  NoopReporter{},
+		threshold: 3,
+		trip:      func() { tripped = true },
+	}
+
+	failure := errors.New("timeout")
+	run.add("example.com", QueryResult{Attempts: 1}, nil)
+	for range 3 {
+		run.add("example.com", QueryResult{Attempts: 1}, failure)
+	}
+	if !tripped || run.failure == "" {
+		t.Fatalf("breaker did not open after 3 consecutive failures")
+	}
+
+	// Queries canceled by the breaker must not be counted.
+	run.add("example.com", QueryResult{}, fmt.Errorf("query: %w", context.Canceled))
+
+	res := run.result()
+	if res.Stats.Total != 4 || res.Stats.Errors != 3 {
+		t.Errorf("result stats = %+v, want 4 queries with 3 errors", res.Stats)
+	}
+	if !res.Failed() {
+		t.Errorf("result should be reported as failed")
+	}
+}
+
+func TestResolverRun_BreakerResetsOnSuccess(t *testing.T) {
+	run := &resolverRun{
+		reporter:  NoopReporter{},
+		threshold: 2,
+		trip:      func() { t.Fatalf("breaker opened on non-consecutive failures") },
+	}
+
+	failure := errors.New("timeout")
+	run.add("example.com", QueryResult{Attempts: 1}, failure)
+	run.add("example.com", QueryResult{Attempts: 1}, nil)
+	run.add("example.com", QueryResult{Attempts: 1}, failure)
+
+	if run.failure != "" {
+		t.Errorf("unexpected failure %q", run.failure)
+	}
+}
+
+func TestBenchmarkResolver_Warmup(t *testing.T) {
+	domains := []string{"a.example", "b.example", "c.example", "d.example"}
+	// The first query of each domain misses the cache of the fake resolver.
+	config := &runConfig{
+		LookupTimeout:  time.Second,
+		Repeats:        2,
+		MaxConcurrency: 4,
+		WarmupRuns:     2,
+		dial: fakeDial(func(n int64) time.Duration {
+			if n <= int64(len(domains)) {
+				return 30 * time.Millisecond
+			}
+			return time.Millisecond
+		}),
+	}
+
+	result := benchmarkResolver(context.Background(), config, DNSServer{Name: "fake", Addr: "192.0.2.53"}, domains, NoopReporter{}, sampleLimits{}, math.Inf(1), nil)
+	if result.Cold == nil || result.Cold.Count != len(domains) || result.Cold.Min < 30 {
+		t.Errorf("Cold = %+v, want the %d queries of the first warmup pass, each at least 30ms", result.Cold, len(domains))
+	}
+	if result.Stats.Total != 2*len(domains) || len(result.Samples) != 2*len(domains) {
+		t.Errorf("Stats.Total = %d with %d samples, want %d without the warmup queries", result.Stats.Total, len(result.Samples), 2*len(domains))
+	}
+	if result.Stats.Max >= 30 {
+		t.Errorf("Stats.Max = %v, want the warm queries only", result.Stats.Max)
+	}
+}
+
+func TestRemainingQueries(t *testing.T) {
+	domains := []string{"a.example", "b.example"}
+	samples := []Sample{{Domain: "a.example"}, {Domain: "b.example"}, {Domain: "a.example"}}
+
+	got := remainingQueries(domains, 3, samples)
+	want := []string{"b.example", "a.example", "b.example"}
+	if !slices.Equal(got, want) {
+		t.Errorf("remainingQueries() = %v, want %v", got, want)
+	}
+	if got := remainingQueries(domains, 1, samples); len(got) != 0 {
+		t.Errorf("remainingQueries() = %v, want none", got)
+	}
+}
+
+type sampleRecorder struct {
+	NoopReporter
+	samples []Sample
+	results []BenchmarkResult
+}
+
+func (r *sampleRecorder) OnSample(_ DNSServer, s Sample)       { r.samples = append(r.samples, s) }
+func (r *sampleRecorder) OnResolverResult(res BenchmarkResult) { r.results = append(r.results, res) }
+
+func TestRunBenchmark_Resume(t *testing.T) {
+	done := DNSServer{Name: "done", Addr: "127.0.0.253"}
+	partial := DNSServer{Name: "partial", Addr: "127.0.0.254"}
+	domains := []string{"a.example", "b.example"}
+	prior := []BenchmarkResult{
+		{Server: done, Stats: SummarizeSamples([]Sample{{Domain: "a.example", Latency: 5, Attempts: 1}})},
+		{Server: partial, Stopped: StopCanceled, Samples: []Sample{{Domain: "a.example", Latency: 7, Attempts: 1}}},
+	}
+	cfg := &runConfig{Repeats: 1, MaxConcurrency: 1, LookupTimeout: 50 * time.Millisecond, Resume: prior}
+
+	recorder := &sampleRecorder{}
+	results, err := runBenchmark(context.Background(), cfg, []DNSServer{done, partial}, domains, recorder)
+	if err != nil {
+		t.Fatalf("runBenchmark() error = %v", err)
+	}
+
+	if results[0].Stats.Total != 1 || results[0].Stats.Median != 5 {
+		t.Errorf("complete resolver was measured again: %+v", results[0].Stats)
+	}
+	if got := results[1].Samples; len(got) != 2 || got[0] != prior[1].Samples[0] || got[1].Domain != "b.example" {
+		t.Errorf("resumed samples = %+v, want the earlier sample and one query of b.example", got)
+	}
+	if results[1].Interrupted() {
+		t.Errorf("resumed resolver is still marked interrupted")
+	}
+	if len(recorder.samples) != 1 || len(recorder.results) != 1 || recorder.results[0].Server != partial {
+		t.Errorf("recorded %d samples and %d results, want only the new ones", len(recorder.samples), len(recorder.results))
+	}
+}
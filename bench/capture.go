@@ -0,0 +1,395 @@
+package bench
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"slices"
+	"strings"
+	"time"
+)
+
+// File and block magics of the capture formats.
+const (
+	pcapMagic       = 0xa1b2c3d4 // microsecond timestamps
+	pcapMagicNanos  = 0xa1b23c4d
+	pcapngBlockSHB  = 0x0a0d0d0a
+	pcapngByteOrder = 0x1a2b3c4d
+
+	pcapngBlockIDB = 1
+	pcapngBlockSPB = 3
+	pcapngBlockEPB = 6
+
+	// maxCaptureBlock bounds the records of a capture, far above the
+	// largest snap length in use.
+	maxCaptureBlock = 1 << 24
+)
+
+// Link types of captured frames.
+const (
+	linkNull      = 0
+	linkEthernet  = 1
+	linkRaw       = 101
+	linkLoop      = 108
+	linkLinuxSLL  = 113
+	linkIPv4      = 228
+	linkIPv6      = 229
+	linkLinuxSLL2 = 276
+)
+
+// ReadWorkload reads the DNS queries of a pcap, pcapng or dnstap capture,
+// ordered by the time they were sent. Packet captures contribute the queries
+// sent to port 53 over UDP, and over TCP when a segment holds whole
+// messages; dnstap captures their client, stub and tool queries. A capture
+// cut off in the middle of a record, like one of a killed tcpdump, is read up
+// to that record.
+func ReadWorkload(r io.Reader) ([]WorkloadQuery, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading capture: %w", err)
+	}
+
+	var w workloadReader
+	switch be, le := binary.BigEndian.Uint32(magic), binary.LittleEndian.Uint32(magic); {
+	case be == pcapngBlockSHB:
+		err = readPcapng(br, w.add)
+	case be == pcapMagic || be == pcapMagicNanos || le == pcapMagic || le == pcapMagicNanos:
+		err = readPcap(br, w.add)
+	case be == 0:
+		// Frame streams start with the escape of a control frame.
+		err = readDnstap(br, w.add)
+	default:
+		return nil, errors.New("unrecognized capture format: expected pcap, pcapng or dnstap")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(w.queries) == 0 {
+		return nil, errors.New("no DNS queries found in the capture")
+	}
+	return w.workload(), nil
+}
+
+// workloadReader collects the queries of a capture with their timestamps.
+type workloadReader struct {
+	queries []WorkloadQuery
+	times   []time.Time
+}
+
+// add records msg if it is a standard query with a question.
+func (w *workloadReader) add(t time.Time, msg []byte) {
+	if len(msg) < 12 || msg[2]&0xf8 != 0 {
+		// A response, or an opcode other than QUERY.
+		return
+	}
+	q, err := parseQuestion(msg)
+	if err != nil || q.name == "" {
+		return
+	}
+	w.queries = append(w.queries, WorkloadQuery{Name: strings.ToLower(q.name), QType: q.qtype})
+	w.times = append(w.times, t)
+}
+
+// workload sorts the queries by time and sets their offsets from the first.
+func (w *workloadReader) workload() []WorkloadQuery {
+	order := make([]int, len(w.queries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return w.times[a].Compare(w.times[b]) })
+
+	first := w.times[order[0]]
+	queries := make([]WorkloadQuery, 0, len(order))
+	for _, i := range order {
+		q := w.queries[i]
+		q.At = w.times[i].Sub(first)
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// readFull reads len(buf) bytes and reports whether the capture continues:
+// a clean or torn end of the file is not an error.
+func readFull(r io.Reader, buf []byte) (bool, error) {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func readPcap(r io.Reader, emit func(time.Time, []byte)) error {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("reading pcap header: %w", err)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if m := binary.BigEndian.Uint32(header[:]); m == pcapMagic || m == pcapMagicNanos {
+		order = binary.BigEndian
+	}
+	nanos := order.Uint32(header[:]) == pcapMagicNanos
+	link := order.Uint32(header[20:]) & 0xffff
+
+	var record [16]byte
+	for {
+		if ok, err := readFull(r, record[:]); !ok {
+			return err
+		}
+		sec, frac, size := order.Uint32(record[:]), order.Uint32(record[4:]), order.Uint32(record[8:])
+		if size > maxCaptureBlock {
+			return fmt.Errorf("pcap record of %d bytes", size)
+		}
+		frame := make([]byte, size)
+		if ok, err := readFull(r, frame); !ok {
+			return err
+		}
+		if !nanos {
+			frac *= 1000
+		}
+		t := time.Unix(int64(sec), int64(frac))
+		for _, msg := range frameDNS(link, frame) {
+			emit(t, msg)
+		}
+	}
+}
+
+// pcapngInterface is the link type and timestamp resolution of an interface
+// of a pcapng section.
+type pcapngInterface struct {
+	link  uint32
+	units uint64 // timestamp units per second
+}
+
+func (i pcapngInterface) time(ts uint64) time.Time {
+	sec, frac := ts/i.units, ts%i.units
+	hi, lo := bits.Mul64(frac, uint64(time.Second))
+	nanos, _ := bits.Div64(hi, lo, i.units)
+	return time.Unix(int64(sec), int64(nanos)) //nolint:gosec // seconds of a capture fit
+}
+
+func readPcapng(r io.Reader, emit func(time.Time, []byte)) error {
+	var (
+		order  binary.ByteOrder = binary.LittleEndian
+		ifaces []pcapngInterface
+		last   time.Time
+	)
+	for {
+		var head [8]byte
+		if ok, err := readFull(r, head[:]); !ok {
+			return err
+		}
+		kind := order.Uint32(head[:])
+		if binary.BigEndian.Uint32(head[:]) == pcapngBlockSHB {
+			// A section header sets the byte order of the blocks after it,
+			// its own length included.
+			var magic [4]byte
+			if ok, err := readFull(r, magic[:]); !ok {
+				return err
+			}
+			switch {
+			case binary.BigEndian.Uint32(magic[:]) == pcapngByteOrder:
+				order = binary.BigEndian
+			case binary.LittleEndian.Uint32(magic[:]) == pcapngByteOrder:
+				order = binary.LittleEndian
+			default:
+				return errors.New("pcapng section header without a byte-order magic")
+			}
+			ifaces = nil
+			size := order.Uint32(head[4:])
+			if size < 28 || size%4 != 0 || size > maxCaptureBlock {
+				return fmt.Errorf("pcapng section header of %d bytes", size)
+			}
+			if ok, err := readFull(r, make([]byte, size-12)); !ok {
+				return err
+			}
+			continue
+		}
+
+		size := order.Uint32(head[4:])
+		if size < 12 || size%4 != 0 || size > maxCaptureBlock {
+			return fmt.Errorf("pcapng block of %d bytes", size)
+		}
+		block := make([]byte, size-8)
+		if ok, err := readFull(r, block); !ok {
+			return err
+		}
+		body := block[:len(block)-4]
+
+		switch kind {
+		case pcapngBlockIDB:
+			iface, err := parsePcapngInterface(body, order)
+			if err != nil {
+				return err
+			}
+			ifaces = append(ifaces, iface)
+		case pcapngBlockEPB:
+			if len(body) < 20 {
+				return errors.New("pcapng packet block too short")
+			}
+			id, size := order.Uint32(body), order.Uint32(body[12:])
+			if int(id) >= len(ifaces) || int(size) > len(body)-20 {
+				return errors.New("pcapng packet block of an unknown interface or with a bad length")
+			}
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			last = ifaces[id].time(ts)
+			for _, msg := range frameDNS(ifaces[id].link, body[20:20+size]) {
+				emit(last, msg)
+			}
+		case pcapngBlockSPB:
+			// Simple packets have no timestamp; they count as sent with the
+			// packet before them.
+			if len(ifaces) == 0 || len(body) < 4 {
+				return errors.New("pcapng simple packet block without an interface")
+			}
+			size := min(int(order.Uint32(body)), len(body)-4)
+			for _, msg := range frameDNS(ifaces[0].link, body[4:4+size]) {
+				emit(last, msg)
+			}
+		}
+	}
+}
+
+// parsePcapngInterface reads an interface description block and its
+// if_tsresol option.
+func parsePcapngInterface(body []byte, order binary.ByteOrder) (pcapngInterface, error) {
+	if len(body) < 8 {
+		return pcapngInterface{}, errors.New("pcapng interface block too short")
+	}
+	iface := pcapngInterface{link: uint32(order.Uint16(body)), units: 1_000_000}
+	for opts := body[8:]; len(opts) >= 4; {
+		code, size := order.Uint16(opts), int(order.Uint16(opts[2:]))
+		if code == 0 || 4+size > len(opts) {
+			break
+		}
+		if code == 9 && size >= 1 {
+			v := opts[4]
+			switch {
+			case v&0x80 != 0 && v&0x7f < 64:
+				iface.units = 1 << (v & 0x7f)
+			case v&0x80 == 0 && v <= 19:
+				iface.units = 1
+				for range v {
+					iface.units *= 10
+				}
+			default:
+				return iface, fmt.Errorf("unsupported pcapng timestamp resolution %#x", v)
+			}
+		}
+		opts = opts[min(4+(size+3)&^3, len(opts)):]
+	}
+	return iface, nil
+}
+
+// frameDNS returns the DNS messages a captured frame sends to port 53.
+func frameDNS(link uint32, frame []byte) [][]byte {
+	packet, ok := linkPayload(link, frame)
+	if !ok {
+		return nil
+	}
+	proto, segment, ok := ipPayload(packet)
+	if !ok {
+		return nil
+	}
+	switch proto {
+	case 17: // UDP
+		if len(segment) < 8 || binary.BigEndian.Uint16(segment[2:]) != 53 {
+			return nil
+		}
+		end := min(max(int(binary.BigEndian.Uint16(segment[4:])), 8), len(segment))
+		return [][]byte{segment[8:end]}
+	case 6: // TCP
+		if len(segment) < 20 || binary.BigEndian.Uint16(segment[2:]) != 53 {
+			return nil
+		}
+		data := segment[min(int(segment[12]>>4)*4, len(segment)):]
+		var msgs [][]byte
+		for len(data) >= 2 {
+			n := int(binary.BigEndian.Uint16(data))
+			if n == 0 || 2+n > len(data) {
+				// Messages split across segments are left out.
+				break
+			}
+			msgs = append(msgs, data[2:2+n])
+			data = data[2+n:]
+		}
+		return msgs
+	}
+	return nil
+}
+
+// linkPayload strips the link-layer header of frame.
+func linkPayload(link uint32, frame []byte) ([]byte, bool) {
+	var header int
+	switch link {
+	case linkNull, linkLoop:
+		header = 4
+	case linkRaw, linkIPv4, linkIPv6:
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+		etherType, off := binary.BigEndian.Uint16(frame[12:]), 14
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(frame) >= off+4 {
+			// VLAN tags
+			etherType, off = binary.BigEndian.Uint16(frame[off+2:]), off+4
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return nil, false
+		}
+		header = off
+	case linkLinuxSLL:
+		header = 16
+	case linkLinuxSLL2:
+		header = 20
+	default:
+		return nil, false
+	}
+	if len(frame) < header {
+		return nil, false
+	}
+	return frame[header:], true
+}
+
+// ipPayload returns the protocol and payload of an unfragmented IPv4 or IPv6 packet.
+func ipPayload(packet []byte) (byte, []byte, bool) {
+	if len(packet) == 0 {
+		return 0, nil, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		header := int(packet[0]&0xf) * 4
+		if len(packet) < 20 || header < 20 || len(packet) < header {
+			return 0, nil, false
+		}
+		if binary.BigEndian.Uint16(packet[6:])&0x3fff != 0 {
+			// A fragment, or the first of several.
+			return 0, nil, false
+		}
+		end := min(max(int(binary.BigEndian.Uint16(packet[2:])), header), len(packet))
+		return packet[9], packet[header:end], true
+	case 6:
+		if len(packet) < 40 {
+			return 0, nil, false
+		}
+		next, payload := packet[6], packet[40:min(40+int(binary.BigEndian.Uint16(packet[4:])), len(packet))]
+		// Hop-by-hop, routing and destination options headers.
+		for next == 0 || next == 43 || next == 60 {
+			if len(payload) < 8 {
+				return 0, nil, false
+			}
+			size := (int(payload[1]) + 1) * 8
+			if size > len(payload) {
+				return 0, nil, false
+			}
+			next, payload = payload[0], payload[size:]
+		}
+		return next, payload, true
+	}
+	return 0, nil, false
+}
@@ -0,0 +1,226 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// udpFrame wraps msg in Ethernet, IPv4 and UDP headers addressed to port dport.
+func udpFrame(msg []byte, dport uint16) []byte {
+	frame := make([]byte, 14+20+8)
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	ip := frame[14:]
+	ip[0], ip[9] = 0x45, 17
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+8+len(msg))) //nolint:gosec // test messages are short
+	udp := ip[20:]
+	binary.BigEndian.PutUint16(udp[:], 40000)
+	binary.BigEndian.PutUint16(udp[2:], dport)
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(msg))) //nolint:gosec // test messages are short
+	return append(frame, msg...)
+}
+
+// tcpPacket is a raw IPv6 packet with a TCP segment to port 53 holding msg
+// with its length prefix.
+func tcpPacket(msg []byte) []byte {
+	packet := make([]byte, 40+20)
+	packet[0], packet[6] = 0x60, 6
+	binary.BigEndian.PutUint16(packet[4:], uint16(20+2+len(msg))) //nolint:gosec // test messages are short
+	tcp := packet[40:]
+	binary.BigEndian.PutUint16(tcp[2:], 53)
+	tcp[12] = 5 << 4
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(msg))) //nolint:gosec // test messages are short
+	return append(packet, msg...)
+}
+
+func testQuery(t *testing.T, name string, qtype QType) []byte {
+	t.Helper()
+	msg, err := buildQuery(1, name, qtype)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func pcapFile(link uint32, start time.Time, frames ...[]byte) []byte {
+	var b []byte
+	b = binary.LittleEndian.AppendUint32(b, pcapMagic)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint32(b, 65535)
+	b = binary.LittleEndian.AppendUint32(b, link)
+	for i, frame := range frames {
+		t := start.Add(time.Duration(i) * 250 * time.Millisecond)
+		b = binary.LittleEndian.AppendUint32(b, uint32(t.Unix()))            //nolint:gosec // test time
+		b = binary.LittleEndian.AppendUint32(b, uint32(t.Nanosecond()/1000)) //nolint:gosec // test time
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(frame)))          //nolint:gosec // test frames are short
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(frame)))          //nolint:gosec // test frames are short
+		b = append(b, frame...)
+	}
+	return b
+}
+
+func TestReadWorkload_Pcap(t *testing.T) {
+	response := answer(testQuery(t, "example.com", QTypeA), RCodeSuccess, false, QTypeA)
+	data := pcapFile(linkEthernet, time.Unix(1_700_000_000, 0),
+		udpFrame(testQuery(t, "Example.COM", QTypeA), 53),
+		udpFrame(response, 53),
+		udpFrame(testQuery(t, "printer.local", QTypeA), 5353),
+		udpFrame(testQuery(t, "example.org", QTypeHTTPS), 53),
+	)
+	// A capture cut off in the middle of a record is read up to it.
+	data = append(data, 1, 2, 3)
+
+	got, err := ReadWorkload(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadWorkload() error = %v", err)
+	}
+	want := []WorkloadQuery{
+		{Name: "example.com", QType: QTypeA},
+		{Name: "example.org", QType: QTypeHTTPS, At: 750 * time.Millisecond},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("ReadWorkload() = %+v, want %+v", got, want)
+	}
+
+	raw := pcapFile(linkRaw, time.Unix(1_700_000_000, 0), tcpPacket(testQuery(t, "example.net", QTypeAAAA)))
+	if got, err := ReadWorkload(bytes.NewReader(raw)); err != nil || len(got) != 1 || got[0].QType != QTypeAAAA {
+		t.Errorf("ReadWorkload() of DNS over TCP = %+v, %v", got, err)
+	}
+
+	if _, err := ReadWorkload(bytes.NewReader(pcapFile(linkEthernet, time.Now()))); err == nil {
+		t.Errorf("ReadWorkload() of a capture without queries error = nil")
+	}
+	if _, err := ReadWorkload(bytes.NewReader([]byte("name;ip\n"))); err == nil {
+		t.Errorf("ReadWorkload() of a text file error = nil")
+	}
+}
+
+func pcapngBlock(kind uint32, body []byte) []byte {
+	body = append(body, make([]byte, (4-len(body)%4)%4)...)
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, kind)
+	b = binary.BigEndian.AppendUint32(b, uint32(12+len(body))) //nolint:gosec // test blocks are short
+	b = append(b, body...)
+	return binary.BigEndian.AppendUint32(b, uint32(12+len(body))) //nolint:gosec // test blocks are short
+}
+
+func TestReadWorkload_Pcapng(t *testing.T) {
+	// A big-endian section with nanosecond timestamps (if_tsresol 9).
+	var shb []byte
+	shb = binary.BigEndian.AppendUint32(shb, pcapngByteOrder)
+	shb = append(shb, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	var idb []byte
+	idb = binary.BigEndian.AppendUint16(idb, linkEthernet)
+	idb = append(idb, 0, 0, 0, 0, 0, 0)
+	idb = append(idb, 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0)
+	epb := func(ns uint64, frame []byte) []byte {
+		var b []byte
+		b = binary.BigEndian.AppendUint32(b, 0)
+		b = binary.BigEndian.AppendUint32(b, uint32(ns>>32))
+		b = binary.BigEndian.AppendUint32(b, uint32(ns))         //nolint:gosec // low half
+		b = binary.BigEndian.AppendUint32(b, uint32(len(frame))) //nolint:gosec // test frames are short
+		b = binary.BigEndian.AppendUint32(b, uint32(len(frame))) //nolint:gosec // test frames are short
+		return pcapngBlock(pcapngBlockEPB, append(b, frame...))
+	}
+
+	start := uint64(1_700_000_000) * uint64(time.Second)
+	var data []byte
+	data = append(data, pcapngBlock(pcapngBlockSHB, shb)...)
+	data = append(data, pcapngBlock(pcapngBlockIDB, idb)...)
+	data = append(data, epb(start+1500, udpFrame(testQuery(t, "b.example", QTypeMX), 53))...)
+	data = append(data, epb(start, udpFrame(testQuery(t, "a.example", QTypeA), 53))...)
+
+	got, err := ReadWorkload(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadWorkload() error = %v", err)
+	}
+	want := []WorkloadQuery{{Name: "a.example", QType: QTypeA}, {Name: "b.example", QType: QTypeMX, At: 1500}}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("ReadWorkload() = %+v, want %+v in time order", got, want)
+	}
+}
+
+func TestReadWorkload_Dnstap(t *testing.T) {
+	frame := func(kind uint64, sec uint64, nsec uint32, query []byte) []byte {
+		m := protoAppendVarint(nil, dnstapMessageType, kind)
+		m = protoAppendVarint(m, dnstapQueryTimeSec, sec)
+		m = protoAppendFixed32(m, dnstapQueryTimeNsec, nsec)
+		m = protoAppendBytes(m, dnstapQueryMessage, query)
+		f := protoAppendBytes(nil, 1, []byte("resolver-1"))
+		f = protoAppendBytes(f, dnstapFieldMessage, m)
+		f = protoAppendVarint(f, 15, 1)
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(f))), f...) //nolint:gosec // test frames are short
+	}
+	control := func(kind uint32, payload []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, 0)
+		b = binary.BigEndian.AppendUint32(b, uint32(4+len(payload))) //nolint:gosec // short
+		b = binary.BigEndian.AppendUint32(b, kind)
+		return append(b, payload...)
+	}
+
+	var data []byte
+	data = append(data, control(2, []byte("\x00\x00\x00\x01\x00\x00\x00\x16protobuf:dnstap.Dnstap"))...)
+	data = append(data, frame(dnstapClientQuery, 1_700_000_000, 0, testQuery(t, "wiki.example", QTypeAAAA))...)
+	// Upstream queries of the resolver are not part of the client workload.
+	data = append(data, frame(3, 1_700_000_000, 1000, testQuery(t, "ns.example", QTypeA))...)
+	data = append(data, frame(dnstapClientQuery, 1_700_000_002, 500, testQuery(t, "mail.example", QTypeMX))...)
+	data = append(data, control(fstrmControlStop, nil)...)
+
+	got, err := ReadWorkload(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadWorkload() error = %v", err)
+	}
+	want := []WorkloadQuery{{Name: "wiki.example", QType: QTypeAAAA}, {Name: "mail.example", QType: QTypeMX, At: 2*time.Second + 500}}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("ReadWorkload() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParsePacing(t *testing.T) {
+	for in, want := range map[string]Pacing{"": PacingFast, "fast": PacingFast, " Original": PacingOriginal} {
+		if got, err := ParsePacing(in); err != nil || got != want {
+			t.Errorf("ParsePacing(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParsePacing("2x"); err == nil {
+		t.Errorf("ParsePacing(%q) error = nil", "2x")
+	}
+}
+
+func TestRunBenchmark_Workload(t *testing.T) {
+	workload := []WorkloadQuery{
+		{Name: "a.example", QType: QTypeA},
+		{Name: "b.example", QType: QTypeHTTPS, At: 100 * time.Millisecond},
+		{Name: "a.example", QType: QTypeAAAA, At: 200 * time.Millisecond},
+	}
+	cfg := &runConfig{Repeats: 5, MaxConcurrency: 2, LookupTimeout: 50 * time.Millisecond, Workload: workload, Pacing: PacingOriginal}
+
+	start := time.Now()
+	results, err := runBenchmark(context.Background(), cfg, []DNSServer{{Name: "dead", Addr: "127.0.0.254"}}, WorkloadNames(workload), nil)
+	if err != nil {
+		t.Fatalf("runBenchmark() error = %v", err)
+	}
+	if took := time.Since(start); took < 200*time.Millisecond {
+		t.Errorf("paced replay took %v, want at least the 200ms of the workload", took)
+	}
+	samples := results[0].Samples
+	if len(samples) != len(workload) {
+		t.Fatalf("samples = %+v, want one per workload query", samples)
+	}
+	types := map[QType]bool{}
+	for _, s := range samples {
+		types[s.QType] = true
+	}
+	if len(types) != 3 {
+		t.Errorf("sample types = %v, want A, HTTPS and AAAA", types)
+	}
+
+	bad := runConfig{Repeats: 1, MaxConcurrency: 1, LookupTimeout: time.Second, Workload: workload, Adaptive: true, TargetCI: time.Millisecond}
+	if err := bad.validate(); err == nil {
+		t.Errorf("validate() of an adaptive replay error = nil")
+	}
+}
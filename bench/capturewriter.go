@@ -0,0 +1,301 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// CaptureFormat is the file format a CaptureWriter writes.
+type CaptureFormat string
+
+const (
+	// CapturePcap writes synthesized IP packets in a pcap file with
+	// nanosecond timestamps, for Wireshark and tcpdump.
+	CapturePcap CaptureFormat = "pcap"
+	// CaptureDnstap writes a dnstap Frame Streams file with a tool query and
+	// a tool response message per exchange.
+	CaptureDnstap CaptureFormat = "dnstap"
+)
+
+const (
+	// dnstapContentType is the Frame Streams content type of dnstap.
+	dnstapContentType = "protobuf:dnstap.Dnstap"
+	fstrmControlStart = 2
+	fstrmFieldContent = 1
+
+	dnstapIdentity     = "dnsbench"
+	dnstapFieldIdent   = 1
+	dnstapFieldType    = 15
+	dnstapTypeMessage  = 1
+	dnstapToolResponse = 12
+
+	dnstapSocketFamily    = 2
+	dnstapSocketProtocol  = 3
+	dnstapQueryAddress    = 4
+	dnstapResponseAddress = 5
+	dnstapQueryPort       = 6
+	dnstapResponsePort    = 7
+	dnstapResponseSec     = 12
+	dnstapResponseNsec    = 13
+	dnstapResponseMessage = 14
+
+	// pcapSnapLen is the snap length of written pcap files; no packet is
+	// cut, but DNS messages are capped so that a packet fits in IP.
+	pcapSnapLen      = 262144
+	maxCapturedDNS   = 65535 - 40 - 20 - 2
+	captureTCPWindow = 65535
+)
+
+// CaptureWriter writes the DNS messages a run sends and receives to a pcap
+// file or a dnstap stream, each with the time it was sent or received. It is
+// safe for concurrent use. A write error is logged once and stops the
+// capture without affecting the run; Close returns it.
+type CaptureWriter struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	format CaptureFormat
+	err    error
+}
+
+// NewCaptureWriter writes the header of format to w and returns a writer for
+// the exchanges after it.
+func NewCaptureWriter(w io.Writer, format CaptureFormat) (*CaptureWriter, error) {
+	c := &CaptureWriter{w: bufio.NewWriter(w), format: format}
+	var header []byte
+	switch format {
+	case CapturePcap:
+		header = binary.LittleEndian.AppendUint32(header, pcapMagicNanos)
+		header = binary.LittleEndian.AppendUint16(header, 2)
+		header = binary.LittleEndian.AppendUint16(header, 4)
+		header = append(header, make([]byte, 8)...)
+		header = binary.LittleEndian.AppendUint32(header, pcapSnapLen)
+		header = binary.LittleEndian.AppendUint32(header, linkRaw)
+	case CaptureDnstap:
+		content := binary.BigEndian.AppendUint32(nil, fstrmFieldContent)
+		content = binary.BigEndian.AppendUint32(content, uint32(len(dnstapContentType)))
+		content = append(content, dnstapContentType...)
+		header = fstrmControl(fstrmControlStart, content)
+	default:
+		return nil, fmt.Errorf("invalid capture format %q", format)
+	}
+	c.write(header)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c, nil
+}
+
+// Close ends a dnstap stream and flushes the capture. It does not close the
+// underlying writer.
+func (c *CaptureWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.format == CaptureDnstap && c.err == nil {
+		_, c.err = c.w.Write(fstrmControl(fstrmControlStop, nil))
+	}
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	return c.err
+}
+
+// write appends data to the capture and flushes it, so that the file is
+// complete up to the last exchange if the run is killed.
+func (c *CaptureWriter) write(data ...[]byte) {
+	if c.err != nil {
+		return
+	}
+	for _, d := range data {
+		if _, err := c.w.Write(d); err != nil {
+			c.err = err
+			break
+		}
+	}
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	if c.err != nil {
+		slog.LogAttrs(context.Background(), slog.LevelWarn, "Could not write capture, continuing without it", logattr.Err(c.err))
+	}
+}
+
+// record writes one exchange on conn: query sent at sent and, unless no
+// response arrived, resp received at received.
+func (c *CaptureWriter) record(transport Transport, conn net.Conn, query []byte, sent time.Time, resp []byte, received time.Time) {
+	local, remote := addrPort(conn.LocalAddr()), addrPort(conn.RemoteAddr())
+	if !local.IsValid() || !remote.IsValid() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.format {
+	case CapturePcap:
+		c.write(pcapRecord(sent, ipPacket(transport, local, remote, query, 1, 1)))
+		if resp != nil {
+			c.write(pcapRecord(received, ipPacket(transport, remote, local, resp, 1, uint32(1+2+len(query))))) //nolint:gosec // bounded by maxMessageSize
+		}
+	case CaptureDnstap:
+		c.write(dnstapFrame(dnstapMessage(dnstapToolQuery, transport, local, remote, sent, query, time.Time{}, nil)))
+		if resp != nil {
+			c.write(dnstapFrame(dnstapMessage(dnstapToolResponse, transport, local, remote, sent, nil, received, resp)))
+		}
+	}
+}
+
+func addrPort(addr net.Addr) netip.AddrPort {
+	var ap netip.AddrPort
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ap = a.AddrPort()
+	case *net.TCPAddr:
+		ap = a.AddrPort()
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+func pcapRecord(t time.Time, packet []byte) []byte {
+	record := make([]byte, 0, 16+len(packet))
+	record = binary.LittleEndian.AppendUint32(record, uint32(t.Unix())) //nolint:gosec // pcap seconds are 32 bits until 2106
+	record = binary.LittleEndian.AppendUint32(record, uint32(t.Nanosecond()))
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(packet))) //nolint:gosec // bounded by maxCapturedDNS
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(packet))) //nolint:gosec // bounded by maxCapturedDNS
+	return append(record, packet...)
+}
+
+// ipPacket synthesizes the IP packet that carries msg from src to dst: a UDP
+// datagram, or a TCP segment with the length prefix for stream transports.
+// DNS over TLS is written as the plain DNS messages inside the TLS session.
+// Checksums are left zero.
+func ipPacket(transport Transport, src, dst netip.AddrPort, msg []byte, seq, ack uint32) []byte {
+	msg = msg[:min(len(msg), maxCapturedDNS)]
+
+	var segment []byte
+	proto := byte(17)
+	if transport == TransportUDP || transport == "" {
+		segment = binary.BigEndian.AppendUint16(segment, src.Port())
+		segment = binary.BigEndian.AppendUint16(segment, dst.Port())
+		segment = binary.BigEndian.AppendUint16(segment, uint16(8+len(msg))) //nolint:gosec // bounded by maxCapturedDNS
+		segment = append(segment, 0, 0)
+	} else {
+		proto = 6
+		segment = binary.BigEndian.AppendUint16(segment, src.Port())
+		segment = binary.BigEndian.AppendUint16(segment, dst.Port())
+		segment = binary.BigEndian.AppendUint32(segment, seq)
+		segment = binary.BigEndian.AppendUint32(segment, ack)
+		segment = append(segment, 5<<4, 0x18) // header length, PSH and ACK
+		segment = binary.BigEndian.AppendUint16(segment, captureTCPWindow)
+		segment = append(segment, 0, 0, 0, 0)
+		segment = binary.BigEndian.AppendUint16(segment, uint16(len(msg))) //nolint:gosec // bounded by maxCapturedDNS
+	}
+	payload := len(segment) + len(msg)
+
+	var packet []byte
+	if src.Addr().Is4() {
+		packet = append(packet, 0x45, 0)
+		packet = binary.BigEndian.AppendUint16(packet, uint16(20+payload)) //nolint:gosec // bounded by maxCapturedDNS
+		packet = append(packet, 0, 0, 0x40, 0, 64, proto, 0, 0)            // no ID, don't fragment, TTL 64
+		packet = append(packet, src.Addr().AsSlice()...)
+		packet = append(packet, dst.Addr().AsSlice()...)
+		binary.BigEndian.PutUint16(packet[10:], ipChecksum(packet))
+	} else {
+		packet = append(packet, 0x60, 0, 0, 0)
+		packet = binary.BigEndian.AppendUint16(packet, uint16(payload)) //nolint:gosec // bounded by maxCapturedDNS
+		packet = append(packet, proto, 64)
+		packet = append(packet, src.Addr().AsSlice()...)
+		packet = append(packet, dst.Addr().AsSlice()...)
+	}
+	packet = append(packet, segment...)
+	return append(packet, msg...)
+}
+
+// ipChecksum is the IPv4 header checksum of RFC 791.
+func ipChecksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum) //nolint:gosec // folded to 16 bits
+}
+
+// dnstapMessage encodes a dnstap Message of kind for an exchange from local
+// to remote.
+func dnstapMessage(kind uint64, transport Transport, local, remote netip.AddrPort, sent time.Time, query []byte, received time.Time, resp []byte) []byte {
+	family, protocol := uint64(1), uint64(1)
+	if local.Addr().Is6() {
+		family = 2
+	}
+	switch transport {
+	case TransportTCP:
+		protocol = 2
+	case TransportTLS:
+		protocol = 3
+	}
+
+	var m []byte
+	m = protoAppendVarint(m, dnstapMessageType, kind)
+	m = protoAppendVarint(m, dnstapSocketFamily, family)
+	m = protoAppendVarint(m, dnstapSocketProtocol, protocol)
+	m = protoAppendBytes(m, dnstapQueryAddress, local.Addr().AsSlice())
+	m = protoAppendBytes(m, dnstapResponseAddress, remote.Addr().AsSlice())
+	m = protoAppendVarint(m, dnstapQueryPort, uint64(local.Port()))
+	m = protoAppendVarint(m, dnstapResponsePort, uint64(remote.Port()))
+	m = protoAppendVarint(m, dnstapQueryTimeSec, uint64(sent.Unix())) //nolint:gosec // times after 1970
+	m = protoAppendFixed32(m, dnstapQueryTimeNsec, uint32(sent.Nanosecond()))
+	if query != nil {
+		m = protoAppendBytes(m, dnstapQueryMessage, query)
+	}
+	if resp != nil {
+		m = protoAppendVarint(m, dnstapResponseSec, uint64(received.Unix())) //nolint:gosec // times after 1970
+		m = protoAppendFixed32(m, dnstapResponseNsec, uint32(received.Nanosecond()))
+		m = protoAppendBytes(m, dnstapResponseMessage, resp)
+	}
+	return m
+}
+
+// dnstapFrame wraps a Message in a Dnstap message and a data frame.
+func dnstapFrame(message []byte) []byte {
+	var d []byte
+	d = protoAppendBytes(d, dnstapFieldIdent, []byte(dnstapIdentity))
+	d = protoAppendVarint(d, dnstapFieldType, dnstapTypeMessage)
+	d = protoAppendBytes(d, dnstapFieldMessage, message)
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(d)), uint32(len(d))) //nolint:gosec // bounded by maxMessageSize
+	return append(frame, d...)
+}
+
+// fstrmControl encodes a Frame Streams control frame.
+func fstrmControl(kind uint32, fields []byte) []byte {
+	frame := binary.BigEndian.AppendUint32(nil, 0)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(4+len(fields))) //nolint:gosec // short
+	frame = binary.BigEndian.AppendUint32(frame, kind)
+	return append(frame, fields...)
+}
+
+func protoAppendVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoWireVarint) //nolint:gosec // small field numbers
+	return binary.AppendUvarint(b, v)
+}
+
+func protoAppendFixed32(b []byte, num int, v uint32) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoWireFixed32) //nolint:gosec // small field numbers
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func protoAppendBytes(b []byte, num int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|protoWireBytes) //nolint:gosec // small field numbers
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
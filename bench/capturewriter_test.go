@@ -0,0 +1,128 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// addrConn is a connection with fixed addresses, for capturing exchanges
+// with a resolver on port 53.
+type addrConn struct {
+	net.Conn
+
+	local, remote net.Addr
+}
+
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func udpConn(local, remote string) net.Conn {
+	return addrConn{local: net.UDPAddrFromAddrPort(netip.MustParseAddrPort(local)), remote: net.UDPAddrFromAddrPort(netip.MustParseAddrPort(remote))}
+}
+
+func tcpConn(local, remote string) net.Conn {
+	return addrConn{local: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(local)), remote: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(remote))}
+}
+
+// recordExchanges captures a UDP exchange, a TCP exchange over IPv6 and a
+// UDP query without a response.
+func recordExchanges(t *testing.T, format CaptureFormat, start time.Time) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	c, err := NewCaptureWriter(&buf, format)
+	if err != nil {
+		t.Fatalf("NewCaptureWriter() error = %v", err)
+	}
+	query := testQuery(t, "example.com", QTypeA)
+	resp := append([]byte(nil), query...)
+	resp[2] |= 0x80
+
+	c.record(TransportUDP, udpConn("[::ffff:192.0.2.1]:40000", "192.0.2.53:53"), query, start, resp, start.Add(12*time.Millisecond))
+	c.record(TransportTCP, tcpConn("[2001:db8::1]:40001", "[2001:db8::53]:53"), testQuery(t, "example.org", QTypeAAAA), start.Add(time.Second), resp, start.Add(time.Second+30*time.Millisecond))
+	c.record(TransportUDP, udpConn("192.0.2.1:40002", "192.0.2.53:53"), testQuery(t, "example.net", QTypeMX), start.Add(2*time.Second), nil, time.Time{})
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCaptureWriter_Pcap(t *testing.T) {
+	start := time.Unix(1_700_000_000, 123_456_789)
+	data := recordExchanges(t, CapturePcap, start)
+
+	// Every packet but the unanswered response, each IPv4 header with a
+	// valid checksum.
+	var packets []time.Time
+	for b := data[24:]; len(b) >= 16; {
+		n := binary.LittleEndian.Uint32(b[8:])
+		packets = append(packets, time.Unix(int64(binary.LittleEndian.Uint32(b)), int64(binary.LittleEndian.Uint32(b[4:]))))
+		packet := b[16 : 16+n]
+		if packet[0] == 0x45 && ipChecksum(packet[:20]) != 0 {
+			t.Errorf("packet %d: IPv4 header checksum does not verify", len(packets))
+		}
+		b = b[16+n:]
+	}
+	if len(packets) != 5 {
+		t.Fatalf("capture has %d packets, want 5", len(packets))
+	}
+	if !packets[0].Equal(start) || packets[1].Sub(packets[0]) != 12*time.Millisecond {
+		t.Errorf("packet times = %v, want the query at %v and the response 12ms later", packets[:2], start)
+	}
+
+	got, err := ReadWorkload(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadWorkload() error = %v", err)
+	}
+	want := []WorkloadQuery{
+		{Name: "example.com", QType: QTypeA},
+		{Name: "example.org", QType: QTypeAAAA, At: time.Second},
+		{Name: "example.net", QType: QTypeMX, At: 2 * time.Second},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("ReadWorkload() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCaptureWriter_Dnstap(t *testing.T) {
+	start := time.Unix(1_700_000_000, 5)
+	data := recordExchanges(t, CaptureDnstap, start)
+
+	got, err := ReadWorkload(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadWorkload() error = %v", err)
+	}
+	if len(got) != 3 || got[1].Name != "example.org" || got[2].At != 2*time.Second {
+		t.Errorf("ReadWorkload() = %+v, want the 3 queries", got)
+	}
+
+	// The second frame is the response to the first query.
+	b := data[8+binary.BigEndian.Uint32(data[4:]):]
+	b = b[4+binary.BigEndian.Uint32(b):]
+	frame := b[4 : 4+binary.BigEndian.Uint32(b)]
+	var message []byte
+	if err := protoFields(frame, func(num int, _ uint64, data []byte) {
+		if num == dnstapFieldMessage {
+			message = data
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[int]uint64{}
+	var resp []byte
+	if err := protoFields(message, func(num int, v uint64, data []byte) {
+		fields[num] = v
+		if num == dnstapResponseMessage {
+			resp = data
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fields[dnstapMessageType] != dnstapToolResponse || fields[dnstapSocketFamily] != 1 || fields[dnstapResponsePort] != 53 ||
+		fields[dnstapResponseNsec] != 12_000_005 || len(resp) == 0 {
+		t.Errorf("response message fields = %v, response of %d bytes", fields, len(resp))
+	}
+}
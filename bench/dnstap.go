@@ -0,0 +1,157 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Frame Streams control frames, and the protobuf fields and message types
+// of dnstap.proto.
+const (
+	fstrmControlStop       = 3
+	maxDnstapControlLength = 512
+
+	dnstapFieldMessage  = 14
+	dnstapMessageType   = 1
+	dnstapQueryTimeSec  = 8
+	dnstapQueryTimeNsec = 9
+	dnstapQueryMessage  = 10
+
+	dnstapClientQuery = 5
+	dnstapStubQuery   = 9
+	dnstapToolQuery   = 11
+)
+
+// Protobuf wire types.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// readDnstap reads a Frame Streams file of dnstap messages and emits the
+// queries clients, stubs and tools sent.
+func readDnstap(r io.Reader, emit func(time.Time, []byte)) error {
+	var size [4]byte
+	for {
+		if ok, err := readFull(r, size[:]); !ok {
+			return err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			// A control frame: its length, type and fields.
+			if ok, err := readFull(r, size[:]); !ok {
+				return err
+			}
+			n = binary.BigEndian.Uint32(size[:])
+			if n < 4 || n > maxDnstapControlLength {
+				return fmt.Errorf("dnstap control frame of %d bytes", n)
+			}
+			control := make([]byte, n)
+			if ok, err := readFull(r, control); !ok {
+				return err
+			}
+			if binary.BigEndian.Uint32(control) == fstrmControlStop {
+				return nil
+			}
+			continue
+		}
+		if n > maxCaptureBlock {
+			return fmt.Errorf("dnstap frame of %d bytes", n)
+		}
+		frame := make([]byte, n)
+		if ok, err := readFull(r, frame); !ok {
+			return err
+		}
+		if err := dnstapQuery(frame, emit); err != nil {
+			return fmt.Errorf("reading dnstap frame: %w", err)
+		}
+	}
+}
+
+// dnstapQuery emits the query of a dnstap message of a client, stub or tool
+// query.
+func dnstapQuery(frame []byte, emit func(time.Time, []byte)) error {
+	var message []byte
+	err := protoFields(frame, func(num int, _ uint64, data []byte) {
+		if num == dnstapFieldMessage {
+			message = data
+		}
+	})
+	if err != nil || message == nil {
+		return err
+	}
+
+	var (
+		kind      uint64
+		sec, nsec uint64
+		query     []byte
+	)
+	err = protoFields(message, func(num int, v uint64, data []byte) {
+		switch num {
+		case dnstapMessageType:
+			kind = v
+		case dnstapQueryTimeSec:
+			sec = v
+		case dnstapQueryTimeNsec:
+			nsec = v
+		case dnstapQueryMessage:
+			query = data
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if kind == dnstapClientQuery || kind == dnstapStubQuery || kind == dnstapToolQuery {
+		emit(time.Unix(int64(sec), int64(nsec)), query) //nolint:gosec // timestamps of a capture fit
+	}
+	return nil
+}
+
+// protoFields calls fn for every field of the protobuf message b with its
+// number and either its varint or fixed value or its bytes.
+func protoFields(b []byte, fn func(num int, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("malformed protobuf field")
+		}
+		b = b[n:]
+		num := int(key >> 3) //nolint:gosec // field numbers are small
+		switch key & 7 {
+		case protoWireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("malformed protobuf varint")
+			}
+			fn(num, v, nil)
+			b = b[n:]
+		case protoWireFixed64:
+			if len(b) < 8 {
+				return errors.New("truncated protobuf field")
+			}
+			fn(num, binary.LittleEndian.Uint64(b), nil)
+			b = b[8:]
+		case protoWireFixed32:
+			if len(b) < 4 {
+				return errors.New("truncated protobuf field")
+			}
+			fn(num, uint64(binary.LittleEndian.Uint32(b)), nil)
+			b = b[4:]
+		case protoWireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errors.New("truncated protobuf field")
+			}
+			fn(num, 0, b[n:n+int(size)])
+			b = b[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+	}
+	return nil
+}
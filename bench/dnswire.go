@@ -0,0 +1,325 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// QType is the type of the records a query asks for.
+type QType uint16
+
+// Query types accepted by ParseQType.
+const (
+	QTypeA     QType = 1
+	QTypeNS    QType = 2
+	QTypeCNAME QType = 5
+	QTypeSOA   QType = 6
+	QTypePTR   QType = 12
+	QTypeMX    QType = 15
+	QTypeTXT   QType = 16
+	QTypeAAAA  QType = 28
+	QTypeSRV   QType = 33
+	QTypeSVCB  QType = 64
+	QTypeHTTPS QType = 65
+)
+
+var qtypeNames = map[QType]string{
+	QTypeA:     "A",
+	QTypeNS:    "NS",
+	QTypeCNAME: "CNAME",
+	QTypeSOA:   "SOA",
+	QTypePTR:   "PTR",
+	QTypeMX:    "MX",
+	QTypeTXT:   "TXT",
+	QTypeAAAA:  "AAAA",
+	QTypeSRV:   "SRV",
+	QTypeSVCB:  "SVCB",
+	QTypeHTTPS: "HTTPS",
+}
+
+// ParseQType parses a record type name such as "AAAA"; the empty string is
+// QTypeA.
+func ParseQType(s string) (QType, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if name == "" {
+		return QTypeA, nil
+	}
+	for t, n := range qtypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid query type %q: expected A, AAAA, CNAME, MX, NS, TXT, SOA, PTR, SRV, SVCB or HTTPS", s)
+}
+
+func (t QType) String() string {
+	if n, ok := qtypeNames[t]; ok {
+		return n
+	}
+	if t == 0 {
+		return qtypeNames[QTypeA]
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// MarshalText writes the query type by name.
+func (t QType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *QType) UnmarshalText(b []byte) error {
+	v, err := ParseQType(string(b))
+	*t = v
+	return err
+}
+
+// Response codes of RFC 1035 and RFC 2136 that resolvers return in practice.
+const (
+	RCodeSuccess  = 0
+	RCodeFormErr  = 1
+	RCodeServFail = 2
+	RCodeNXDomain = 3
+	RCodeNotImp   = 4
+	RCodeRefused  = 5
+)
+
+// RCodeName returns the mnemonic of a response code, such as "NXDOMAIN".
+func RCodeName(rcode int) string {
+	switch rcode {
+	case RCodeSuccess:
+		return "NOERROR"
+	case RCodeFormErr:
+		return "FORMERR"
+	case RCodeServFail:
+		return "SERVFAIL"
+	case RCodeNXDomain:
+		return "NXDOMAIN"
+	case RCodeNotImp:
+		return "NOTIMP"
+	case RCodeRefused:
+		return "REFUSED"
+	default:
+		return "RCODE" + strconv.Itoa(rcode)
+	}
+}
+
+// RCodeError is returned when a resolver answers with an error response code.
+type RCodeError struct {
+	RCode int
+}
+
+func (e *RCodeError) Error() string {
+	return "server answered " + RCodeName(e.RCode)
+}
+
+// ednsUDPSize is the UDP payload size advertised with EDNS(0), the size
+// recommended by DNS Flag Day 2020 to avoid fragmentation.
+const ednsUDPSize = 1232
+
+// maxMessageSize is the largest DNS message, bounded by the two-byte length
+// prefix on streams and the UDP datagram size.
+const maxMessageSize = 65535
+
+var errMalformed = errors.New("malformed DNS response")
+
+// buildQuery encodes a recursive query for name with an EDNS(0) OPT record.
+func buildQuery(id uint16, name string, qtype QType) ([]byte, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil || qname.Length == 1 {
+		return nil, fmt.Errorf("invalid domain name %q", name)
+	}
+	b := dnsmessage.NewBuilder(make([]byte, 0, 12+int(qname.Length)+4+11), dnsmessage.Header{ID: id, RecursionDesired: true})
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: dnsmessage.Type(qtype), Class: dnsmessage.ClassINET}); err != nil {
+		return nil, fmt.Errorf("invalid domain name %q: %w", name, err)
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// response is what a benchmark needs to know about an answer.
+type response struct {
+	rcode     int
+	answers   int // all records in the answer section
+	matching  int // answer records of the queried type
+	truncated bool
+}
+
+// parseResponse decodes the header and answer section of msg, the response
+// to the query with id for qtype.
+func parseResponse(msg []byte, id uint16, qtype QType) (response, error) {
+	var r response
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return r, fmt.Errorf("%w: %w", errMalformed, err)
+	}
+	if h.ID != id || !h.Response {
+		return r, errMalformed
+	}
+	r.rcode = int(h.RCode)
+	r.truncated = h.Truncated
+	if r.truncated {
+		// The records are incomplete; the query is repeated over TCP.
+		return r, nil
+	}
+
+	if err := p.SkipAllQuestions(); err != nil {
+		return r, fmt.Errorf("%w: %w", errMalformed, err)
+	}
+	for {
+		rr, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return r, nil
+		}
+		if err == nil {
+			err = p.SkipAnswer()
+		}
+		if err != nil {
+			return r, fmt.Errorf("%w: %w", errMalformed, err)
+		}
+		r.answers++
+		if QType(rr.Type) == qtype {
+			r.matching++
+		}
+	}
+}
+
+// exchange sends query over conn and returns the response with a matching
+// ID. Stream connections use the two-byte length prefix of RFC 1035.
+func exchange(conn net.Conn, stream bool, query []byte) ([]byte, error) {
+	id := binary.BigEndian.Uint16(query)
+	if stream {
+		framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query))) //nolint:gosec // queries are short
+		if _, err := conn.Write(append(framed, query...)); err != nil {
+			return nil, err
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	// Relayed queries may advertise a larger EDNS(0) size than our own.
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Late answers to earlier attempts are ignored; the read deadline
+		// bounds the wait.
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+// question is the first question of a query.
+type question struct {
+	name   string
+	qtype  QType
+	header dnsmessage.Header
+	q      dnsmessage.Question
+}
+
+// parseQuestion decodes the first question of a query received from a client.
+func parseQuestion(msg []byte) (question, error) {
+	var q question
+	var p dnsmessage.Parser
+	var err error
+	if q.header, err = p.Start(msg); err != nil {
+		return q, fmt.Errorf("%w: %w", errMalformed, err)
+	}
+	if q.q, err = p.Question(); err != nil {
+		return q, fmt.Errorf("%w: %w", errMalformed, err)
+	}
+	q.name = strings.TrimSuffix(q.q.Name.String(), ".")
+	q.qtype = QType(q.q.Type)
+	return q, nil
+}
+
+// udpSize returns the largest UDP response the sender of query accepts: the
+// size of its EDNS(0) OPT record, or 512 bytes without one.
+func udpSize(query []byte) int {
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err != nil {
+		return 512
+	}
+	if p.SkipAllQuestions() != nil || p.SkipAllAnswers() != nil || p.SkipAllAuthorities() != nil {
+		return 512
+	}
+	for {
+		rr, err := p.AdditionalHeader()
+		if err != nil {
+			return 512
+		}
+		if rr.Type == dnsmessage.TypeOPT {
+			return max(int(rr.Class), 512)
+		}
+		if p.SkipAdditional() != nil {
+			return 512
+		}
+	}
+}
+
+// reply returns a response to the query q without records: the question
+// with the opcode and RD of the query, the TC bit and rcode.
+func reply(q question, tc bool, rcode dnsmessage.RCode) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 q.header.ID,
+		Response:           true,
+		OpCode:             q.header.OpCode,
+		Truncated:          tc,
+		RecursionDesired:   q.header.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	// The question was parsed from a valid message, so it packs again.
+	_ = b.StartQuestions() //nolint:errcheck // see above
+	_ = b.Question(q.q)    //nolint:errcheck // see above
+	msg, _ := b.Finish()   //nolint:errcheck // see above
+	return msg
+}
+
+// truncated returns the truncated form of resp, a response to q, for a UDP
+// client that cannot take all of it.
+func truncated(resp []byte, q question) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return serverFailure(q)
+	}
+	return reply(q, true, h.RCode)
+}
+
+// serverFailure returns the SERVFAIL response to the query q.
+func serverFailure(q question) []byte {
+	return reply(q, false, dnsmessage.RCodeServerFailure)
+}
@@ -0,0 +1,100 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestParseQType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    QType
+		wantErr bool
+	}{
+		{in: "", want: QTypeA},
+		{in: "a", want: QTypeA},
+		{in: " AAAA ", want: QTypeAAAA},
+		{in: "https", want: QTypeHTTPS},
+		{in: "ANY", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseQType(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQType(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQType(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// answer turns query into a response with rcode and one record of each type
+// in rrtypes, named by a pointer to the question.
+func answer(query []byte, rcode int, truncated bool, rrtypes ...QType) []byte {
+	msg := append([]byte(nil), query...)
+	flags := uint16(1<<15|1<<8|1<<7) | uint16(rcode) //nolint:gosec // test codes are small
+	if truncated {
+		flags |= 1 << 9
+	}
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(rrtypes))) //nolint:gosec // a few records
+	binary.BigEndian.PutUint16(msg[10:], 0)
+	msg = msg[:len(query)-11] // drop the OPT record
+	for _, t := range rrtypes {
+		msg = append(msg, 0xc0, 12)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(t))
+		msg = binary.BigEndian.AppendUint16(msg, 1)
+		msg = append(msg, 0, 0, 0, 60)
+		msg = binary.BigEndian.AppendUint16(msg, 4)
+		msg = append(msg, 192, 0, 2, 1)
+	}
+	return msg
+}
+
+func TestParseResponse(t *testing.T) {
+	query, err := buildQuery(0x1234, "www.example.com.", QTypeA)
+	if err != nil {
+		t.Fatalf("buildQuery() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    response
+		wantErr bool
+	}{
+		{name: "Answer", msg: answer(query, RCodeSuccess, false, QTypeCNAME, QTypeA, QTypeA), want: response{answers: 3, matching: 2}},
+		{name: "NXDOMAIN", msg: answer(query, RCodeNXDomain, false), want: response{rcode: RCodeNXDomain}},
+		{name: "Truncated", msg: answer(query, RCodeSuccess, true), want: response{truncated: true}},
+		{name: "Cut short", msg: answer(query, RCodeSuccess, false, QTypeA)[:len(query)], wantErr: true},
+		{name: "Query", msg: query, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResponse(tt.msg, 0x1234, QTypeA)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseResponse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseResponse(answer(query, RCodeSuccess, false), 0x4321, QTypeA); !errors.Is(err, errMalformed) {
+		t.Errorf("parseResponse() with another ID error = %v, want %v", err, errMalformed)
+	}
+}
+
+func TestBuildQuery_InvalidName(t *testing.T) {
+	for _, name := range []string{"a..b", string(make([]byte, 64)) + ".com"} {
+		if _, err := buildQuery(1, name, QTypeA); err == nil {
+			t.Errorf("buildQuery(%q) error = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package bench
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// probeConcurrency bounds how many resolvers are probed at once.
+const probeConcurrency = 32
+
+// ProbeResolvers sends a quick query for domain to every server in parallel
+// and returns the reason each unreachable server failed, keyed by
+// DNSServer.Endpoint.
+// A server that answers with an error such as NXDOMAIN is reachable.
+func ProbeResolvers(ctx context.Context, servers []DNSServer, domain string, timeout time.Duration) map[string]string {
+	var (
+		mu          sync.Mutex
+		unreachable = make(map[string]string)
+	)
+
+	policy := RetryPolicy{Retries: 1, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+
+	errg, ctx := errgroup.WithContext(ctx)
+	errg.SetLimit(probeConcurrency)
+
+	for _, server := range servers {
+		errg.Go(func() error {
+			resolver := NewServerResolver(server, 1)
+			_, err := resolver.QueryDNS(ctx, domain, timeout, policy)
+			if err == nil || isAnswered(err) || ctx.Err() != nil {
+				return nil
+			}
+
+			slog.LogAttrs(ctx, slog.LevelWarn, "Resolver failed pre-flight probe",
+				slog.String("name", server.Name),
+				slog.String("addr", server.Addr),
+				logattr.Err(err),
+			)
+
+			mu.Lock()
+			unreachable[server.Endpoint()] = fmt.Sprintf("unreachable in pre-flight probe: %s", probeErrorClass(err))
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := errg.Wait(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "Unexpected probe error", logattr.Err(err))
+	}
+	return unreachable
+}
+
+// isAnswered reports whether err came from a resolver that did respond.
+func isAnswered(err error) bool {
+	var rcodeErr *RCodeError
+	return errors.Is(err, ErrNoAddresses) || (errors.As(err, &rcodeErr) && rcodeErr.RCode == RCodeNXDomain)
+}
+
+func probeErrorClass(err error) string {
+	var (
+		rcodeErr *RCodeError
+		opErr    *net.OpError
+	)
+	switch {
+	case ErrorClass(err) == "timeout":
+		return "timeout"
+	case errors.As(err, &rcodeErr):
+		return rcodeErr.Error()
+	case errors.As(err, &opErr):
+		return opErr.Error()
+	default:
+		return err.Error()
+	}
+}
+
+// ErrorClass sorts the error of a query into a short class for analysis:
+// "timeout", an error response code such as "NXDOMAIN" or "SERVFAIL",
+// "nodata" for an answer without records of the queried type, "refused"
+// when the connection was refused, "tls", "network", "canceled", "malformed"
+// or "other". It returns "" for nil.
+func ErrorClass(err error) string {
+	var (
+		rcodeErr *RCodeError
+		certErr  *tls.CertificateVerificationError
+		alertErr tls.AlertError
+		netErr   net.Error
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &rcodeErr):
+		return RCodeName(rcodeErr.RCode)
+	case errors.Is(err, ErrNoAddresses):
+		return "nodata"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, errMalformed):
+		return "malformed"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.As(err, &certErr), errors.As(err, &alertErr):
+		return "tls"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
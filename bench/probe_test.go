@@ -0,0 +1,72 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeResolvers_MarksUnreachable(t *testing.T) {
+	// Nothing listens on port 53 here, so the probe must fail.
+	servers := []DNSServer{{Name: "nowhere", Addr: "127.0.0.254"}}
+
+	unreachable := ProbeResolvers(context.Background(), servers, "example.com", 200*time.Millisecond)
+
+	reason, ok := unreachable["127.0.0.254"]
+	if !ok {
+		t.Fatalf("ProbeResolvers() did not mark 127.0.0.254 unreachable")
+	}
+	if !strings.HasPrefix(reason, "unreachable in pre-flight probe") {
+		t.Errorf("ProbeResolvers() reason = %q", reason)
+	}
+}
+
+func TestIsAnswered(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "NXDOMAIN", err: fmt.Errorf("query: %w", &RCodeError{RCode: RCodeNXDomain}), want: true},
+		{name: "Empty answer", err: fmt.Errorf("query: %w", ErrNoAddresses), want: true},
+		{name: "SERVFAIL", err: &RCodeError{RCode: RCodeServFail}, want: false},
+		{name: "Timeout", err: context.DeadlineExceeded, want: false},
+		{name: "Other", err: errors.New("connection refused"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAnswered(tt.err); got != tt.want {
+				t.Errorf("isAnswered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "None", err: nil, want: ""},
+		{name: "Timeout", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: "timeout"},
+		{name: "NXDOMAIN", err: fmt.Errorf("query: %w", &RCodeError{RCode: RCodeNXDomain}), want: "NXDOMAIN"},
+		{name: "SERVFAIL", err: &RCodeError{RCode: RCodeServFail}, want: "SERVFAIL"},
+		{name: "No data", err: fmt.Errorf("query: %w", ErrNoAddresses), want: "nodata"},
+		{name: "Canceled", err: context.Canceled, want: "canceled"},
+		{name: "Malformed", err: errMalformed, want: "malformed"},
+		{name: "Other", err: errors.New("boom"), want: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorClass(tt.err); got != tt.want {
+				t.Errorf("ErrorClass() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
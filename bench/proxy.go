@@ -0,0 +1,416 @@
+package bench
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// ProxyMode selects the upstreams a proxied query is sent to.
+type ProxyMode string
+
+const (
+	// ProxyRace sends every query to all upstreams and answers with the
+	// first response.
+	ProxyRace ProxyMode = "race"
+	// ProxyRoundRobin sends each query to the next upstream in turn.
+	ProxyRoundRobin ProxyMode = "round-robin"
+	// ProxyFastest sends queries to the upstream with the lowest median
+	// latency over its recent queries, and every proxyExploreEvery-th query
+	// to the next upstream in turn so that the others stay measured.
+	ProxyFastest ProxyMode = "fastest"
+)
+
+// ParseProxyMode parses a proxy mode; the empty string is ProxyFastest.
+func ParseProxyMode(s string) (ProxyMode, error) {
+	switch m := ProxyMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ProxyFastest, nil
+	case ProxyRace, ProxyRoundRobin, ProxyFastest:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid proxy mode %q: expected race, round-robin or fastest", s)
+	}
+}
+
+const (
+	// ProxyWindow is how many recent samples are kept per upstream.
+	ProxyWindow = 10000
+	// proxyMinSamples is how many samples an upstream needs before the
+	// fastest mode compares it with the others.
+	proxyMinSamples = 5
+	// proxyRecent is how many recent samples the fastest mode compares.
+	proxyRecent = 200
+	// proxyExploreEvery is how often the fastest mode picks the next
+	// upstream in turn instead of the fastest one.
+	proxyExploreEvery = 10
+	// proxyIdleTimeout closes TCP client connections without queries.
+	proxyIdleTimeout = 10 * time.Second
+)
+
+// Proxy forwards DNS queries from local clients to upstream resolvers and
+// measures every upstream on the live traffic. Failed upstreams are skipped
+// in favour of the next one; a query no upstream answers gets SERVFAIL.
+type Proxy struct {
+	config    runConfig
+	mode      ProxyMode
+	upstreams []*upstream
+	queries   atomic.Uint64
+
+	// inflight bounds the client queries handled at once, and legs the
+	// upstream queries of race mode, to what the upstreams take at their
+	// concurrency; further UDP queries wait in the socket buffer.
+	inflight chan struct{}
+	legs     chan struct{}
+
+	reportMu sync.Mutex
+	sampler  SampleReporter
+}
+
+type upstream struct {
+	resolver *Resolver
+
+	mu      sync.Mutex
+	samples []Sample
+}
+
+// NewProxy returns a Proxy for servers in mode. Of the options, the timeout,
+// concurrency (per upstream, which also bounds the queries handled at once),
+// score weights, reporter and capture apply.
+func NewProxy(servers []DNSServer, mode ProxyMode, opts ...Option) (*Proxy, error) {
+	config := defaultRunConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("no upstream resolvers")
+	}
+
+	slots := config.MaxConcurrency * len(servers)
+	p := &Proxy{config: config, mode: mode, inflight: make(chan struct{}, slots), legs: make(chan struct{}, slots)}
+	p.sampler, _ = config.Reporter.(SampleReporter)
+	for _, server := range servers {
+		resolver := NewServerResolver(server, config.MaxConcurrency)
+		resolver.capture = config.Capture
+		p.upstreams = append(p.upstreams, &upstream{resolver: resolver})
+	}
+	return p, nil
+}
+
+// Serve answers queries on addr over UDP and TCP until ctx is done.
+func (p *Proxy) Serve(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	ln, err := lc.Listen(ctx, "tcp", pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close() //nolint:errcheck // already failing
+		return err
+	}
+	return p.serve(ctx, pc, ln)
+}
+
+func (p *Proxy) serve(ctx context.Context, pc net.PacketConn, ln net.Listener) error {
+	slog.LogAttrs(ctx, slog.LevelInfo, "Proxy listening",
+		slog.String("addr", pc.LocalAddr().String()),
+		slog.String("mode", string(p.mode)),
+		slog.Int("upstreams", len(p.upstreams)),
+	)
+	stop := context.AfterFunc(ctx, func() {
+		_ = pc.Close() //nolint:errcheck // shutting down
+		_ = ln.Close() //nolint:errcheck // shutting down
+	})
+	defer stop()
+
+	errg := &errgroup.Group{}
+	errg.Go(func() error { return p.serveUDP(ctx, pc) })
+	errg.Go(func() error { return p.serveTCP(ctx, ln) })
+	err := errg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (p *Proxy) serveUDP(ctx context.Context, pc net.PacketConn) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		select {
+		case p.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		n, client, err := pc.ReadFrom(buf)
+		if err != nil {
+			<-p.inflight
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer func() { <-p.inflight }()
+			if resp := p.handle(ctx, query, false); resp != nil {
+				_, _ = pc.WriteTo(resp, client) //nolint:errcheck // the client retries
+			}
+		}()
+	}
+}
+
+func (p *Proxy) serveTCP(ctx context.Context, ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go p.serveConn(ctx, conn)
+	}
+}
+
+// serveConn answers the length-prefixed queries of one TCP client in turn.
+func (p *Proxy) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close() //nolint:errcheck // client connection
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() }) //nolint:errcheck // shutting down
+	defer stop()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(proxyIdleTimeout)) //nolint:errcheck // fails only on closed connections
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		select {
+		case p.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		resp := p.handle(ctx, query, true)
+		<-p.inflight
+		if resp == nil {
+			return
+		}
+		framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(resp)), uint16(len(resp))) //nolint:gosec // bounded by maxMessageSize
+		if _, err := conn.Write(append(framed, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// handle forwards query and returns the response for the client, or nil
+// when the query cannot be parsed.
+func (p *Proxy) handle(ctx context.Context, query []byte, stream bool) []byte {
+	q, err := parseQuestion(query)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelDebug, "Dropping malformed query", logattr.Err(err))
+		return nil
+	}
+
+	var resp []byte
+	if p.mode == ProxyRace {
+		resp = p.race(ctx, query, q)
+	} else {
+		for _, u := range p.order() {
+			msg, err := p.forward(ctx, u, query, q)
+			if err == nil {
+				resp = msg
+				break
+			}
+		}
+	}
+
+	switch {
+	case resp == nil:
+		return serverFailure(q)
+	case !stream && len(resp) > udpSize(query):
+		return truncated(resp, q)
+	default:
+		// The upstream answered our copy of the query, which has the ID of
+		// the client's.
+		return resp
+	}
+}
+
+// race sends query to every upstream and returns the first response. The
+// slower upstreams are still measured.
+func (p *Proxy) race(ctx context.Context, query []byte, q question) []byte {
+	answers := make(chan []byte, len(p.upstreams))
+	for _, u := range p.upstreams {
+		// The slower legs outlive the query; waiting for a slot keeps them
+		// from piling up behind a slow upstream.
+		select {
+		case p.legs <- struct{}{}:
+		case <-ctx.Done():
+			answers <- nil
+			continue
+		}
+		go func() {
+			defer func() { <-p.legs }()
+			msg, err := p.forward(context.WithoutCancel(ctx), u, query, q)
+			if err != nil {
+				msg = nil
+			}
+			answers <- msg
+		}()
+	}
+	for range p.upstreams {
+		if msg := <-answers; msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+// order returns the upstreams to try for the next query, first choice first.
+func (p *Proxy) order() []*upstream {
+	n := p.queries.Add(1) - 1
+	rotated := func(turn uint64) []*upstream {
+		i := int(turn % uint64(len(p.upstreams)))
+		return append(slices.Clone(p.upstreams[i:]), p.upstreams[:i]...)
+	}
+	switch {
+	case p.mode == ProxyRoundRobin:
+		return rotated(n)
+	case n%proxyExploreEvery == 0:
+		return rotated(n / proxyExploreEvery)
+	}
+
+	type ranked struct {
+		u       *upstream
+		samples int
+		median  float64
+	}
+	list := make([]ranked, 0, len(p.upstreams))
+	for _, u := range rotated(n) {
+		samples, median := u.median()
+		list = append(list, ranked{u: u, samples: samples, median: median})
+	}
+	// Upstreams that are not measured yet come first, then the fastest.
+	slices.SortStableFunc(list, func(a, b ranked) int {
+		return cmp.Or(
+			cmp.Compare(min(a.samples, proxyMinSamples), min(b.samples, proxyMinSamples)),
+			cmp.Compare(a.median, b.median),
+		)
+	})
+	order := make([]*upstream, 0, len(list))
+	for _, r := range list {
+		order = append(order, r.u)
+	}
+	return order
+}
+
+// forward sends query to u within the query timeout and records the sample.
+// Error response codes other than NXDOMAIN count as failures.
+func (p *Proxy) forward(ctx context.Context, u *upstream, query []byte, q question) ([]byte, error) {
+	r := u.resolver
+	r.sem <- struct{}{}
+	defer func() { <-r.sem }()
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.LookupTimeout)
+	defer cancel()
+	start := time.Now()
+	msg, resp, err := r.send(ctx, query, q.qtype)
+	took := time.Since(start)
+	if err == nil && resp.rcode != RCodeSuccess && resp.rcode != RCodeNXDomain {
+		err = &RCodeError{RCode: resp.rcode}
+	}
+
+	sample := Sample{
+		Domain:   q.name,
+		QType:    q.qtype,
+		Total:    took.Seconds() * 1000,
+		Attempts: 1,
+	}
+	if msg != nil {
+		sample.RCode, sample.Answers = RCodeName(resp.rcode), resp.answers
+	}
+	if err != nil {
+		err = fmt.Errorf("proxied query for %s via %s: %w", q.name, r.serverAddr, err)
+		sample.Error, sample.ErrorClass = err.Error(), ErrorClass(err)
+	} else {
+		sample.Latency = sample.Total
+	}
+	u.record(sample)
+	p.report(r.server, sample, err)
+	return msg, err
+}
+
+func (p *Proxy) report(server DNSServer, sample Sample, err error) {
+	p.reportMu.Lock()
+	defer p.reportMu.Unlock()
+	p.config.Reporter.OnQueryResult(server, sample.Domain, sample.Latency, err)
+	if p.sampler != nil {
+		p.sampler.OnSample(server, sample)
+	}
+}
+
+func (u *upstream) record(sample Sample) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.samples) == ProxyWindow {
+		u.samples = slices.Delete(u.samples, 0, ProxyWindow/10)
+	}
+	u.samples = append(u.samples, sample)
+}
+
+// median returns the number of samples of u and the median latency of the
+// most recent ones, +Inf without successful samples.
+func (u *upstream) median() (int, float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	latencies := successfulLatencies(u.samples[max(len(u.samples)-proxyRecent, 0):])
+	if len(latencies) == 0 {
+		return len(u.samples), math.Inf(1)
+	}
+	return len(u.samples), median(latencies)
+}
+
+// Results summarizes and scores the recent samples of every upstream, in the
+// order the upstreams were given.
+func (p *Proxy) Results() []BenchmarkResult {
+	results := make([]BenchmarkResult, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		u.mu.Lock()
+		samples := slices.Clone(u.samples)
+		u.mu.Unlock()
+		result := BenchmarkResult{
+			Server:  u.resolver.server,
+			Stats:   SummarizeSamples(samples),
+			Samples: samples,
+		}
+		if len(samples) == 0 {
+			result.Failure = "no proxied queries yet"
+		}
+		results = append(results, result)
+	}
+	scoreResults(results, p.config.ScoreWeights)
+	return results
+}
@@ -0,0 +1,192 @@
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseProxyMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ProxyMode
+		wantErr bool
+	}{
+		{in: "", want: ProxyFastest},
+		{in: "race", want: ProxyRace},
+		{in: " Round-Robin ", want: ProxyRoundRobin},
+		{in: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseProxyMode(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProxyMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseProxyMode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuestion(t *testing.T) {
+	query, err := buildQuery(7, "www.example.com", QTypeAAAA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := parseQuestion(query)
+	if err != nil {
+		t.Fatalf("parseQuestion() error = %v", err)
+	}
+	if q.name != "www.example.com" || q.qtype != QTypeAAAA || q.header.ID != 7 || !q.header.RecursionDesired {
+		t.Errorf("parseQuestion() = %+v", q)
+	}
+	if got := udpSize(query); got != ednsUDPSize {
+		t.Errorf("udpSize() = %d, want %d", got, ednsUDPSize)
+	}
+	plain, err := (&dnsmessage.Message{Header: q.header, Questions: []dnsmessage.Question{q.q}}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := udpSize(plain); got != 512 {
+		t.Errorf("udpSize() without EDNS = %d, want 512", got)
+	}
+	if _, err := parseQuestion(query[:14]); err == nil {
+		t.Errorf("parseQuestion() of a cut query error = nil")
+	}
+
+	fail, err := parseResponse(serverFailure(q), 7, QTypeAAAA)
+	if err != nil || fail.rcode != RCodeServFail {
+		t.Errorf("serverFailure() = %+v, %v, want SERVFAIL", fail, err)
+	}
+	cut, err := parseResponse(truncated(answer(query, RCodeSuccess, false, QTypeAAAA), q), 7, QTypeAAAA)
+	if err != nil || !cut.truncated || cut.answers != 0 {
+		t.Errorf("truncated() = %+v, %v, want TC without records", cut, err)
+	}
+}
+
+func TestProxy_Order(t *testing.T) {
+	servers := []DNSServer{{Name: "slow", Addr: "192.0.2.1"}, {Name: "fast", Addr: "192.0.2.2"}, {Name: "new", Addr: "192.0.2.3"}}
+	p, err := NewProxy(servers, ProxyFastest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range proxyMinSamples {
+		p.upstreams[0].record(Sample{Latency: 30, Attempts: 1})
+		p.upstreams[1].record(Sample{Latency: 10, Attempts: 1})
+	}
+
+	p.queries.Store(1)
+	if got := p.order(); got[0] != p.upstreams[2] {
+		t.Errorf("order()[0] = %s, want the unmeasured upstream", got[0].resolver.server.Name)
+	}
+	for range proxyMinSamples {
+		p.upstreams[2].record(Sample{Attempts: 1, Error: "timeout"})
+	}
+	if got := p.order(); got[0] != p.upstreams[1] || got[2] != p.upstreams[2] {
+		t.Errorf("order() = %s, %s, %s, want fast first and the failing one last",
+			got[0].resolver.server.Name, got[1].resolver.server.Name, got[2].resolver.server.Name)
+	}
+	if _, m := p.upstreams[2].median(); !math.IsInf(m, 1) {
+		t.Errorf("median() without answers = %v, want +Inf", m)
+	}
+}
+
+func TestProxy_ServesFailure(t *testing.T) {
+	// Nothing listens on port 53 of the upstream, so the client gets SERVFAIL.
+	p, err := NewProxy([]DNSServer{{Name: "nowhere", Addr: "127.0.0.254"}}, ProxyRoundRobin, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.serve(ctx, pc, ln) }()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	query, _ := buildQuery(0x4242, "example.com", QTypeA)
+	msg, err := exchange(conn, false, query)
+	if err != nil {
+		t.Fatalf("exchange() error = %v", err)
+	}
+	if rcode := binary.BigEndian.Uint16(msg[2:]) & 0xf; rcode != RCodeServFail {
+		t.Errorf("rcode = %d, want SERVFAIL", rcode)
+	}
+
+	results := p.Results()
+	if len(results) != 1 || results[0].Stats.Total != 1 || results[0].Samples[0].ErrorClass != "refused" {
+		t.Errorf("Results() = %+v, want one refused query", results)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("serve() error = %v", err)
+	}
+}
+
+func TestProxy_BoundsQueriesInFlight(t *testing.T) {
+	p, err := NewProxy([]DNSServer{{Name: "nowhere", Addr: "127.0.0.254"}}, ProxyRace, WithTimeout(time.Second), WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(p.inflight) != 1 || cap(p.legs) != 1 {
+		t.Fatalf("slots = %d, %d, want 1 per upstream", cap(p.inflight), cap(p.legs))
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = p.serve(ctx, pc, ln) }() //nolint:errcheck // test
+
+	// With the only slot taken, the query waits in the socket buffer.
+	p.inflight <- struct{}{}
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	query, _ := buildQuery(0x4242, "example.com", QTypeA)
+	if _, err := conn.Write(query); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(buf); err == nil {
+		t.Fatal("proxy answered without a free slot")
+	}
+
+	<-p.inflight
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() after freeing the slot error = %v", err)
+	}
+	if rcode := binary.BigEndian.Uint16(buf[2:n]) & 0xf; rcode != RCodeServFail {
+		t.Errorf("rcode = %d, want SERVFAIL", rcode)
+	}
+}
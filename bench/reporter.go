@@ -0,0 +1,47 @@
+package bench
+
+import (
+	"time"
+)
+
+// BenchmarkReporter provides hooks during benchmark execution. Callbacks are
+// never made concurrently, so implementations need no locking of their own.
+type BenchmarkReporter interface {
+	OnStart(totalResolvers int, domains []string)
+	OnResolverStart(server DNSServer, index, total int)
+	OnWarmupDone(server DNSServer, cold Stats)
+	OnQueryResult(server DNSServer, domain string, latencyMs float64, err error)
+	OnProgress(server DNSServer, progress Progress)
+	OnResolverDone(server DNSServer, stats Stats, took time.Duration)
+	OnComplete(results []BenchmarkResult, err error)
+}
+
+// SampleReporter is implemented by reporters that also record raw samples,
+// for example to checkpoint a run. OnSample is called for every measured
+// query and OnResolverResult once a resolver is complete; a resolver that was
+// interrupted by cancellation never gets OnResolverResult.
+type SampleReporter interface {
+	OnSample(server DNSServer, sample Sample)
+	OnResolverResult(result BenchmarkResult)
+}
+
+// Progress reports how far a time- or budget-bound resolver run has come.
+type Progress struct {
+	Done int `json:"done"`
+	// Total is the query budget, or 0 when only a time window applies.
+	Total int `json:"total"`
+	// RemainingMs is the time left for this resolver, RunRemainingMs for the whole run.
+	RemainingMs    int64 `json:"remainingMs"`
+	RunRemainingMs int64 `json:"runRemainingMs"`
+}
+
+// NoopReporter is used when no callbacks are needed.
+type NoopReporter struct{}
+
+func (NoopReporter) OnStart(_ int, _ []string)                               {}
+func (NoopReporter) OnResolverStart(_ DNSServer, _, _ int)                   {}
+func (NoopReporter) OnWarmupDone(_ DNSServer, _ Stats)                       {}
+func (NoopReporter) OnQueryResult(_ DNSServer, _ string, _ float64, _ error) {}
+func (NoopReporter) OnProgress(_ DNSServer, _ Progress)                      {}
+func (NoopReporter) OnResolverDone(_ DNSServer, _ Stats, _ time.Duration)    {}
+func (NoopReporter) OnComplete(_ []BenchmarkResult, _ error)                 {}
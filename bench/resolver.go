@@ -0,0 +1,299 @@
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// ErrNoAddresses is returned when a resolver answers without any addresses.
+var ErrNoAddresses = errors.New("no addresses found")
+
+// RetryPolicy controls how a failed query is retried.
+type RetryPolicy struct {
+	// Retries is the number of additional attempts after the first one.
+	Retries        int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Validate reports whether the policy is usable. Backoffs only matter when
+// there are retries.
+func (p RetryPolicy) Validate() error {
+	if p.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+	if p.Retries == 0 {
+		return nil
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	if p.InitialBackoff > p.MaxBackoff {
+		return errors.New("backoff must not exceed max backoff")
+	}
+	return nil
+}
+
+// NoRetry performs exactly one attempt per query.
+var NoRetry = RetryPolicy{}
+
+// QueryResult describes a single logical query, including its retries.
+type QueryResult struct {
+	// Latency is the duration of the final attempt.
+	Latency time.Duration
+	// Total is the wall time spent on the query, including failed attempts and backoff.
+	Total time.Duration
+	// Attempts is the number of attempts made, at least 1.
+	Attempts int
+	// RCode is the response code of the final attempt, such as "NOERROR" or
+	// "NXDOMAIN", and Answers the number of records in its answer section.
+	// RCode is empty when no response arrived.
+	RCode   string
+	Answers int
+}
+
+// DNS clients a run can be measured with, as recorded in its manifest.
+const (
+	// ClientWire sends one query of the configured record type, with
+	// EDNS(0), and times it until its response arrives.
+	ClientWire = "wire"
+	// ClientGoResolver is how dnsbench measured before ClientWire: a host
+	// lookup through Go's resolver, which sends an A and an AAAA query and
+	// waits for both, so a latency is the slower of the two.
+	ClientGoResolver = "go-resolver"
+)
+
+// Resolver sends queries to a single DNS server, limiting how many are in
+// flight at once. It measures with ClientWire.
+type Resolver struct {
+	server      DNSServer
+	serverAddr  string
+	qtype       QType
+	concurrency int
+	sem         chan struct{}
+
+	// rng drives the retry backoff jitter once seeded; nil uses the global
+	// source.
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	// capture receives every exchange when set.
+	capture *CaptureWriter
+
+	// dial connects to the server; tests replace it with a fake transport.
+	dial func(ctx context.Context, server DNSServer, transport Transport) (net.Conn, bool, error)
+}
+
+// NewResolver returns a Resolver for the IP address serverAddr, queried over
+// UDP, that runs at most concurrency queries at a time.
+func NewResolver(serverAddr string, concurrency int) *Resolver {
+	return NewServerResolver(DNSServer{Addr: serverAddr}, concurrency)
+}
+
+// NewServerResolver returns a Resolver for server over its transport that
+// runs at most concurrency queries at a time.
+func NewServerResolver(server DNSServer, concurrency int) *Resolver {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Resolver{
+		server:      server,
+		serverAddr:  server.Endpoint(),
+		qtype:       QTypeA,
+		concurrency: concurrency,
+		sem:         make(chan struct{}, concurrency),
+		dial:        dial,
+	}
+}
+
+// seed makes the retry backoff jitter of r reproducible. Resolvers seeded
+// with the same value still draw different sequences.
+func (r *Resolver) seed(seed uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(r.serverAddr)) //nolint:errcheck // hash writes never fail
+	//nolint:gosec // jitter timing here is non-security critical
+	r.rng = rand.New(rand.NewPCG(seed, h.Sum64()))
+}
+
+// jitter returns a random duration in [0, d).
+func (r *Resolver) jitter(d time.Duration) time.Duration {
+	if r.rng == nil {
+		//nolint:gosec // jitter timing here is non-security critical
+		return rand.N(d)
+	}
+	r.rngMu.Lock()
+	defer r.rngMu.Unlock()
+	return time.Duration(r.rng.Int64N(int64(d)))
+}
+
+// SetQType sets the type of the records queried; zero means QTypeA, the
+// default.
+func (r *Resolver) SetQType(qtype QType) {
+	if qtype == 0 {
+		qtype = QTypeA
+	}
+	r.qtype = qtype
+}
+
+// QueryDNS resolves domain, making up to retry.Retries+1 attempts of at most
+// timeout each. The returned QueryResult is filled in even when all attempts fail.
+func (r *Resolver) QueryDNS(ctx context.Context, domain string, timeout time.Duration, retry RetryPolicy) (QueryResult, error) {
+	return r.query(ctx, domain, r.qtype, false, timeout, retry)
+}
+
+// query is QueryDNS for records of qtype. With anyAnswer, NXDOMAIN and
+// answers without records of qtype count as successful, as they do for the
+// client that sent a recorded query.
+func (r *Resolver) query(ctx context.Context, domain string, qtype QType, anyAnswer bool, timeout time.Duration, retry RetryPolicy) (QueryResult, error) {
+	var res QueryResult
+	if domain == "" {
+		return res, errors.New("empty domain name")
+	}
+
+	log := slog.With(
+		slog.String("domain", domain),
+		slog.String("resolver", r.serverAddr),
+	)
+
+	// Acquire semaphore for concurrency control
+	if r.sem != nil && r.concurrency > 0 {
+		r.sem <- struct{}{}
+		defer func() { <-r.sem }()
+	}
+
+	try := func(attempt int) (time.Duration, error) {
+		log := log.With(slog.Int("attempt", attempt))
+		res.Attempts = attempt + 1
+
+		if attempt > 0 {
+			log.LogAttrs(ctx, slog.LevelDebug, "Attempting query again")
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		start := time.Now()
+		resp, err := r.lookup(attemptCtx, domain, qtype)
+		took := time.Since(start)
+		res.RCode, res.Answers = "", 0
+		if err == nil {
+			res.RCode, res.Answers = RCodeName(resp.rcode), resp.answers
+		}
+
+		if err != nil {
+			log.LogAttrs(ctx, slog.LevelDebug, "Failed query", logattr.Err(err))
+			return took, err
+		}
+
+		if took > timeout {
+			log.LogAttrs(ctx, slog.LevelDebug, "Query exceeded timeout", slog.Int64("took_ms", took.Milliseconds()))
+			return took, context.DeadlineExceeded
+		}
+
+		if anyAnswer && (resp.rcode == RCodeSuccess || resp.rcode == RCodeNXDomain) {
+			return took, nil
+		}
+
+		if resp.rcode != RCodeSuccess {
+			log.LogAttrs(ctx, slog.LevelDebug, "Error response", slog.String("rcode", res.RCode))
+			return took, &RCodeError{RCode: resp.rcode}
+		}
+
+		if resp.matching == 0 {
+			log.LogAttrs(ctx, slog.LevelDebug, "No addresses found")
+			return took, fmt.Errorf("%w for domain %s by resolver %s", ErrNoAddresses, domain, r.serverAddr)
+		}
+
+		if took > 200*time.Millisecond {
+			log.LogAttrs(ctx, slog.LevelDebug, "Slow query", slog.Int64("took_ms", took.Milliseconds()))
+		}
+
+		return took, nil
+	}
+
+	start := time.Now()
+	elapsed, err := retryWithBackoff(ctx, try, max(retry.Retries, 0)+1, retry.InitialBackoff, retry.MaxBackoff, r.jitter)
+	res.Total = time.Since(start)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return res, fmt.Errorf("DNS query timeout for %s via %s: %w", domain, r.serverAddr, err)
+		}
+		return res, fmt.Errorf("DNS query failed for %s via %s: %w", domain, r.serverAddr, err)
+	}
+
+	res.Latency = elapsed
+	return res, nil
+}
+
+// lookup sends one query for the records of qtype of domain.
+func (r *Resolver) lookup(ctx context.Context, domain string, qtype QType) (response, error) {
+	//nolint:gosec // query IDs of a benchmark need no unpredictability
+	query, err := buildQuery(uint16(rand.Uint32()), domain, qtype)
+	if err != nil {
+		return response{}, err
+	}
+	_, resp, err := r.send(ctx, query, qtype)
+	return resp, err
+}
+
+// send sends query, asking for records of qtype, and returns the raw response
+// with its parsed header. A truncated UDP response is repeated over TCP, as a
+// stub resolver would.
+func (r *Resolver) send(ctx context.Context, query []byte, qtype QType) ([]byte, response, error) {
+	id := binary.BigEndian.Uint16(query)
+	msg, err := r.roundTrip(ctx, r.server.Transport, query)
+	if err != nil {
+		return nil, response{}, err
+	}
+	resp, err := parseResponse(msg, id, qtype)
+	if err == nil && resp.truncated && r.server.Transport.roundTrips() == 1 {
+		if msg, err = r.roundTrip(ctx, TransportTCP, query); err != nil {
+			return nil, response{}, err
+		}
+		resp, err = parseResponse(msg, id, qtype)
+	}
+	return msg, resp, err
+}
+
+func (r *Resolver) roundTrip(ctx context.Context, transport Transport, query []byte) ([]byte, error) {
+	conn, stream, err := r.dial(ctx, r.server, transport)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }() //nolint:errcheck // the response is read
+
+	// Unblock the read when the context ends early, for example when the
+	// circuit breaker cancels the remaining queries.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline) //nolint:errcheck // fails only on closed connections
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) }) //nolint:errcheck // see above
+	defer stop()
+
+	sent := time.Now()
+	msg, err := exchange(conn, stream, query)
+	if r.capture != nil {
+		r.capture.record(transport, conn, query, sent, msg, time.Now())
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, err
+	}
+	return msg, nil
+}
@@ -1,8 +1,9 @@
-package main
+package bench
 
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -14,7 +15,7 @@ func TestResolver_QueryDNS(t *testing.T) {
 		serverAddr string
 		domain     string
 		timeout    time.Duration
-		retry      ResolverRetry
+		retry      RetryPolicy
 		wantErr    bool
 		errMessage string
 	}{
@@ -23,7 +24,7 @@ func TestResolver_QueryDNS(t *testing.T) {
 			serverAddr: "8.8.8.8",
 			domain:     "google.com",
 			timeout:    2 * time.Second,
-			retry:      ResolverRetryDisabled,
+			retry:      NoRetry,
 			wantErr:    false,
 		},
 		{
@@ -31,7 +32,7 @@ func TestResolver_QueryDNS(t *testing.T) {
 			serverAddr: "8.8.8.8",
 			domain:     "",
 			timeout:    2 * time.Second,
-			retry:      ResolverRetryDisabled,
+			retry:      NoRetry,
 			wantErr:    true,
 			errMessage: "empty domain name",
 		},
@@ -40,7 +41,7 @@ func TestResolver_QueryDNS(t *testing.T) {
 			serverAddr: "256.256.256.256",
 			domain:     "google.com",
 			timeout:    2 * time.Second,
-			retry:      ResolverRetryDisabled,
+			retry:      NoRetry,
 			wantErr:    true,
 		},
 		{
@@ -48,7 +49,7 @@ func TestResolver_QueryDNS(t *testing.T) {
 			serverAddr: "8.8.8.8",
 			domain:     "thisisnotavaliddomain.invalidtld",
 			timeout:    2 * time.Second,
-			retry:      ResolverRetryDisabled,
+			retry:      NoRetry,
 			wantErr:    true,
 		},
 		{
@@ -56,7 +57,7 @@ func TestResolver_QueryDNS(t *testing.T) {
 			serverAddr: "8.8.8.8",
 			domain:     "google.com",
 			timeout:    1 * time.Microsecond,
-			retry:      ResolverRetryDisabled,
+			retry:      NoRetry,
 			wantErr:    true,
 		},
 	}
@@ -85,3 +86,45 @@ func TestResolver_QueryDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestResolver_QueryDNS_CountsAttempts(t *testing.T) {
+	// Nothing listens on port 53 here, so every attempt fails quickly.
+	r := NewResolver("127.0.0.254", 1)
+	policy := RetryPolicy{Retries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	res, err := r.QueryDNS(context.Background(), "example.com", 200*time.Millisecond, policy)
+	if err == nil {
+		t.Skip("unexpected DNS server listening on 127.0.0.254")
+	}
+	if res.Attempts != 3 {
+		t.Errorf("QueryDNS() attempts = %d, want 3", res.Attempts)
+	}
+	if res.Total <= 0 {
+		t.Errorf("QueryDNS() total = %v, want > 0", res.Total)
+	}
+}
+
+func TestResolver_SeededJitter(t *testing.T) {
+	draw := func(addr string, seed uint64) []time.Duration {
+		r := NewResolver(addr, 1)
+		r.seed(seed)
+		out := make([]time.Duration, 5)
+		for i := range out {
+			out[i] = r.jitter(time.Second)
+		}
+		return out
+	}
+
+	a, b := draw("192.0.2.1", 42), draw("192.0.2.1", 42)
+	if !slices.Equal(a, b) {
+		t.Errorf("jitter with the same seed = %v and %v, want equal", a, b)
+	}
+	if c := draw("192.0.2.2", 42); slices.Equal(a, c) {
+		t.Errorf("jitter of different resolvers with the same seed = %v, want different sequences", c)
+	}
+	for _, d := range a {
+		if d < 0 || d >= time.Second {
+			t.Errorf("jitter() = %v, want within [0, 1s)", d)
+		}
+	}
+}
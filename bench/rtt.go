@@ -0,0 +1,253 @@
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+)
+
+// DefaultRTTProbes is the number of round-trip probes sent to each resolver.
+const DefaultRTTProbes = 3
+
+// RTTMethod selects how the network round-trip time to a resolver is measured.
+type RTTMethod string
+
+const (
+	// RTTTCP times a TCP connect to the DNS port of the resolver. It needs no
+	// privileges; a refused connection is a round trip as well.
+	RTTTCP RTTMethod = "tcp"
+	// RTTICMP times an ICMP echo. It needs a raw socket and falls back to
+	// RTTTCP where that is not allowed.
+	RTTICMP RTTMethod = "icmp"
+)
+
+// ParseRTTMethod parses an RTT method name; the empty string is RTTTCP.
+func ParseRTTMethod(s string) (RTTMethod, error) {
+	switch m := RTTMethod(strings.ToLower(strings.TrimSpace(s))); m {
+	case "", RTTTCP:
+		return RTTTCP, nil
+	case RTTICMP:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid RTT method %q: expected tcp or icmp", s)
+	}
+}
+
+// RTT is the network round-trip time to a resolver, measured without DNS, and
+// how much of the DNS latency is left once the network is accounted for.
+type RTT struct {
+	Method RTTMethod `json:"method"`
+	Min    float64   `json:"min"`
+	Median float64   `json:"median"`
+	Probes int       `json:"probes"`
+	Lost   int       `json:"lost"`
+	// RoundTrips is the number of round trips a query takes on the transport
+	// of the resolver: 1 for UDP, 2 for TCP and 3 for DNS over TLS 1.3, since
+	// every query opens a new connection.
+	RoundTrips int `json:"roundTrips"`
+	// Overhead is the median DNS latency minus RoundTrips times Min: the time
+	// the resolver spends on a query, including upstream lookups on cache
+	// misses. It is NaN when no probe was answered.
+	Overhead float64 `json:"overhead"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// MarshalJSON writes NaN times of unanswered probes as null.
+func (r RTT) MarshalJSON() ([]byte, error) {
+	type plain RTT
+	return jsonnan.Marshal(plain(r))
+}
+
+// UnmarshalJSON decodes an RTT written by MarshalJSON, restoring null and
+// missing times as NaN.
+func (r *RTT) UnmarshalJSON(data []byte) error {
+	type plain RTT
+	p := plain{Min: math.NaN(), Median: math.NaN(), Overhead: math.NaN()}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*r = RTT(p)
+	return nil
+}
+
+// Share returns the part of the median DNS latency explained by the network,
+// between 0 and 1, or NaN when it is unknown.
+func (r *RTT) Share() float64 {
+	network := float64(r.RoundTrips) * r.Min
+	total := network + r.Overhead
+	if math.IsNaN(total) || total <= 0 {
+		return math.NaN()
+	}
+	return math.Min(network/total, 1)
+}
+
+// MeasureRTT sends probes round-trip probes to server one after another and
+// summarizes the answered ones. Each probe waits at most timeout.
+func MeasureRTT(ctx context.Context, server DNSServer, method RTTMethod, probes int, timeout time.Duration) RTT {
+	rtt := RTT{Method: method, Probes: probes, RoundTrips: server.Transport.roundTrips(), Overhead: math.NaN()}
+	addr := net.JoinHostPort(server.Addr, server.Transport.port())
+
+	var (
+		times []float64
+		err   error
+	)
+	if method == RTTICMP {
+		times, err = pingICMP(ctx, server.Addr, probes, timeout)
+		if errors.Is(err, os.ErrPermission) {
+			// Unprivileged processes cannot open raw sockets; the TCP handshake
+			// is the next best thing.
+			rtt.Method = RTTTCP
+			times, err = connectTCP(ctx, addr, probes, timeout)
+		}
+	} else {
+		times, err = connectTCP(ctx, addr, probes, timeout)
+	}
+
+	rtt.Lost = probes - len(times)
+	rtt.Min, rtt.Median = math.NaN(), math.NaN()
+	if len(times) > 0 {
+		rtt.Min = slices.Min(times)
+		rtt.Median = median(times)
+	}
+	if err != nil {
+		rtt.Error = err.Error()
+	}
+	return rtt
+}
+
+// connectTCP times probes TCP handshakes with addr, a host:port.
+func connectTCP(ctx context.Context, addr string, probes int, timeout time.Duration) ([]float64, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var (
+		times   []float64
+		lastErr error
+	)
+	for range probes {
+		if ctx.Err() != nil {
+			return times, ctx.Err()
+		}
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		elapsed := time.Since(start)
+		switch {
+		case err == nil:
+			_ = conn.Close() //nolint:errcheck // nothing was sent
+		case errors.Is(err, syscall.ECONNREFUSED):
+			// The reset came back from the resolver host: still a round trip.
+		default:
+			lastErr = err
+			continue
+		}
+		times = append(times, elapsed.Seconds()*1000)
+	}
+	if len(times) > 0 {
+		lastErr = nil
+	}
+	return times, lastErr
+}
+
+// pingICMP sends ICMP echo requests over a raw socket. It returns an error
+// wrapping os.ErrPermission if the process may not open one.
+func pingICMP(ctx context.Context, addr string, probes int, timeout time.Duration) ([]float64, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", addr)
+	}
+
+	network, listen, echoRequest, echoReply := "ip4:icmp", "0.0.0.0", byte(8), byte(0)
+	if ip.To4() == nil {
+		network, listen, echoRequest, echoReply = "ip6:ipv6-icmp", "::", 128, 129
+	}
+	conn, err := (&net.ListenConfig{}).ListenPacket(ctx, network, listen)
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return nil, fmt.Errorf("icmp: %w", os.ErrPermission)
+		}
+		return nil, fmt.Errorf("icmp: %w", err)
+	}
+	defer func() { _ = conn.Close() }() //nolint:errcheck // probes are done
+
+	id := uint16(os.Getpid()) //nolint:gosec // the echo identifier is 16 bits by definition
+	dst := &net.IPAddr{IP: ip}
+	buf := make([]byte, 1500)
+
+	var (
+		times   []float64
+		lastErr error
+	)
+	for seq := range probes {
+		if ctx.Err() != nil {
+			return times, ctx.Err()
+		}
+		msg := echoMessage(echoRequest, id, uint16(seq)) //nolint:gosec // probes is small
+		start := time.Now()
+		if _, err := conn.WriteTo(msg, dst); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := conn.SetReadDeadline(start.Add(timeout)); err != nil {
+			return times, err
+		}
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if isEchoReply(buf[:n], echoReply, id, uint16(seq)) && from.String() == dst.String() { //nolint:gosec // probes is small
+				times = append(times, time.Since(start).Seconds()*1000)
+				break
+			}
+		}
+	}
+	if len(times) > 0 {
+		lastErr = nil
+	}
+	return times, lastErr
+}
+
+// echoMessage builds an ICMP echo request. The checksum is only needed for
+// IPv4; the kernel fills it in for ICMPv6.
+func echoMessage(typ byte, id, seq uint16) []byte {
+	msg := make([]byte, 16)
+	msg[0] = typ
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "dnsbench")
+	if typ == 8 {
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	return msg
+}
+
+func isEchoReply(msg []byte, typ byte, id, seq uint16) bool {
+	return len(msg) >= 8 && msg[0] == typ &&
+		binary.BigEndian.Uint16(msg[4:]) == id && binary.BigEndian.Uint16(msg[6:]) == seq
+}
+
+// icmpChecksum is the Internet checksum of RFC 1071.
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum) //nolint:gosec // folded to 16 bits above
+}
@@ -0,0 +1,126 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseRTTMethod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RTTMethod
+		wantErr bool
+	}{
+		{in: "", want: RTTTCP},
+		{in: "tcp", want: RTTTCP},
+		{in: " ICMP ", want: RTTICMP},
+		{in: "udp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRTTMethod(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRTTMethod(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRTTMethod(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	open := ln.Addr().String()
+
+	// A closed port answers with a reset, which is a round trip as well.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := closed.Addr().String()
+	_ = closed.Close()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	for _, addr := range []string{open, refused} {
+		times, err := connectTCP(context.Background(), addr, 3, time.Second)
+		if err != nil || len(times) != 3 {
+			t.Errorf("connectTCP(%s) = %v, %v, want 3 round trips", addr, times, err)
+		}
+	}
+}
+
+func TestMeasureRTT_Unreachable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rtt := MeasureRTT(ctx, DNSServer{Addr: "192.0.2.1", Transport: TransportTLS}, RTTTCP, 2, time.Second)
+	if rtt.Lost != 2 || !math.IsNaN(rtt.Min) || rtt.Error == "" || rtt.RoundTrips != 3 {
+		t.Errorf("MeasureRTT() = %+v, want both probes lost over TLS", rtt)
+	}
+}
+
+func TestRTT_Share(t *testing.T) {
+	tests := []struct {
+		name string
+		rtt  RTT
+		want float64
+	}{
+		{name: "Distance", rtt: RTT{Min: 20, RoundTrips: 1, Overhead: 5}, want: 0.8},
+		{name: "Resolver", rtt: RTT{Min: 5, RoundTrips: 3, Overhead: 45}, want: 0.25},
+		{name: "Negative overhead", rtt: RTT{Min: 20, RoundTrips: 1, Overhead: -2}, want: 1},
+		{name: "Unknown", rtt: RTT{Min: math.NaN(), RoundTrips: 1, Overhead: math.NaN()}, want: math.NaN()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rtt.Share()
+			if got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want)) {
+				t.Errorf("Share() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRTT_JSON(t *testing.T) {
+	in := RTT{Method: RTTTCP, Min: math.NaN(), Median: math.NaN(), Probes: 3, Lost: 3, RoundTrips: 1, Overhead: math.NaN()}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var out RTT
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", data, err)
+	}
+	if !math.IsNaN(out.Min) || !math.IsNaN(out.Overhead) || out.Lost != 3 {
+		t.Errorf("round trip = %+v, want NaN times", out)
+	}
+}
+
+func TestEchoMessage(t *testing.T) {
+	msg := echoMessage(8, 0x1234, 7)
+	if icmpChecksum(msg) != 0 {
+		t.Errorf("checksum of %x does not verify", msg)
+	}
+	reply := echoMessage(0, 0x1234, 7)
+	if !isEchoReply(reply, 0, 0x1234, 7) || isEchoReply(reply, 0, 0x1234, 8) {
+		t.Errorf("isEchoReply() does not match on id and sequence")
+	}
+}
@@ -0,0 +1,248 @@
+package bench
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/handsomefox/dnsbench/internal/sleep"
+)
+
+// minAdaptiveRounds is the number of passes over the domain list made before
+// adaptive sampling is allowed to judge precision.
+const minAdaptiveRounds = 2
+
+// Reasons adaptive sampling stopped querying a resolver.
+const (
+	StopPrecise  = "precise"
+	StopBudget   = "budget"
+	StopTime     = "time"
+	StopDead     = "dead"
+	StopSlow     = "slow"
+	StopCanceled = "canceled"
+)
+
+// sampleAdaptively queries the domain list in rounds until the confidence
+// interval of the median is narrower than config.TargetCI, the resolver is
+// clearly dead or slower than fastest, or a budget runs out. The query budget
+// defaults to the fixed-mode workload (repeats x domains). It returns the
+// reason sampling stopped.
+func sampleAdaptively(ctx context.Context, config *runConfig, resolver *Resolver, domains []string, run *resolverRun, limits sampleLimits, fastest float64) string {
+	budget := limits.queries
+	if budget <= 0 {
+		budget = config.Repeats * len(domains)
+	}
+	target := config.TargetCI.Seconds() * 1000
+	rng := newBootstrapRand()
+	start := time.Now()
+
+	for round := 1; ; round++ {
+		remaining := budget - len(run.samples)
+		if remaining <= 0 {
+			return StopBudget
+		}
+		batch := domains
+		if remaining < len(batch) {
+			batch = batch[:remaining]
+		}
+
+		queryBatch(ctx, resolver, batch, 1, config.LookupTimeout, config.Retry, run.add)
+		if run.failure != "" {
+			return StopDead
+		}
+		if ctx.Err() != nil {
+			return StopCanceled
+		}
+
+		latencies := successfulLatencies(run.samples)
+		if len(latencies) == 0 {
+			return StopDead
+		}
+		if limits.window > 0 && time.Since(start) >= limits.window {
+			return StopTime
+		}
+		if round < minAdaptiveRounds {
+			continue
+		}
+
+		ci := bootstrapCI(latencies, median, rng)
+		slog.LogAttrs(ctx, slog.LevelDebug, "Adaptive sampling round",
+			slog.String("resolver", resolver.serverAddr),
+			slog.Int("round", round),
+			slog.Int("samples", len(run.samples)),
+			slog.Float64("ci_width_ms", ci.Width()),
+		)
+
+		if ci.Width() <= target {
+			return StopPrecise
+		}
+		if ci.Low > fastest {
+			return StopSlow
+		}
+	}
+}
+
+func successfulLatencies(samples []Sample) []float64 {
+	latencies := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		if s.Error == "" {
+			latencies = append(latencies, s.Latency)
+		}
+	}
+	return latencies
+}
+
+// sampleLimits bounds how long and how many queries a single resolver gets.
+type sampleLimits struct {
+	queries int
+	window  time.Duration
+	// after is the time budget of the resolvers still queued after this one,
+	// used to report how much of the whole run remains.
+	after time.Duration
+}
+
+// bounded reports whether the run is driven by a budget instead of -n.
+func (l sampleLimits) bounded() bool {
+	return l.queries > 0 || l.window > 0
+}
+
+// resolverLimits derives the per-resolver budget from the per-resolver and
+// whole-run options. Whole-run budgets are split evenly across resolvers and
+// the tighter of the two limits wins.
+func resolverLimits(config *runConfig, resolvers int) sampleLimits {
+	limits := sampleLimits{queries: config.MaxQueries, window: config.MaxTime}
+	if resolvers < 1 {
+		return limits
+	}
+	if config.RunQueries > 0 {
+		share := max(config.RunQueries/resolvers, 1)
+		if limits.queries == 0 || share < limits.queries {
+			limits.queries = share
+		}
+	}
+	if config.RunTime > 0 {
+		share := config.RunTime / time.Duration(resolvers)
+		if limits.window == 0 || share < limits.window {
+			limits.window = share
+		}
+	}
+	return limits
+}
+
+// pacingInterval spreads the query budget evenly over the window. Without a
+// budget the configured rate is used; without a window queries are sent as
+// fast as the concurrency limit allows.
+func pacingInterval(config *runConfig, limits sampleLimits) time.Duration {
+	switch {
+	case limits.window > 0 && limits.queries > 0:
+		return limits.window / time.Duration(limits.queries)
+	case limits.window > 0 && config.QPS > 0:
+		return time.Duration(float64(time.Second) / config.QPS)
+	default:
+		return 0
+	}
+}
+
+const (
+	// progressInterval is how often paced runs report progress to the reporter.
+	progressInterval = time.Second
+	// progressLogInterval is how often paced runs log their progress.
+	progressLogInterval = 30 * time.Second
+)
+
+// samplePaced cycles through domains, issuing queries on an even schedule
+// until the query budget is spent or the time window closes.
+func samplePaced(ctx context.Context, config *runConfig, resolver *Resolver, domains []string, run *resolverRun, limits sampleLimits) string {
+	interval := pacingInterval(config, limits)
+	start := time.Now()
+
+	type result struct {
+		domain string
+		query  QueryResult
+		err    error
+	}
+	results := make(chan result, max(config.MaxConcurrency, 1))
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for r := range results {
+			run.add(r.domain, r.query, r.err)
+		}
+	}()
+
+	// inflight stops the scheduler from piling up goroutines when the
+	// resolver is slower than the pacing.
+	inflight := make(chan struct{}, max(config.MaxConcurrency, 1))
+	var wg sync.WaitGroup
+	lastReport, lastLog := start, start
+	stopped := StopBudget
+
+	for i := 0; limits.queries == 0 || i < limits.queries; i++ {
+		if interval > 0 {
+			if !sleep.Until(ctx, start.Add(time.Duration(i)*interval)) {
+				stopped = StopCanceled
+				break
+			}
+		}
+		elapsed := time.Since(start)
+		if limits.window > 0 && elapsed >= limits.window {
+			stopped = StopTime
+			break
+		}
+
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			stopped = StopCanceled
+			break
+		}
+
+		domain := domains[i%len(domains)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+			res, err := resolver.QueryDNS(ctx, domain, config.LookupTimeout, config.Retry)
+			results <- result{domain: domain, query: res, err: err}
+		}()
+
+		if time.Since(lastReport) >= progressInterval {
+			lastReport = time.Now()
+			run.reporter.OnProgress(run.server, limitsProgress(i+1, limits, elapsed))
+		}
+		if time.Since(lastLog) >= progressLogInterval {
+			lastLog = time.Now()
+			p := limitsProgress(i+1, limits, elapsed)
+			slog.LogAttrs(ctx, slog.LevelInfo, "Benchmark progress",
+				slog.String("resolver", resolver.serverAddr),
+				slog.Int("queries", p.Done),
+				slog.Int("budget", p.Total),
+				slog.Duration("remaining", time.Duration(p.RemainingMs)*time.Millisecond),
+				slog.Duration("run_remaining", time.Duration(p.RunRemainingMs)*time.Millisecond),
+			)
+		}
+	}
+
+	wg.Wait()
+	close(results)
+	<-collected
+
+	if run.failure != "" {
+		return StopDead
+	}
+	run.reporter.OnProgress(run.server, limitsProgress(len(run.samples), limits, limits.window))
+	return stopped
+}
+
+func limitsProgress(done int, limits sampleLimits, elapsed time.Duration) Progress {
+	p := Progress{Done: done, Total: limits.queries}
+	if limits.window > 0 {
+		remaining := max(limits.window-elapsed, 0)
+		p.RemainingMs = remaining.Milliseconds()
+		p.RunRemainingMs = (remaining + limits.after).Milliseconds()
+	}
+	return p
+}
@@ -0,0 +1,168 @@
+package bench
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestResolverLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config runConfig
+		want   sampleLimits
+	}{
+		{
+			name:   "Unbounded",
+			config: runConfig{},
+			want:   sampleLimits{},
+		},
+		{
+			name:   "Run budget split across resolvers",
+			config: runConfig{RunQueries: 100, RunTime: 8 * time.Hour},
+			want:   sampleLimits{queries: 25, window: 2 * time.Hour},
+		},
+		{
+			name:   "Tighter per-resolver limit wins",
+			config: runConfig{MaxQueries: 10, RunQueries: 100, MaxTime: 3 * time.Hour, RunTime: 4 * time.Hour},
+			want:   sampleLimits{queries: 10, window: time.Hour},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolverLimits(&tt.config, 4); got != tt.want {
+				t.Errorf("resolverLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacingInterval(t *testing.T) {
+	config := &runConfig{QPS: 4}
+
+	if got := pacingInterval(config, sampleLimits{queries: 60, window: time.Minute}); got != time.Second {
+		t.Errorf("budget over window = %v, want 1s", got)
+	}
+	if got := pacingInterval(config, sampleLimits{window: time.Minute}); got != 250*time.Millisecond {
+		t.Errorf("window at 4 qps = %v, want 250ms", got)
+	}
+	if got := pacingInterval(config, sampleLimits{queries: 60}); got != 0 {
+		t.Errorf("budget only = %v, want 0", got)
+	}
+}
+
+func TestSamplePaced_StopsAtLimits(t *testing.T) {
+	// Nothing listens on port 53 here, so queries fail fast.
+	config := &runConfig{LookupTimeout: 100 * time.Millisecond, MaxConcurrency: 2, QPS: 20}
+	resolver := NewResolver("127.0.0.254", config.MaxConcurrency)
+	server := DNSServer{Name: "nowhere", Addr: "127.0.0.254"}
+	domains := []string{"a.example", "b.example"}
+
+	run := &resolverRun{server: server, reporter: NoopReporter{}}
+	stopped := samplePaced(context.Background(), config, resolver, domains, run, sampleLimits{queries: 5})
+	if stopped != StopBudget || len(run.samples) != 5 {
+		t.Errorf("budget run stopped = %q with %d samples, want %q with 5", stopped, len(run.samples), StopBudget)
+	}
+	perDomain := make(map[string]int)
+	for _, s := range run.samples {
+		perDomain[s.Domain]++
+	}
+	if perDomain["a.example"] != 3 || perDomain["b.example"] != 2 {
+		t.Errorf("queries should cycle through domains, got %v", perDomain)
+	}
+
+	run = &resolverRun{server: server, reporter: NoopReporter{}}
+	stopped = samplePaced(context.Background(), config, resolver, domains, run, sampleLimits{window: 300 * time.Millisecond})
+	if stopped != StopTime {
+		t.Errorf("timed run stopped = %q, want %q", stopped, StopTime)
+	}
+	if n := len(run.samples); n < 4 || n > 8 {
+		t.Errorf("timed run took %d samples, want about 6 at 20 qps over 300ms", n)
+	}
+}
+
+// fakeResolver answers the n-th query it receives after latency(n). A nil
+// latency refuses every connection.
+func fakeResolver(latency func(n int64) time.Duration) *Resolver {
+	resolver := NewServerResolver(DNSServer{Name: "fake", Addr: "192.0.2.53"}, 4)
+	resolver.dial = fakeDial(latency)
+	return resolver
+}
+
+// fakeDial is a transport that answers the n-th query after latency(n) over
+// an in-memory connection. A nil latency refuses every connection.
+func fakeDial(latency func(n int64) time.Duration) func(context.Context, DNSServer, Transport) (net.Conn, bool, error) {
+	var queries atomic.Int64
+	return func(context.Context, DNSServer, Transport) (net.Conn, bool, error) {
+		if latency == nil {
+			return nil, false, syscall.ECONNREFUSED
+		}
+		delay := latency(queries.Add(1))
+		client, server := net.Pipe()
+		go func() {
+			defer func() { _ = server.Close() }() //nolint:errcheck // test
+			buf := make([]byte, maxMessageSize)
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			time.Sleep(delay)
+			_, _ = server.Write(answer(buf[:n], RCodeSuccess, false, QTypeA)) //nolint:errcheck // the client may have given up
+		}()
+		return client, false, nil
+	}
+}
+
+func TestSampleAdaptively(t *testing.T) {
+	domains := []string{"a.example", "b.example", "c.example", "d.example"}
+	steady := func(int64) time.Duration { return time.Millisecond }
+	// Alternating latencies keep the confidence interval wide.
+	spread := func(n int64) time.Duration { return time.Duration(20+20*(n%2)) * time.Millisecond }
+
+	tests := []struct {
+		name        string
+		latency     func(n int64) time.Duration
+		targetCI    time.Duration
+		breaker     int
+		limits      sampleLimits
+		fastest     float64
+		want        string
+		wantSamples int
+	}{
+		{name: "Precise after the minimum rounds", latency: steady, targetCI: 50 * time.Millisecond, fastest: math.Inf(1), want: StopPrecise, wantSamples: 8},
+		{name: "Slower than the fastest", latency: spread, targetCI: time.Nanosecond, fastest: 1, want: StopSlow, wantSamples: 8},
+		{name: "Default budget of repeats x domains", latency: spread, targetCI: time.Nanosecond, fastest: math.Inf(1), want: StopBudget, wantSamples: 12},
+		{name: "Per-resolver query limit", latency: spread, targetCI: time.Nanosecond, limits: sampleLimits{queries: 6}, fastest: math.Inf(1), want: StopBudget, wantSamples: 6},
+		{name: "Per-resolver time limit", latency: spread, targetCI: time.Nanosecond, limits: sampleLimits{window: time.Nanosecond}, fastest: math.Inf(1), want: StopTime, wantSamples: 4},
+		{name: "Dead without an answer", fastest: math.Inf(1), want: StopDead, wantSamples: 4},
+		{name: "Dead by the circuit breaker", breaker: 2, fastest: math.Inf(1), want: StopDead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &runConfig{LookupTimeout: time.Second, Repeats: 3, TargetCI: tt.targetCI}
+			ctx, trip := context.WithCancel(context.Background())
+			defer trip()
+			run := &resolverRun{server: DNSServer{Name: "fake"}, reporter: NoopReporter{}, threshold: tt.breaker, trip: trip}
+
+			got := sampleAdaptively(ctx, config, fakeResolver(tt.latency), domains, run, tt.limits, tt.fastest)
+			if got != tt.want {
+				t.Errorf("sampleAdaptively() = %q, want %q", got, tt.want)
+			}
+			if tt.breaker > 0 {
+				if len(run.samples) < tt.breaker || len(run.samples) > len(domains) {
+					t.Errorf("sampleAdaptively() took %d samples, want the breaker to stop the first round", len(run.samples))
+				}
+				return
+			}
+			if len(run.samples) != tt.wantSamples {
+				t.Errorf("sampleAdaptively() took %d samples, want %d", len(run.samples), tt.wantSamples)
+			}
+		})
+	}
+}
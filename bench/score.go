@@ -0,0 +1,81 @@
+package bench
+
+import (
+	"errors"
+	"math"
+)
+
+// ScoreWeights configures how much each metric contributes to the composite score.
+// Weights are relative; they do not need to add up to 1.
+type ScoreWeights struct {
+	SuccessRate float64 `json:"successRate"`
+	Median      float64 `json:"median"`
+	P95         float64 `json:"p95"`
+	Jitter      float64 `json:"jitter"`
+}
+
+// DefaultScoreWeights favour reliability, then typical and tail latency.
+var DefaultScoreWeights = ScoreWeights{
+	SuccessRate: 0.4,
+	Median:      0.3,
+	P95:         0.2,
+	Jitter:      0.1,
+}
+
+func (w ScoreWeights) total() float64 {
+	return w.SuccessRate + w.Median + w.P95 + w.Jitter
+}
+
+// Validate reports whether the weights are usable.
+func (w ScoreWeights) Validate() error {
+	for _, v := range []float64{w.SuccessRate, w.Median, w.P95, w.Jitter} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("score weights must be finite and non-negative")
+		}
+	}
+	if w.total() == 0 {
+		return errors.New("at least one score weight must be positive")
+	}
+	return nil
+}
+
+// scoreResults assigns every valid result a composite score between 0 and 100.
+// Latency metrics are normalised against the best resolver in the run, so the
+// fastest resolver gets full marks for that metric and one twice as slow gets half.
+func scoreResults(results []BenchmarkResult, w ScoreWeights) {
+	if w.total() == 0 {
+		w = DefaultScoreWeights
+	}
+
+	bestMedian, bestP95, bestJitter := math.Inf(1), math.Inf(1), math.Inf(1)
+	for i := range results {
+		s := results[i].Stats
+		if results[i].Failed() {
+			continue
+		}
+		bestMedian = math.Min(bestMedian, s.Median)
+		bestP95 = math.Min(bestP95, s.P95)
+		bestJitter = math.Min(bestJitter, s.Jitter)
+	}
+
+	for i := range results {
+		s := results[i].Stats
+		if results[i].Failed() {
+			results[i].Score = 0
+			continue
+		}
+		score := w.SuccessRate*s.SuccessRate() +
+			w.Median*relativeTo(bestMedian, s.Median) +
+			w.P95*relativeTo(bestP95, s.P95) +
+			w.Jitter*relativeTo(bestJitter, s.Jitter)
+		results[i].Score = 100 * score / w.total()
+	}
+}
+
+// relativeTo returns best/v in [0, 1], treating a zero value as perfect.
+func relativeTo(best, v float64) float64 {
+	if v <= 0 || math.IsNaN(v) {
+		return 1
+	}
+	return math.Min(best/v, 1)
+}
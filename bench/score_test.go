@@ -0,0 +1,26 @@
+package bench
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreResults(t *testing.T) {
+	results := []BenchmarkResult{
+		{Server: DNSServer{Name: "fast"}, Stats: Stats{Mean: 10, Median: 10, P95: 20, Jitter: 2, Count: 10, Total: 10}},
+		{Server: DNSServer{Name: "slow"}, Stats: Stats{Mean: 20, Median: 20, P95: 40, Jitter: 4, Count: 10, Total: 10}},
+		{Server: DNSServer{Name: "dead"}, Stats: Stats{Mean: math.NaN(), Errors: 10, Total: 10}},
+	}
+
+	scoreResults(results, ScoreWeights{SuccessRate: 1, Median: 1})
+
+	if results[0].Score != 100 {
+		t.Errorf("fast score = %v, want 100", results[0].Score)
+	}
+	if results[1].Score != 75 {
+		t.Errorf("slow score = %v, want 75", results[1].Score)
+	}
+	if results[2].Score != 0 {
+		t.Errorf("dead score = %v, want 0", results[2].Score)
+	}
+}
@@ -0,0 +1,240 @@
+package bench
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+const (
+	// bootstrapIterations is the number of resamples used for confidence intervals.
+	bootstrapIterations = 1000
+	// confidenceLevel is the coverage of the reported confidence intervals.
+	confidenceLevel = 0.95
+	// SignificanceLevel is the p-value below which two resolvers are considered different.
+	SignificanceLevel = 0.05
+)
+
+// Interval is a closed confidence interval in milliseconds.
+type Interval struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// Width returns the size of the interval.
+func (i Interval) Width() float64 {
+	return i.High - i.Low
+}
+
+// Comparison is the outcome of testing two adjacent resolvers in the ranking.
+type Comparison struct {
+	Better      string  `json:"better"`
+	Worse       string  `json:"worse"`
+	LatencyP    float64 `json:"latencyP"`
+	SuccessP    float64 `json:"successP"`
+	Significant bool    `json:"significant"`
+}
+
+// RankGroup is a set of adjacent resolvers that are statistically tied.
+type RankGroup struct {
+	Rank      int      `json:"rank"`
+	Resolvers []string `json:"resolvers"`
+}
+
+// percentile returns the p-th percentile (0..1) of sorted using linear interpolation.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	frac := pos - float64(lo)
+	return sorted[lo] + (sorted[hi]-sorted[lo])*frac
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stddev returns the population standard deviation, used as the jitter of a resolver.
+func stddev(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return percentile(sorted, 0.5)
+}
+
+// bootstrapCI estimates a percentile bootstrap confidence interval of stat over samples.
+func bootstrapCI(samples []float64, stat func([]float64) float64, rng *rand.Rand) Interval {
+	if len(samples) == 0 {
+		return Interval{Low: math.NaN(), High: math.NaN()}
+	}
+	if len(samples) == 1 {
+		return Interval{Low: samples[0], High: samples[0]}
+	}
+
+	estimates := make([]float64, bootstrapIterations)
+	resample := make([]float64, len(samples))
+	for i := range estimates {
+		for j := range resample {
+			resample[j] = samples[rng.IntN(len(samples))]
+		}
+		estimates[i] = stat(resample)
+	}
+	slices.Sort(estimates)
+
+	alpha := (1 - confidenceLevel) / 2
+	return Interval{
+		Low:  percentile(estimates, alpha),
+		High: percentile(estimates, 1-alpha),
+	}
+}
+
+// newBootstrapRand returns the generator used for resampling. It is seeded
+// deterministically so that repeated reports over the same data agree.
+func newBootstrapRand() *rand.Rand {
+	//nolint:gosec // statistical resampling, not security sensitive
+	return rand.New(rand.NewPCG(0x646e7362, 0x656e6368))
+}
+
+// MannWhitneyU performs a two-sided Mann-Whitney U test using the normal
+// approximation with tie correction. It returns the U statistic of a and the p-value.
+func MannWhitneyU(a, b []float64) (u, p float64) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return math.NaN(), 1
+	}
+
+	type obs struct {
+		value float64
+		first bool
+	}
+	all := make([]obs, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, obs{value: v, first: true})
+	}
+	for _, v := range b {
+		all = append(all, obs{value: v})
+	}
+	slices.SortFunc(all, func(x, y obs) int {
+		switch {
+		case x.value < y.value:
+			return -1
+		case x.value > y.value:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	// Assign average ranks to ties and accumulate the tie correction term.
+	var rankSumA, tieTerm float64
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		avgRank := float64(i+j+1) / 2 // ranks are 1-based: (i+1 + j) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				rankSumA += avgRank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	u = rankSumA - n1*(n1+1)/2
+	n := n1 + n2
+	meanU := n1 * n2 / 2
+	varU := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if varU <= 0 {
+		return u, 1
+	}
+
+	// Continuity correction towards the mean.
+	z := (math.Abs(u-meanU) - 0.5) / math.Sqrt(varU)
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Erfc(z / math.Sqrt2)
+}
+
+// TwoProportionP returns the two-sided p-value of a z-test for equal success
+// proportions between two resolvers.
+func TwoProportionP(successA, totalA, successB, totalB int) float64 {
+	if totalA == 0 || totalB == 0 {
+		return 1
+	}
+	pa := float64(successA) / float64(totalA)
+	pb := float64(successB) / float64(totalB)
+	pooled := float64(successA+successB) / float64(totalA+totalB)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(totalA) + 1/float64(totalB)))
+	if se == 0 {
+		if pa == pb {
+			return 1
+		}
+		return 0
+	}
+	z := math.Abs(pa-pb) / se
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// CompareRanking tests each pair of adjacent resolvers in an already sorted
+// ranking and groups the ones that are not significantly different. Groups
+// are formed by chaining adjacent ties, so a group boundary always sits
+// between two resolvers that do differ.
+func CompareRanking(ranked []BenchmarkResult) ([]Comparison, []RankGroup) {
+	if len(ranked) == 0 {
+		return nil, nil
+	}
+
+	comparisons := make([]Comparison, 0, len(ranked)-1)
+	groups := []RankGroup{{Rank: 1, Resolvers: []string{ranked[0].Server.Name}}}
+
+	for i := 1; i < len(ranked); i++ {
+		better, worse := ranked[i-1], ranked[i]
+		_, latencyP := MannWhitneyU(better.Latencies(), worse.Latencies())
+		successP := TwoProportionP(better.Stats.Count, better.Stats.Total, worse.Stats.Count, worse.Stats.Total)
+
+		c := Comparison{
+			Better:      better.Server.Name,
+			Worse:       worse.Server.Name,
+			LatencyP:    latencyP,
+			SuccessP:    successP,
+			Significant: latencyP < SignificanceLevel || successP < SignificanceLevel,
+		}
+		comparisons = append(comparisons, c)
+
+		if c.Significant {
+			groups = append(groups, RankGroup{Rank: i + 1})
+		}
+		last := &groups[len(groups)-1]
+		last.Resolvers = append(last.Resolvers, worse.Server.Name)
+	}
+
+	return comparisons, groups
+}
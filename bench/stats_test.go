@@ -0,0 +1,173 @@
+package bench
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{p: 0, want: 1},
+		{p: 0.5, want: 3},
+		{p: 1, want: 5},
+		{p: 0.95, want: 4.8},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	if got := percentile(nil, 0.5); !math.IsNaN(got) {
+		t.Errorf("percentile(nil) = %v, want NaN", got)
+	}
+}
+
+func TestBootstrapCI_ContainsEstimate(t *testing.T) {
+	samples := make([]float64, 200)
+	for i := range samples {
+		samples[i] = float64(10 + i%20)
+	}
+
+	ci := bootstrapCI(samples, median, newBootstrapRand())
+	m := median(samples)
+	if ci.Low > m || ci.High < m {
+		t.Errorf("bootstrapCI() = %+v, does not contain median %v", ci, m)
+	}
+	if ci.Width() <= 0 {
+		t.Errorf("bootstrapCI() width = %v, want > 0", ci.Width())
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   []float64
+		wantU  float64
+		pBelow float64
+		pAbove float64
+		checkU bool
+	}{
+		{
+			name:   "Separated small samples",
+			a:      []float64{1, 2, 3},
+			b:      []float64{4, 5, 6},
+			wantU:  0,
+			checkU: true,
+			pAbove: 0.05,
+			pBelow: 0.1,
+		},
+		{
+			name:   "Identical samples",
+			a:      []float64{5, 5, 5, 5},
+			b:      []float64{5, 5, 5, 5},
+			pAbove: 0.99,
+			pBelow: 1.01,
+		},
+		{
+			name:   "Separated large samples",
+			a:      seq(10, 60),
+			b:      seq(100, 60),
+			pAbove: -1,
+			pBelow: 0.001,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, p := MannWhitneyU(tt.a, tt.b)
+			if tt.checkU && u != tt.wantU {
+				t.Errorf("MannWhitneyU() U = %v, want %v", u, tt.wantU)
+			}
+			if p <= tt.pAbove || p >= tt.pBelow {
+				t.Errorf("MannWhitneyU() p = %v, want in (%v, %v)", p, tt.pAbove, tt.pBelow)
+			}
+		})
+	}
+}
+
+func TestCompareRanking_GroupsTies(t *testing.T) {
+	ranked := []BenchmarkResult{
+		resultWithLatencies("fast-a", seq(10, 50)),
+		resultWithLatencies("fast-b", seq(10, 50)),
+		resultWithLatencies("slow", seq(200, 50)),
+	}
+
+	comparisons, groups := CompareRanking(ranked)
+	if len(comparisons) != 2 {
+		t.Fatalf("CompareRanking() comparisons = %d, want 2", len(comparisons))
+	}
+	if comparisons[0].Significant {
+		t.Errorf("identical resolvers reported as significantly different: %+v", comparisons[0])
+	}
+	if !comparisons[1].Significant {
+		t.Errorf("separated resolvers reported as tied: %+v", comparisons[1])
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("CompareRanking() groups = %+v, want 2 groups", groups)
+	}
+	if got := strings.Join(groups[0].Resolvers, ","); got != "fast-a,fast-b" {
+		t.Errorf("first group = %s, want fast-a,fast-b", got)
+	}
+	if groups[1].Rank != 3 {
+		t.Errorf("second group rank = %d, want 3", groups[1].Rank)
+	}
+}
+
+func TestStats_MarshalJSONNaN(t *testing.T) {
+	b, err := json.Marshal(CalculateStats(nil, 3, 3))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(b), `"mean":null`) {
+		t.Errorf("json.Marshal() = %s, want null mean", b)
+	}
+
+	var decoded Stats
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if decoded.Errors != 3 || decoded.IsValid() {
+		t.Errorf("decoded stats = %+v, want 3 errors and invalid", decoded)
+	}
+}
+
+// seq returns n values starting at start, increasing by 1.
+func seq(start float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = start + float64(i)
+	}
+	return out
+}
+
+func resultWithLatencies(name string, latencies []float64) BenchmarkResult {
+	samples := make([]Sample, len(latencies))
+	for i, l := range latencies {
+		samples[i] = Sample{Domain: "example.com", Latency: l, Attempts: 1}
+	}
+	return BenchmarkResult{
+		Server:  DNSServer{Name: name, Addr: "192.0.2.1"},
+		Stats:   CalculateStats(append([]float64(nil), latencies...), 0, len(latencies)),
+		Samples: samples,
+	}
+}
+
+func TestBenchmarkResult_MarshalJSONOmitsSamples(t *testing.T) {
+	samples := []Sample{{Domain: "example.com", Latency: 12, Total: 12, Attempts: 1}}
+	b, err := json.Marshal(BenchmarkResult{Server: DNSServer{Name: "A", Addr: "192.0.2.1"}, Stats: SummarizeSamples(samples), Samples: samples})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if strings.Contains(string(b), "samples") || strings.Contains(string(b), "example.com") {
+		t.Errorf("json.Marshal() = %s, want no raw samples", b)
+	}
+}
@@ -0,0 +1,104 @@
+package bench
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Transport is the protocol used to reach a resolver.
+type Transport string
+
+// Supported transports. The zero value is TransportUDP.
+const (
+	TransportUDP Transport = "udp"
+	TransportTCP Transport = "tcp"
+	// TransportTLS is DNS over TLS (RFC 7858). Every query opens a new
+	// connection, so latencies include the TCP and TLS handshakes.
+	TransportTLS Transport = "tls"
+)
+
+// ParseTransport parses a transport name; the empty string is TransportUDP.
+func ParseTransport(s string) (Transport, error) {
+	switch t := Transport(strings.ToLower(strings.TrimSpace(s))); t {
+	case "", TransportUDP:
+		return TransportUDP, nil
+	case TransportTCP, TransportTLS:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid transport %q: expected udp, tcp or tls", s)
+	}
+}
+
+func (t Transport) String() string {
+	if t == "" {
+		return string(TransportUDP)
+	}
+	return string(t)
+}
+
+// port returns the default DNS port of the transport.
+func (t Transport) port() string {
+	if t == TransportTLS {
+		return "853"
+	}
+	return "53"
+}
+
+// roundTrips returns how many round trips a query over t takes on a new
+// connection, handshakes included.
+func (t Transport) roundTrips() int {
+	switch t {
+	case TransportTCP:
+		return 2
+	case TransportTLS:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// IPv6 reports whether the server is reached over IPv6.
+func (s DNSServer) IPv6() bool {
+	addr, err := netip.ParseAddr(s.Addr)
+	return err == nil && addr.Unmap().Is6()
+}
+
+// Endpoint identifies the server together with its transport, for example
+// "1.1.1.1" for UDP and "tls://1.1.1.1" for DNS over TLS.
+func (s DNSServer) Endpoint() string {
+	if s.Transport == "" || s.Transport == TransportUDP {
+		return s.Addr
+	}
+	return string(s.Transport) + "://" + s.Addr
+}
+
+// dial connects to server over transport. Messages on stream connections
+// (TCP and TLS) carry a length prefix.
+func dial(ctx context.Context, server DNSServer, transport Transport) (conn net.Conn, stream bool, err error) {
+	addr := net.JoinHostPort(server.Addr, transport.port())
+	dialer := &net.Dialer{}
+
+	switch transport {
+	case TransportTCP:
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		return conn, true, err
+	case TransportTLS:
+		serverName := server.Hostname
+		if serverName == "" {
+			serverName = server.Addr
+		}
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12},
+		}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+		return conn, true, err
+	default:
+		conn, err = dialer.DialContext(ctx, "udp", addr)
+		return conn, false, err
+	}
+}
@@ -0,0 +1,65 @@
+package bench
+
+import "testing"
+
+func TestParseTransport(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Transport
+		wantErr bool
+	}{
+		{in: "", want: TransportUDP},
+		{in: "udp", want: TransportUDP},
+		{in: "TCP", want: TransportTCP},
+		{in: " tls ", want: TransportTLS},
+		{in: "https", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTransport(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTransport(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTransport(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSServer_Endpoint(t *testing.T) {
+	tests := []struct {
+		server DNSServer
+		want   string
+	}{
+		{server: DNSServer{Addr: "1.1.1.1"}, want: "1.1.1.1"},
+		{server: DNSServer{Addr: "1.1.1.1", Transport: TransportUDP}, want: "1.1.1.1"},
+		{server: DNSServer{Addr: "1.1.1.1", Transport: TransportTCP}, want: "tcp://1.1.1.1"},
+		{server: DNSServer{Addr: "2606:4700:4700::1111", Transport: TransportTLS}, want: "tls://2606:4700:4700::1111"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.server.Endpoint(); got != tt.want {
+			t.Errorf("Endpoint() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestDNSServer_IPv6(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "1.1.1.1", want: false},
+		{addr: "2606:4700:4700::1111", want: true},
+		{addr: "::ffff:1.1.1.1", want: false},
+		{addr: "dns.example", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := (DNSServer{Addr: tt.addr}).IPv6(); got != tt.want {
+			t.Errorf("IPv6(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+)
+
+func retryWithBackoff[T any](
+	ctx context.Context,
+	f func(attempt int) (T, error),
+	maxRetries int,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration,
+	jitter func(time.Duration) time.Duration,
+) (val T, err error) {
+	if maxRetries < 1 {
+		return val, errors.New("maxRetries must be positive")
+	}
+
+	backoff := min(initialBackoff, maxBackoff)
+
+	for attempt := range maxRetries {
+		if cErr := ctx.Err(); cErr != nil {
+			return val, cErr
+		}
+
+		val, err = f(attempt)
+		if err == nil {
+			return val, nil
+		}
+
+		if attempt == maxRetries-1 {
+			break
+		}
+
+		if backoff > 0 {
+			wait := backoff/2 + jitter(backoff)
+
+			select {
+			case <-ctx.Done():
+				return val, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	return val, err
+}
+
+func gcAndWait() {
+	runtime.GC()
+	runtime.GC()
+	time.Sleep(50 * time.Millisecond)
+}
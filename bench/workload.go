@@ -0,0 +1,139 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/handsomefox/dnsbench/internal/sleep"
+)
+
+// WorkloadQuery is one query of a recorded workload. At is when it was sent,
+// relative to the first query of the recording.
+type WorkloadQuery struct {
+	Name  string        `json:"name"`
+	QType QType         `json:"qtype"`
+	At    time.Duration `json:"at"`
+}
+
+// Pacing selects how a workload is replayed.
+type Pacing string
+
+const (
+	// PacingFast sends the queries of a workload as fast as the concurrency
+	// limit allows.
+	PacingFast Pacing = "fast"
+	// PacingOriginal sends every query at its recorded offset, so a replay
+	// takes as long as the recording.
+	PacingOriginal Pacing = "original"
+)
+
+// ParsePacing parses a replay pacing; the empty string is PacingFast.
+func ParsePacing(s string) (Pacing, error) {
+	switch p := Pacing(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return PacingFast, nil
+	case PacingFast, PacingOriginal:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid pacing %q: expected fast or original", s)
+	}
+}
+
+// WorkloadNames returns the distinct names of queries in the order they
+// first appear.
+func WorkloadNames(queries []WorkloadQuery) []string {
+	seen := make(map[string]bool, len(queries))
+	var names []string
+	for _, q := range queries {
+		if !seen[q.Name] {
+			seen[q.Name] = true
+			names = append(names, q.Name)
+		}
+	}
+	return names
+}
+
+// replayDuration is how long a replay of the workload of config takes per
+// resolver, zero when it is not paced.
+func (c *runConfig) replayDuration() time.Duration {
+	if len(c.Workload) == 0 || c.Pacing != PacingOriginal {
+		return 0
+	}
+	return c.Workload[len(c.Workload)-1].At
+}
+
+// replayWorkload sends every query of config.Workload once, at its recorded
+// offset with PacingOriginal. Like the clients that sent them, it takes
+// NXDOMAIN and answers without records for answers. It returns StopCanceled
+// if ctx ended first.
+func replayWorkload(ctx context.Context, config *runConfig, resolver *Resolver, run *resolverRun, limits sampleLimits) string {
+	workload := config.Workload
+	paced := config.Pacing == PacingOriginal
+	duration := config.replayDuration()
+	start := time.Now()
+
+	type result struct {
+		query WorkloadQuery
+		res   QueryResult
+		err   error
+	}
+	results := make(chan result, max(config.MaxConcurrency, 1))
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for r := range results {
+			sample := newSample(r.query.Name, r.res, r.err)
+			sample.QType = r.query.QType
+			run.addSample(sample, r.err)
+		}
+	}()
+
+	// inflight bounds the goroutines waiting for a slow resolver, as in
+	// samplePaced.
+	inflight := make(chan struct{}, max(config.MaxConcurrency, 1))
+	var wg sync.WaitGroup
+	lastReport := start
+	stopped := ""
+
+	for i, q := range workload {
+		if paced && !sleep.Until(ctx, start.Add(q.At)) {
+			stopped = StopCanceled
+			break
+		}
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			stopped = StopCanceled
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+			res, err := resolver.query(ctx, q.Name, q.QType, true, config.LookupTimeout, config.Retry)
+			results <- result{query: q, res: res, err: err}
+		}()
+
+		if time.Since(lastReport) >= progressInterval {
+			lastReport = time.Now()
+			p := Progress{Done: i + 1, Total: len(workload)}
+			if paced {
+				remaining := max(duration-time.Since(start), 0)
+				p.RemainingMs = remaining.Milliseconds()
+				p.RunRemainingMs = (remaining + limits.after).Milliseconds()
+			}
+			run.reporter.OnProgress(run.server, p)
+		}
+	}
+
+	wg.Wait()
+	close(results)
+	<-collected
+	return stopped
+}
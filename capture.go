@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// captureFormat picks the capture format from the file name: dnstap for
+// .dnstap, .fstrm and .tap, pcap otherwise.
+func captureFormat(path string) (bench.CaptureFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dnstap", ".fstrm", ".tap":
+		return bench.CaptureDnstap, nil
+	case ".pcapng":
+		return "", errors.New("pcapng captures are not supported: use .pcap or .dnstap")
+	default:
+		return bench.CapturePcap, nil
+	}
+}
+
+// captureFile is a capture of the traffic of a run and the file it is
+// written to.
+type captureFile struct {
+	*bench.CaptureWriter
+
+	file *os.File
+}
+
+// createCapture creates the capture file at path, replacing an existing one.
+func createCapture(path string) (*captureFile, error) {
+	format, err := captureFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:gosec // file path provided by user intentionally
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating capture: %w", err)
+	}
+	w, err := bench.NewCaptureWriter(file, format)
+	if err != nil {
+		_ = file.Close() //nolint:errcheck // already failing
+		return nil, fmt.Errorf("writing capture: %w", err)
+	}
+	return &captureFile{CaptureWriter: w, file: file}, nil
+}
+
+// Close ends the capture and closes its file.
+func (c *captureFile) Close() error {
+	return errors.Join(c.CaptureWriter.Close(), c.file.Close())
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestCaptureFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    bench.CaptureFormat
+		wantErr bool
+	}{
+		{path: "run.pcap", want: bench.CapturePcap},
+		{path: "run", want: bench.CapturePcap},
+		{path: "run.DNSTAP", want: bench.CaptureDnstap},
+		{path: "/tmp/run.fstrm", want: bench.CaptureDnstap},
+		{path: "run.tap", want: bench.CaptureDnstap},
+		{path: "run.pcapng", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := captureFormat(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("captureFormat(%q) = %q, %v, want %q, error %v", tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// exitInterrupted is the exit code of a run canceled with SIGINT or SIGTERM,
+// following the shell convention of 128+SIGINT.
+const exitInterrupted = 130
+
+var errInterrupted = errors.New("run interrupted")
+
+// A checkpoint is a JSON Lines file written while a run is in progress: a
+// header describing the run, then one line per sample and one line per
+// completed resolver. Every line is written as soon as it is known, so a
+// canceled or killed run can be continued with -resume.
+const (
+	entryHeader = "header"
+	entrySample = "sample"
+	entryResult = "result"
+)
+
+type checkpointEntry struct {
+	Type   string                 `json:"type"`
+	Header *checkpointHeader      `json:"header,omitempty"`
+	Server string                 `json:"server,omitempty"`
+	Sample *bench.Sample          `json:"sample,omitempty"`
+	Result *bench.BenchmarkResult `json:"result,omitempty"`
+}
+
+type checkpointHeader struct {
+	Started  time.Time         `json:"started"`
+	Seed     uint64            `json:"seed"`
+	Servers  []bench.DNSServer `json:"servers"`
+	Domains  []string          `json:"domains"`
+	Repeats  int               `json:"repeats"`
+	Adaptive bool              `json:"adaptive,omitempty"`
+	Budgeted bool              `json:"budgeted,omitempty"`
+	Warmup   int               `json:"warmup,omitempty"`
+	Replay   bench.Pacing      `json:"replay,omitempty"`
+	QType    bench.QType       `json:"qtype,omitempty"`
+}
+
+func newCheckpointHeader(config *Config, manifest *Manifest, servers []bench.DNSServer, domains []string) checkpointHeader {
+	header := checkpointHeader{
+		Started:  manifest.Started,
+		Seed:     manifest.Seed,
+		Servers:  servers,
+		Domains:  domains,
+		Repeats:  config.Repeats,
+		Adaptive: config.Adaptive,
+		Budgeted: config.MaxQueries > 0 || config.MaxTime > 0 || config.RunQueries > 0 || config.RunTime > 0,
+		Warmup:   config.WarmupRuns,
+		QType:    config.QType,
+	}
+	if len(config.Workload) > 0 {
+		header.Replay = config.Pacing
+	}
+	return header
+}
+
+func checkpointEndpoints(servers []bench.DNSServer) []string {
+	list := make([]string, 0, len(servers))
+	for _, s := range servers {
+		list = append(list, s.Endpoint())
+	}
+	return list
+}
+
+// key identifies the run of h by what -resume requires to be the same, so
+// that a repeated command finds its checkpoint and different runs do not
+// overwrite each other's.
+func (h *checkpointHeader) key() string {
+	data, _ := json.Marshal(struct {
+		Servers  []string     `json:"servers"`
+		Domains  []string     `json:"domains"`
+		Repeats  int          `json:"repeats"`
+		Adaptive bool         `json:"adaptive"`
+		Budgeted bool         `json:"budgeted"`
+		Warmup   int          `json:"warmup"`
+		Replay   bench.Pacing `json:"replay"`
+		QType    bench.QType  `json:"qtype"`
+	}{checkpointEndpoints(h.Servers), h.Domains, h.Repeats, h.Adaptive, h.Budgeted, h.Warmup, h.Replay, h.QType})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkpointPath is the checkpoint file in dir of the run of header.
+func checkpointPath(dir string, header *checkpointHeader) string {
+	return filepath.Join(dir, header.key()+".jsonl")
+}
+
+// matches reports why a run described by other cannot continue this checkpoint.
+func (h *checkpointHeader) matches(other *checkpointHeader) error {
+	switch {
+	case !slices.Equal(checkpointEndpoints(h.Servers), checkpointEndpoints(other.Servers)):
+		return errors.New("the checkpoint was written for different resolvers")
+	case !slices.Equal(h.Domains, other.Domains):
+		return errors.New("the checkpoint was written for different domains")
+	case h.Repeats != other.Repeats || h.Adaptive != other.Adaptive || h.Budgeted != other.Budgeted || h.Warmup != other.Warmup || h.Replay != other.Replay:
+		return errors.New("the checkpoint was written with different sampling options (-n, -adaptive, budgets, -workload, -pacing or -warmup)")
+	case h.QType != other.QType:
+		return errors.New("the checkpoint was written for a different record type (-qtype)")
+	}
+	return nil
+}
+
+func defaultCheckpointDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dnsbench", "checkpoints")
+}
+
+// Checkpoint writes the progress of a run to its checkpoint file. It is a
+// bench.SampleReporter; write errors are logged once and stop checkpointing
+// without affecting the run.
+type Checkpoint struct {
+	bench.NoopReporter
+
+	path string
+	file *os.File
+	enc  *json.Encoder
+	err  error
+}
+
+// createCheckpoint starts a new checkpoint file at path.
+func createCheckpoint(path string, header checkpointHeader) (*Checkpoint, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("creating checkpoint directory: %w", err)
+	}
+	//nolint:gosec // file path provided by user intentionally
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating checkpoint: %w", err)
+	}
+	c := &Checkpoint{path: path, file: file, enc: json.NewEncoder(file)}
+	c.write(checkpointEntry{Type: entryHeader, Header: &header})
+	return c, c.err
+}
+
+func (c *Checkpoint) write(entry checkpointEntry) {
+	if c.err != nil {
+		return
+	}
+	// The file is not buffered: every line reaches the kernel right away and
+	// survives the process being killed.
+	if err := c.enc.Encode(entry); err != nil {
+		c.err = err
+		slog.Warn("Could not write checkpoint, continuing without it",
+			slog.String("path", c.path),
+			logattr.Err(err),
+		)
+	}
+}
+
+func (c *Checkpoint) OnSample(server bench.DNSServer, sample bench.Sample) {
+	c.write(checkpointEntry{Type: entrySample, Server: server.Endpoint(), Sample: &sample})
+}
+
+func (c *Checkpoint) OnResolverResult(result bench.BenchmarkResult) {
+	c.write(checkpointEntry{Type: entryResult, Result: &result})
+}
+
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// Remove closes and deletes the checkpoint once the run has completed.
+func (c *Checkpoint) Remove() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+	return os.Remove(c.path)
+}
+
+// loadCheckpoint reads a checkpoint file. It returns the complete results and,
+// for a resolver that was interrupted, a result with its samples marked as
+// bench.StopCanceled. A torn last line, left by a killed process, is ignored.
+func loadCheckpoint(path string) (*checkpointHeader, []bench.BenchmarkResult, error) {
+	//nolint:gosec // file path provided by user intentionally
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening checkpoint: %w", err)
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck // read-only
+
+	var (
+		header  *checkpointHeader
+		results = make(map[string]bench.BenchmarkResult)
+		samples = make(map[string][]bench.Sample)
+	)
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading checkpoint: %w", err)
+		}
+
+		var entry checkpointEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, nil, fmt.Errorf("checkpoint %s line %d: %w", path, line, err)
+		}
+		switch {
+		case entry.Type == entryHeader && entry.Header != nil && header == nil:
+			header = entry.Header
+		case header == nil:
+			return nil, nil, fmt.Errorf("checkpoint %s does not start with a header", path)
+		case entry.Type == entrySample && entry.Sample != nil:
+			samples[entry.Server] = append(samples[entry.Server], *entry.Sample)
+		case entry.Type == entryResult && entry.Result != nil:
+			results[entry.Result.Server.Endpoint()] = *entry.Result
+		default:
+			return nil, nil, fmt.Errorf("checkpoint %s line %d: unexpected %q entry", path, line, entry.Type)
+		}
+	}
+	if header == nil {
+		return nil, nil, fmt.Errorf("checkpoint %s is empty", path)
+	}
+
+	var prior []bench.BenchmarkResult
+	for _, server := range header.Servers {
+		key := server.Endpoint()
+		if result, ok := results[key]; ok {
+			result.Samples = samples[key]
+			prior = append(prior, result)
+		} else if s := samples[key]; len(s) > 0 {
+			prior = append(prior, bench.BenchmarkResult{
+				Server:  server,
+				Stats:   bench.SummarizeSamples(s),
+				Stopped: bench.StopCanceled,
+				Samples: s,
+			})
+		}
+	}
+	return header, prior, nil
+}
+
+// startCheckpoint opens the checkpoint of a run in the checkpoint directory.
+// With -resume it loads the earlier results, checks that they belong to the
+// same run and carries over its seed and start time; otherwise it starts a
+// new file. Without a checkpoint directory it returns nil.
+func startCheckpoint(config *Config, manifest *Manifest, servers []bench.DNSServer, domains []string) (*Checkpoint, []bench.BenchmarkResult, error) {
+	if config.CheckpointDir == "" {
+		return nil, nil, nil
+	}
+	header := newCheckpointHeader(config, manifest, servers, domains)
+	path := checkpointPath(config.CheckpointDir, &header)
+	if !config.Resume {
+		c, err := createCheckpoint(path, header)
+		return c, nil, err
+	}
+
+	saved, prior, err := loadCheckpoint(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, errors.New("no interrupted run to resume with these resolvers, domains, record type and sampling options")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saved.matches(&header); err != nil {
+		return nil, nil, fmt.Errorf("cannot resume from %s: %w", path, err)
+	}
+	if config.Seed == 0 {
+		manifest.Seed, manifest.Config.Seed = saved.Seed, saved.Seed
+	}
+	manifest.Started = saved.Started
+
+	if header.Adaptive || header.Budgeted || header.Replay != "" {
+		// Only fixed runs continue an interrupted resolver; drop its samples
+		// so that it is measured again from scratch.
+		prior = slices.DeleteFunc(prior, func(r bench.BenchmarkResult) bool { return r.Interrupted() })
+	}
+
+	slog.Info("Resuming run",
+		slog.String("checkpoint", path),
+		slog.Int("resolvers", len(prior)),
+		slog.Int("total", len(servers)),
+	)
+
+	// Rewrite the file with what is kept, so that it stays consistent if
+	// this run is interrupted as well.
+	c, err := createCheckpoint(path, *saved)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, result := range prior {
+		for _, sample := range result.Samples {
+			c.OnSample(result.Server, sample)
+		}
+		if !result.Interrupted() {
+			c.OnResolverResult(result)
+		}
+	}
+	return c, prior, c.err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+var (
+	testCheckpointServers = []bench.DNSServer{
+		{Name: "A", Addr: "192.0.2.1"},
+		{Name: "B", Addr: "192.0.2.2"},
+		{Name: "C", Addr: "192.0.2.3"},
+	}
+	testCheckpointDomains = []string{"example.com", "example.org"}
+)
+
+// writeTestCheckpoint writes the checkpoint of an interrupted run in a new
+// checkpoint directory and returns its path.
+func writeTestCheckpoint(t *testing.T, config *Config) string {
+	t.Helper()
+	manifest := &Manifest{Seed: 42, Started: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	header := newCheckpointHeader(config, manifest, testCheckpointServers, testCheckpointDomains)
+	path := checkpointPath(t.TempDir(), &header)
+
+	c, err := createCheckpoint(path, header)
+	if err != nil {
+		t.Fatalf("createCheckpoint() error = %v", err)
+	}
+	samples := []bench.Sample{{Domain: "example.com", Latency: 10, Attempts: 1}, {Domain: "example.org", Latency: 12, Attempts: 1}}
+	for _, s := range samples {
+		c.OnSample(testCheckpointServers[0], s)
+	}
+	c.OnResolverResult(bench.BenchmarkResult{Server: testCheckpointServers[0], Stats: bench.SummarizeSamples(samples), Samples: samples})
+	c.OnSample(testCheckpointServers[1], bench.Sample{Domain: "example.com", Latency: 20, Attempts: 1})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A process killed in the middle of a write leaves a torn last line.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"type":"sample","server":"192.0.2.2","sam`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	path := writeTestCheckpoint(t, &Config{Repeats: 1})
+
+	header, prior, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("loadCheckpoint() error = %v", err)
+	}
+	if header.Seed != 42 || header.Repeats != 1 || len(header.Servers) != 3 {
+		t.Errorf("header = %+v", header)
+	}
+	if len(prior) != 2 {
+		t.Fatalf("len(prior) = %d, want 2", len(prior))
+	}
+	if prior[0].Interrupted() || prior[0].Stats.Total != 2 || len(prior[0].Samples) != 2 {
+		t.Errorf("prior[0] = %+v, want the complete result of A with its samples", prior[0])
+	}
+	if !prior[1].Interrupted() || len(prior[1].Samples) != 1 || prior[1].Server != testCheckpointServers[1] {
+		t.Errorf("prior[1] = %+v, want the interrupted samples of B", prior[1])
+	}
+}
+
+func TestStartCheckpoint_Resume(t *testing.T) {
+	config := &Config{Repeats: 1, Resume: true}
+	path := writeTestCheckpoint(t, config)
+	config.CheckpointDir = filepath.Dir(path)
+	manifest := newManifest(config)
+
+	c, prior, err := startCheckpoint(config, manifest, testCheckpointServers, testCheckpointDomains)
+	if err != nil {
+		t.Fatalf("startCheckpoint() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(prior) != 2 {
+		t.Errorf("len(prior) = %d, want 2", len(prior))
+	}
+	if manifest.Seed != 42 || manifest.Config.Seed != 42 || manifest.Started.Year() != 2026 {
+		t.Errorf("manifest seed, start = %d, %v, want those of the checkpoint", manifest.Seed, manifest.Started)
+	}
+
+	// The rewritten file holds the same progress without the torn line.
+	if _, again, err := loadCheckpoint(path); err != nil || len(again) != 2 || len(again[0].Samples) != 2 {
+		t.Errorf("loadCheckpoint() after resume = %+v, %v, want 2 results with samples", again, err)
+	}
+}
+
+func TestStartCheckpoint_Mismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		servers []bench.DNSServer
+		domains []string
+	}{
+		{name: "Resolvers", config: Config{Repeats: 1}, servers: testCheckpointServers[:2], domains: testCheckpointDomains},
+		{name: "Domains", config: Config{Repeats: 1}, servers: testCheckpointServers, domains: []string{"example.net"}},
+		{name: "Repeats", config: Config{Repeats: 3}, servers: testCheckpointServers, domains: testCheckpointDomains},
+		{name: "QType", config: Config{Repeats: 1, QType: bench.QTypeAAAA}, servers: testCheckpointServers, domains: testCheckpointDomains},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Resume = true
+			config.CheckpointDir = filepath.Dir(writeTestCheckpoint(t, &Config{Repeats: 1}))
+			if _, _, err := startCheckpoint(&config, newManifest(&config), tt.servers, tt.domains); err == nil {
+				t.Errorf("startCheckpoint() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCheckpointPath(t *testing.T) {
+	header := func(config *Config, seed uint64, domains []string) *checkpointHeader {
+		h := newCheckpointHeader(config, &Manifest{Seed: seed, Started: time.Now()}, testCheckpointServers, domains)
+		return &h
+	}
+	path := checkpointPath("dir", header(&Config{Repeats: 1}, 1, testCheckpointDomains))
+
+	if got := checkpointPath("dir", header(&Config{Repeats: 1}, 2, testCheckpointDomains)); got != path {
+		t.Errorf("checkpointPath() of a repeated run = %q, want %q", got, path)
+	}
+	if got := checkpointPath("dir", header(&Config{Repeats: 2}, 1, testCheckpointDomains)); got == path {
+		t.Errorf("checkpointPath() with other sampling options = %q, want another file", got)
+	}
+	if got := checkpointPath("dir", header(&Config{Repeats: 1}, 1, []string{"example.net"})); got == path {
+		t.Errorf("checkpointPath() with other domains = %q, want another file", got)
+	}
+	if got := checkpointPath("dir", header(&Config{Repeats: 1, QType: bench.QTypeAAAA}, 1, testCheckpointDomains)); got == path {
+		t.Errorf("checkpointPath() with another record type = %q, want another file", got)
+	}
+}
+
+func TestCheckpointHeader_MatchesQType(t *testing.T) {
+	manifest := &Manifest{Seed: 1, Started: time.Now()}
+	a := newCheckpointHeader(&Config{Repeats: 1, QType: bench.QTypeA}, manifest, testCheckpointServers, testCheckpointDomains)
+	aaaa := newCheckpointHeader(&Config{Repeats: 1, QType: bench.QTypeAAAA}, manifest, testCheckpointServers, testCheckpointDomains)
+
+	if err := a.matches(&a); err != nil {
+		t.Errorf("matches() of the same record type = %v, want nil", err)
+	}
+	if err := a.matches(&aaaa); err == nil {
+		t.Errorf("matches() of another record type = nil, want error")
+	}
+}
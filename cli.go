@@ -8,12 +8,16 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/url"
 	"os"
 	"os/signal"
-	"runtime"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
 )
 
 // Config holds all CLI configuration
@@ -22,21 +26,106 @@ type Config struct {
 	ResolversFile string
 	SitesFile     string
 
+	// Config file and profile. Servers and Domains come from the file and
+	// are used unless -f or -s is given.
+	ConfigFile string
+	Profile    string
+	Servers    []bench.DNSServer
+	Domains    []string
+
 	// Test setup
 	LookupTimeout      time.Duration
 	Repeats            int
 	OnlyMajorResolvers bool
 	MaxConcurrency     int
+	Retry              bench.RetryPolicy
+
+	// Dead resolver handling
+	PreflightTimeout time.Duration
+	BreakerThreshold int
+
+	// Budgets. MaxQueries and MaxTime apply per resolver, RunQueries and
+	// RunTime to the whole run. When any is set queries are paced across the
+	// window instead of repeated -n times.
+	MaxQueries int
+	MaxTime    time.Duration
+	RunQueries int
+	RunTime    time.Duration
+	QPS        float64
+
+	// Adaptive sampling
+	Adaptive bool
+	TargetCI time.Duration
+
+	// Network baseline: round-trip probes per resolver, zero disables them
+	RTTProbes int
+	RTTMethod bench.RTTMethod
+
+	// IPFamily selects IPv4 and/or IPv6 resolvers
+	IPFamily IPFamily
+
+	// QType is the type of the records queried
+	QType bench.QType
 
 	// Output and logging
 	OutputType OutputType
 	LogType    LogType
 
+	// Ranking
+	ScoreWeights bench.ScoreWeights
+	SortBy       SortOrder
+
 	WarmupRuns int
 
-	// Web UI
-	ServeUI    bool
+	// Seed of the retry backoff jitter; zero picks a random seed per run.
+	Seed uint64
+
+	// HTTP server of the serve and monitor commands, DNS listener of proxy
 	ListenAddr string
+
+	// Agent mode: the central server to poll, the vantage point name of this
+	// agent, and the token agents present to the central server. The token is
+	// a shared secret and never part of the manifest.
+	AgentServer string
+	AgentName   string
+	AgentPoll   time.Duration
+	AgentToken  string `json:"-"`
+
+	// Thresholds checked after the run
+	SLO       SLO
+	SLOReport string
+
+	// Directory of the checkpoints of runs in progress, and whether to
+	// continue one
+	CheckpointDir string
+	Resume        bool
+
+	// Raw export of every query, NDJSON or CSV
+	SamplesFile string
+
+	// Recorded queries replayed instead of the domains, and how they are
+	// paced. The queries themselves are left out of the manifest.
+	WorkloadFile string
+	Pacing       bench.Pacing
+	Workload     []bench.WorkloadQuery `json:"-"`
+
+	// Packet capture of every query and response, pcap or dnstap
+	CaptureFile string
+
+	// Run history
+	HistoryDir string
+	Retention  RetentionPolicy
+
+	// Proxy mode: how queries are spread over the upstreams, which
+	// resolvers to forward to, and how often the table is printed.
+	ProxyMode      bench.ProxyMode
+	Upstreams      []string
+	ReportInterval time.Duration
+
+	// Monitoring
+	MonitorInterval time.Duration
+	MonitorCron     string
+	MonitorWindow   int
 }
 
 type OutputType int
@@ -61,6 +150,17 @@ func (o OutputType) String() string {
 	}
 }
 
+// MarshalText writes the output type by name in manifests.
+func (o OutputType) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *OutputType) UnmarshalText(b []byte) error {
+	v, err := parseOutputType(string(b))
+	*o = v
+	return err
+}
+
 type LogType int
 
 const (
@@ -80,6 +180,17 @@ func (l LogType) String() string {
 	}
 }
 
+// MarshalText writes the log type by name in manifests.
+func (l LogType) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *LogType) UnmarshalText(b []byte) error {
+	v, err := parseLogType(string(b))
+	*l = v
+	return err
+}
+
 func run(ctx context.Context, config *Config) error {
 	ctx, cancel := signal.NotifyContext(
 		ctx,
@@ -89,7 +200,7 @@ func run(ctx context.Context, config *Config) error {
 	defer cancel()
 
 	// Load domain list
-	domains, err := loadDomains(config.SitesFile)
+	domains, err := config.domains()
 	if err != nil {
 		return fmt.Errorf("loading domains: %w", err)
 	}
@@ -97,7 +208,7 @@ func run(ctx context.Context, config *Config) error {
 	slog.LogAttrs(ctx, slog.LevelInfo, "Loaded domains", slog.Int("count", len(domains)))
 
 	// Load DNS servers
-	servers, err := loadServers(config.ResolversFile, config.OnlyMajorResolvers)
+	servers, err := config.servers()
 	if err != nil {
 		return fmt.Errorf("loading servers: %w", err)
 	}
@@ -105,120 +216,527 @@ func run(ctx context.Context, config *Config) error {
 	slog.LogAttrs(ctx, slog.LevelInfo, "Loaded DNS servers", slog.Int("count", len(servers)))
 
 	// Run benchmark
-	results, err := runBenchmark(ctx, config, servers, domains, NoopReporter{})
+	manifest := newManifest(config)
+	checkpoint, prior, err := startCheckpoint(config, manifest, servers, domains)
 	if err != nil {
-		return fmt.Errorf("benchmark run failed: %w", err)
+		return err
 	}
+	var sinks []bench.SampleReporter
+	if checkpoint != nil {
+		sinks = append(sinks, checkpoint)
+	}
+	if config.SamplesFile != "" {
+		export, err := createSampleExport(config.SamplesFile, config.QType)
+		if err != nil {
+			if checkpoint != nil {
+				_ = checkpoint.Close() //nolint:errcheck // nothing measured yet
+			}
+			return err
+		}
+		defer func() { _ = export.Close() }() //nolint:errcheck // every line is already written
+		sinks = append(sinks, export)
+	}
+	reporter := bench.BenchmarkReporter(sampleTee{reporters: sinks})
+	opts := []bench.Option{bench.WithResume(prior)}
+	if config.CaptureFile != "" {
+		capture, err := createCapture(config.CaptureFile)
+		if err != nil {
+			if checkpoint != nil {
+				_ = checkpoint.Close() //nolint:errcheck // nothing measured yet
+			}
+			return err
+		}
+		defer func() {
+			if err := capture.Close(); err != nil {
+				slog.LogAttrs(ctx, slog.LevelWarn, "Could not write capture", logattr.Err(err))
+			}
+		}()
+		opts = append(opts, bench.WithCapture(capture.CaptureWriter))
+	}
+
+	results, err := runBenchmark(ctx, config, manifest, servers, domains, reporter, opts...)
+	if err != nil {
+		if checkpoint != nil {
+			_ = checkpoint.Close() //nolint:errcheck // every line is already written
+		}
+		if ctx.Err() == nil || len(results) == 0 {
+			return fmt.Errorf("benchmark run failed: %w", err)
+		}
+		manifest.Partial = true
+		printSummary(results, config.OutputType, config.SortBy, manifest)
+		if checkpoint != nil {
+			fmt.Fprintf(os.Stderr, "\nRun interrupted. Continue it by repeating the command with -resume.\n")
+		}
+		return errInterrupted
+	}
+	if checkpoint != nil {
+		if err := checkpoint.Remove(); err != nil {
+			slog.LogAttrs(ctx, slog.LevelWarn, "Could not remove checkpoint", logattr.Err(err))
+		}
+	}
+
+	recordRun(ctx, config, SourceCLI, manifest, servers, domains, results)
 
 	// Print summary
-	printSummary(results, config.OutputType)
+	printSummary(results, config.OutputType, config.SortBy, manifest)
+
+	if config.SLO.enabled() {
+		verdict := evaluateSLO(results, &config.SLO, config.SortBy)
+		if err := reportVerdict(verdict, config.SLOReport); err != nil {
+			return err
+		}
+		if !verdict.Passed {
+			return errSLOBreached
+		}
+	}
 
 	return nil
 }
 
-func parseFlags() *Config {
-	var config Config
+// runBenchmark runs the benchmark library with the settings from config and
+// the seed of manifest, and records when the run finished. Resolvers of an
+// address family the host cannot reach are left out as set by -ip and
+// recorded in the manifest. opts are applied last.
+func runBenchmark(ctx context.Context, config *Config, manifest *Manifest, servers []bench.DNSServer, domains []string, reporter bench.BenchmarkReporter, opts ...bench.Option) ([]bench.BenchmarkResult, error) {
+	servers, skipped, err := selectFamilies(servers, config.IPFamily, manifest.Network)
+	if err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		manifest.Skipped = skipped
+		slog.LogAttrs(ctx, slog.LevelWarn, "Skipping resolvers the host has no route to",
+			slog.String("family", familyName(skipped[0])),
+			slog.Int("count", len(skipped)),
+		)
+	}
+	opts = append(append(config.benchOptions(), bench.WithSeed(manifest.Seed), bench.WithReporter(reporter)), opts...)
+	results, err := bench.Run(ctx, servers, domains, opts...)
+	manifest.Finished = time.Now()
+	return results, err
+}
 
-	var (
-		outputType string
-		logType    string
-		warmupRuns int
-		serveUI    bool
-		listenAddr string
-	)
+func (c *Config) benchOptions() []bench.Option {
+	opts := []bench.Option{
+		bench.WithTimeout(c.LookupTimeout),
+		bench.WithRepeats(c.Repeats),
+		bench.WithConcurrency(c.MaxConcurrency),
+		bench.WithRetry(c.Retry),
+		bench.WithWarmup(c.WarmupRuns),
+		bench.WithPreflight(c.PreflightTimeout),
+		bench.WithBreaker(c.BreakerThreshold),
+		bench.WithResolverBudget(c.MaxQueries, c.MaxTime),
+		bench.WithRunBudget(c.RunQueries, c.RunTime),
+		bench.WithQPS(c.QPS),
+		bench.WithRTT(c.RTTProbes, c.RTTMethod),
+		bench.WithQType(c.QType),
+		bench.WithScoreWeights(c.ScoreWeights),
+	}
+	if c.Adaptive {
+		opts = append(opts, bench.WithAdaptive(c.TargetCI))
+	}
+	if len(c.Workload) > 0 {
+		opts = append(opts, bench.WithWorkload(c.Workload, c.Pacing))
+	}
+	return opts
+}
 
-	flag.StringVar(&config.ResolversFile, "f", "", "Optional file with extra resolvers (name;ip)")
-	flag.DurationVar(&config.LookupTimeout, "t", 3*time.Second, "Timeout per DNS query (e.g. 1500ms, 2s)")
-	flag.IntVar(&config.Repeats, "n", 10, "Number of times each domain is queried")
-	flag.StringVar(&config.SitesFile, "s", "", "Optional file with domains to test (one domain per line)")
-	flag.StringVar(&outputType, "output", "default", "Output format: default, csv, table, or json")
-	flag.StringVar(&logType, "log", "default", "Logging level: default, verbose, or disabled")
-	flag.IntVar(&config.MaxConcurrency, "c", max(runtime.NumCPU()/2, 2), "Maximum concurrent DNS queries")
-	flag.BoolVar(&config.OnlyMajorResolvers, "major", false, "Benchmark only major DNS resolvers")
-	flag.IntVar(&warmupRuns, "warmup", 0, "Number of warmup queries per resolver/domain before benchmarking")
-	flag.BoolVar(&serveUI, "ui", false, "Start the embedded Web UI dashboard server instead of running the CLI benchmark")
-	flag.StringVar(&listenAddr, "listen", ":8080", "Address for the Web UI HTTP server (used with -ui)")
+// flagGroup registers a set of related flags on fs and returns a function
+// that validates them and stores the parsed values in config.
+type flagGroup func(fs *flag.FlagSet, config *Config) func() error
+
+// parseCommand registers groups on fs, parses args and validates the result.
+// If parsing fails it reports false together with the exit code to use:
+// 0 for -h, 2 for invalid usage and 1 for invalid values.
+func parseCommand(fs *flag.FlagSet, config *Config, args []string, groups ...flagGroup) (int, bool) {
+	validators := make([]func() error, 0, len(groups))
+	for _, group := range groups {
+		validators = append(validators, group(fs, config))
+	}
 
-	flag.Usage = func() {
-		//nolint:errcheck // best-effort help output
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), `DNS Benchmark Tool
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
 
-Test DNS resolvers against popular websites to measure latency and reliability.
+	for _, validate := range validators {
+		if err := validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1, false
+		}
+	}
+	return 0, true
+}
+
+// benchmarkFlags selects resolvers and domains and controls how they are queried.
+func benchmarkFlags(fs *flag.FlagSet, config *Config) func() error {
+	var weights, weightsFile, rttMethod, ipFamily, qtype string
+
+	fs.StringVar(&config.ResolversFile, "f", "", "Optional file with extra resolvers (name;ip)")
+	fs.DurationVar(&config.LookupTimeout, "t", bench.DefaultTimeout, "Timeout per DNS query attempt (e.g. 1500ms, 2s)")
+	fs.IntVar(&config.Retry.Retries, "retries", 0, "Number of retries after a failed query attempt (0 reports first-try results only)")
+	fs.DurationVar(&config.Retry.InitialBackoff, "backoff", 2*time.Second, "Initial backoff between retries")
+	fs.DurationVar(&config.Retry.MaxBackoff, "max-backoff", 60*time.Second, "Maximum backoff between retries")
+	fs.IntVar(&config.Repeats, "n", bench.DefaultRepeats, "Number of times each domain is queried")
+	fs.StringVar(&config.SitesFile, "s", "", "Optional file with domains to test (one domain per line)")
+	fs.IntVar(&config.MaxConcurrency, "c", bench.DefaultConcurrency(), "Maximum concurrent DNS queries")
+	fs.BoolVar(&config.OnlyMajorResolvers, "major", false, "Benchmark only major DNS resolvers")
+	fs.IntVar(&config.WarmupRuns, "warmup", 0, "Number of warmup passes over all domains per resolver before measurement starts")
+	fs.DurationVar(&config.PreflightTimeout, "preflight", bench.DefaultPreflight, "Timeout of the pre-flight reachability probe (0 disables it)")
+	fs.IntVar(&config.BreakerThreshold, "breaker", bench.DefaultBreaker, "Give up on a resolver after this many consecutive failures (0 disables it)")
+	fs.BoolVar(&config.Adaptive, "adaptive", false, "Query each resolver until the median is precise enough instead of a fixed -n")
+	fs.DurationVar(&config.TargetCI, "target-ci", bench.DefaultTargetCI, "Adaptive mode: target width of the 95% confidence interval of the median")
+	fs.IntVar(&config.MaxQueries, "max-queries", 0, "Query budget per resolver; replaces -n (adaptive mode: cap, default -n x number of domains)")
+	fs.DurationVar(&config.MaxTime, "max-time", 0, "Wall-clock duration per resolver; replaces -n (adaptive mode: cap)")
+	fs.IntVar(&config.RunQueries, "run-queries", 0, "Query budget for the whole run, split evenly across resolvers")
+	fs.DurationVar(&config.RunTime, "run-time", 0, "Wall-clock duration of the whole run, split evenly across resolvers (e.g. 8h)")
+	fs.Float64Var(&config.QPS, "qps", bench.DefaultQPS, "Queries per second per resolver for duration-based runs without a query budget")
+	fs.IntVar(&config.RTTProbes, "rtt", bench.DefaultRTTProbes, "Network round-trip probes per resolver, to separate resolver processing time from distance (0 disables them)")
+	fs.StringVar(&rttMethod, "rtt-method", string(bench.RTTTCP), "How round trips are measured: tcp (connect to the DNS port) or icmp (echo, needs raw-socket privileges)")
+	fs.StringVar(&qtype, "qtype", "A", "Record type to query: A, AAAA, CNAME, MX, NS, TXT, SOA, PTR, SRV, SVCB or HTTPS")
+	fs.StringVar(&ipFamily, "ip", string(IPAuto), "Address families of the resolvers: auto (those this host has a route for), 4, 6 or both")
+	fs.StringVar(&weights, "weights", "", "Composite score weights, e.g. success=0.4,median=0.3,p95=0.2,jitter=0.1")
+	fs.StringVar(&weightsFile, "weights-file", "", "Optional JSON file with composite score weights")
+	fs.Uint64Var(&config.Seed, "seed", 0, "Seed of the retry backoff jitter (0 picks a random seed, recorded in the run manifest)")
+
+	return func() error {
+		switch {
+		case config.Repeats < 1:
+			return errors.New("repeats must be at least 1")
+		case config.MaxConcurrency < 1:
+			return errors.New("concurrency must be at least 1")
+		case config.LookupTimeout < 100*time.Millisecond:
+			return errors.New("timeout must be at least 100ms")
+		case config.WarmupRuns < 0:
+			return errors.New("warmup must not be negative")
+		case config.PreflightTimeout < 0 || config.BreakerThreshold < 0:
+			return errors.New("preflight and breaker must not be negative")
+		case config.RTTProbes < 0:
+			return errors.New("rtt must not be negative")
+		}
+		if err := config.Retry.Validate(); err != nil {
+			return err
+		}
+		method, err := bench.ParseRTTMethod(rttMethod)
+		if err != nil {
+			return err
+		}
+		config.RTTMethod = method
+		if config.IPFamily, err = parseIPFamily(ipFamily); err != nil {
+			return err
+		}
+		if config.QType, err = bench.ParseQType(qtype); err != nil {
+			return err
+		}
+		if err := validateBudgets(config); err != nil {
+			return err
+		}
 
-Usage:
-  dnsbench [options]
+		config.ScoreWeights = bench.DefaultScoreWeights
+		if weightsFile != "" {
+			w, err := loadScoreWeights(weightsFile)
+			if err != nil {
+				return err
+			}
+			config.ScoreWeights = w
+		}
+		if weights != "" {
+			w, err := parseScoreWeights(weights)
+			if err != nil {
+				return err
+			}
+			config.ScoreWeights = w
+		}
+		return nil
+	}
+}
 
-Options:
-`)
-		flag.PrintDefaults()
-		//nolint:errcheck // best-effort help output
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), `
-Examples:
-  # Default benchmark
-  dnsbench
+// logFlags sets the logging level.
+func logFlags(fs *flag.FlagSet, config *Config) func() error {
+	logType := fs.String("log", "default", "Logging level: default, verbose, or disabled")
 
-  # Test with more repeats and longer timeout
-  dnsbench -n 20 -t 3s
+	return func() error {
+		l, err := parseLogType(*logType)
+		config.LogType = l
+		return err
+	}
+}
 
-  # Use custom resolver list and increase concurrency
-  dnsbench -f myresolvers.txt -c 10
+// outputFlags sets how results are printed and ranked.
+func outputFlags(fs *flag.FlagSet, config *Config) func() error {
+	outputType := fs.String("output", "default", "Output format: default, csv, table, or json")
+	sortBy := fs.String("sort", "default", "Ranking order: default (success rate, then mean) or score")
 
-  # Benchmark with custom domain list
-  dnsbench -s mydomains.txt
-`)
+	return func() error {
+		output, err := parseOutputType(*outputType)
+		if err != nil {
+			return err
+		}
+		order, err := parseSortOrder(*sortBy)
+		if err != nil {
+			return err
+		}
+		config.OutputType, config.SortBy = output, order
+		return nil
 	}
+}
 
-	flag.Parse()
+// sloFlags sets the thresholds checked after a run.
+func sloFlags(fs *flag.FlagSet, config *Config) func() error {
+	var sloRank, sloScope string
 
-	// Validate configuration
-	if config.Repeats < 1 {
-		fmt.Fprintf(os.Stderr, "Error: repeats must be at least 1\n")
-		os.Exit(1)
+	fs.DurationVar(&config.SLO.MaxMedian, "slo-median", 0, "SLO: maximum median latency per resolver (e.g. 30ms)")
+	fs.DurationVar(&config.SLO.MaxP95, "slo-p95", 0, "SLO: maximum p95 latency per resolver (e.g. 80ms)")
+	fs.Float64Var(&config.SLO.MinSuccess, "slo-success", 0, "SLO: minimum success rate per resolver in percent (e.g. 99.5)")
+	fs.StringVar(&sloRank, "slo-rank", "", "SLO: resolvers that must rank in the top N, e.g. Internal-1=1,Internal-2=3")
+	fs.StringVar(&sloScope, "slo-resolvers", "", "SLO: comma-separated names or addresses the median, p95 and success checks apply to (default all)")
+	fs.StringVar(&config.SLOReport, "slo-report", "", "SLO: write the JSON verdict to this file (- for stdout)")
+
+	return func() error {
+		if config.SLO.MaxMedian < 0 || config.SLO.MaxP95 < 0 || config.SLO.MinSuccess < 0 || config.SLO.MinSuccess > 100 {
+			return errors.New("SLO latencies must not be negative and slo-success must be between 0 and 100")
+		}
+		if sloRank != "" {
+			ranks, err := parseRankSLO(sloRank)
+			if err != nil {
+				return err
+			}
+			config.SLO.MaxRank = ranks
+		}
+		for name := range strings.SplitSeq(sloScope, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.SLO.Resolvers = append(config.SLO.Resolvers, name)
+			}
+		}
+		// outputFlags is validated first. A verdict on stdout after JSON or
+		// CSV results would leave neither parseable.
+		if config.SLOReport == "-" && (config.OutputType == OutputJSON || config.OutputType == OutputCSV) {
+			return fmt.Errorf("slo-report - cannot be combined with -output %s, which also writes to stdout; write the verdict to a file", config.OutputType)
+		}
+		return nil
+	}
+}
+
+// historyFlags sets where runs are stored and how long they are kept.
+func historyFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.HistoryDir, "history", defaultHistoryDir(), "Directory where runs are stored (empty disables run history)")
+	fs.IntVar(&config.Retention.MaxRuns, "keep", 100, "Number of most recent runs kept in the history (0 keeps all)")
+	fs.DurationVar(&config.Retention.MaxAge, "keep-for", 0, "Delete stored runs older than this (e.g. 720h, 0 keeps all)")
+
+	return func() error {
+		if config.Retention.MaxRuns < 0 || config.Retention.MaxAge < 0 {
+			return errors.New("keep and keep-for must not be negative")
+		}
+		return nil
+	}
+}
+
+// checkpointFlags sets where a run saves its progress and whether it
+// continues an interrupted run.
+func checkpointFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.CheckpointDir, "checkpoint", defaultCheckpointDir(), "Directory where each run saves its completed samples while it runs, one file per set of resolvers, domains, record type and sampling options (empty disables it)")
+	fs.BoolVar(&config.Resume, "resume", false, "Continue the interrupted run with the same resolvers, domains, record type and sampling options")
+
+	return func() error {
+		if config.Resume && config.CheckpointDir == "" {
+			return errors.New("resume requires a checkpoint directory")
+		}
+		return nil
+	}
+}
+
+// samplesFlags sets the file every query of a run is exported to.
+func samplesFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.SamplesFile, "samples", "", "File to write every query to as it completes: NDJSON, or CSV if the name ends in .csv")
+
+	return func() error {
+		if strings.EqualFold(filepath.Ext(config.SamplesFile), ".parquet") {
+			return errors.New("parquet sample exports are not supported: use .ndjson or .csv")
+		}
+		return nil
+	}
+}
+
+// captureFlags sets the file the traffic of a run is captured to.
+func captureFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.CaptureFile, "capture", "", "File to write every query and response to: dnstap if the name ends in .dnstap, .fstrm or .tap, pcap otherwise")
+
+	return func() error {
+		if config.CaptureFile == "" {
+			return nil
+		}
+		_, err := captureFormat(config.CaptureFile)
+		return err
+	}
+}
+
+// workloadFlags sets the capture replayed instead of the domains.
+func workloadFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.WorkloadFile, "workload", "", "pcap, pcapng or dnstap capture whose queries are replayed against every resolver instead of the domains")
+	pacing := fs.String("pacing", string(bench.PacingFast), "How the workload is replayed: fast (as fast as -c allows) or original (at the recorded times)")
+
+	return func() error {
+		p, err := bench.ParsePacing(*pacing)
+		if err != nil {
+			return err
+		}
+		config.Pacing = p
+		if config.WorkloadFile == "" {
+			return nil
+		}
+		if config.SitesFile != "" {
+			return errors.New("workload replaces the domains: do not combine it with -s")
+		}
+		config.Workload, err = loadWorkload(config.WorkloadFile)
+		return err
+	}
+}
+
+func loadWorkload(path string) ([]bench.WorkloadQuery, error) {
+	//nolint:gosec // file path provided by user intentionally
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening workload: %w", err)
+	}
+	defer func() { _ = file.Close() }() //nolint:errcheck // read-only
+
+	queries, err := bench.ReadWorkload(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading workload %s: %w", path, err)
 	}
+	slog.Info("Loaded workload",
+		slog.String("path", path),
+		slog.Int("queries", len(queries)),
+		slog.Int("names", len(bench.WorkloadNames(queries))),
+		slog.Duration("duration", queries[len(queries)-1].At),
+	)
+	return queries, nil
+}
+
+// listenFlags sets the address of the HTTP server.
+func listenFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.ListenAddr, "listen", ":8080", "Address of the HTTP server")
+	fs.StringVar(&config.AgentToken, "agent-token", "", "Token agents must present to report results, also required to queue agent jobs (empty accepts any agent)")
+
+	return func() error {
+		if config.ListenAddr == "" {
+			return errors.New("listen address must not be empty")
+		}
+		return nil
+	}
+}
+
+// agentFlags sets the central server an agent reports to and its name.
+func agentFlags(fs *flag.FlagSet, config *Config) func() error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+	fs.StringVar(&config.AgentServer, "server", "", "URL of the central dnsbench serve instance, e.g. http://bench.example.com:8080")
+	fs.StringVar(&config.AgentName, "name", hostname, "Name of this vantage point, e.g. office-berlin")
+	fs.DurationVar(&config.AgentPoll, "poll", 10*time.Second, "Time between polls for new jobs")
+	fs.StringVar(&config.AgentToken, "agent-token", "", "Token presented to the central server")
+
+	return func() error {
+		u, err := url.Parse(config.AgentServer)
+		switch {
+		case config.AgentServer == "":
+			return errors.New("server is required")
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			return fmt.Errorf("server must be an http:// or https:// URL, got %q", config.AgentServer)
+		case !agentNamePattern.MatchString(config.AgentName):
+			return fmt.Errorf("invalid agent name %q: use letters, digits, '.', '_' and '-'", config.AgentName)
+		case config.AgentPoll < time.Second:
+			return errors.New("poll must be at least 1s")
+		}
+		config.AgentServer = strings.TrimSuffix(config.AgentServer, "/")
+		return nil
+	}
+}
+
+// monitorFlags sets the schedule and window of monitor mode.
+func monitorFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.DurationVar(&config.MonitorInterval, "interval", 5*time.Minute, "Time between benchmark cycles")
+	fs.StringVar(&config.MonitorCron, "cron", "", "Cron expression for cycles, e.g. \"*/15 * * * *\" (overrides -interval)")
+	fs.IntVar(&config.MonitorWindow, "window", 12, "Number of cycles kept in the rolling window")
 
-	if config.MaxConcurrency < 1 {
-		fmt.Fprintf(os.Stderr, "Error: concurrency must be at least 1\n")
-		os.Exit(1)
+	return func() error {
+		if config.MonitorInterval < time.Second && config.MonitorCron == "" {
+			return errors.New("interval must be at least 1s")
+		}
+		if config.MonitorWindow < 1 {
+			return errors.New("window must be at least 1")
+		}
+		if config.MonitorCron != "" {
+			if _, err := parseCron(config.MonitorCron); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+}
 
-	if config.LookupTimeout < 100*time.Millisecond {
-		fmt.Fprintf(os.Stderr, "Error: timeout must be at least 100ms\n")
-		os.Exit(1)
+func parseLogType(s string) (LogType, error) {
+	switch strings.ToLower(s) {
+	case "default":
+		return LogDefault, nil
+	case "verbose":
+		return LogVerbose, nil
+	case "disabled":
+		return LogDisabled, nil
+	default:
+		return LogDefault, fmt.Errorf("invalid log type %q", s)
 	}
+}
 
-	// Parse output type
-	switch strings.ToLower(outputType) {
+func parseOutputType(s string) (OutputType, error) {
+	switch strings.ToLower(s) {
 	case "default":
-		config.OutputType = OutputDefault
+		return OutputDefault, nil
 	case "csv":
-		config.OutputType = OutputCSV
+		return OutputCSV, nil
 	case "table":
-		config.OutputType = OutputTable
+		return OutputTable, nil
 	case "json":
-		config.OutputType = OutputJSON
+		return OutputJSON, nil
 	default:
-		fmt.Fprintf(os.Stderr, "Error: invalid output type %q\n", outputType)
-		os.Exit(1)
+		return OutputDefault, fmt.Errorf("invalid output type %q", s)
 	}
+}
 
-	config.WarmupRuns = warmupRuns
-	config.ServeUI = serveUI
-	config.ListenAddr = listenAddr
+func validateBudgets(config *Config) error {
+	if config.MaxQueries < 0 || config.MaxTime < 0 || config.RunQueries < 0 || config.RunTime < 0 {
+		return errors.New("query and time budgets must not be negative")
+	}
+	if config.QPS < 0 {
+		return errors.New("qps must not be negative")
+	}
+	if config.Adaptive && config.TargetCI <= 0 {
+		return errors.New("target-ci must be positive")
+	}
+	return nil
+}
 
-	// Parse log type
-	switch strings.ToLower(logType) {
-	case "default":
-		config.LogType = LogDefault
-	case "verbose":
-		config.LogType = LogVerbose
-	case "disabled":
-		config.LogType = LogDisabled
-	default:
-		fmt.Fprintf(os.Stderr, "Error: invalid log type %q\n", logType)
-		os.Exit(1)
+// domains returns the domains to query: the names of the workload, or from
+// -s, the config file, or the built-in list.
+func (c *Config) domains() ([]string, error) {
+	if len(c.Workload) > 0 {
+		return bench.WorkloadNames(c.Workload), nil
+	}
+	if c.SitesFile == "" && len(c.Domains) > 0 {
+		return c.Domains, nil
 	}
+	return loadDomains(c.SitesFile)
+}
 
-	return &config
+// servers returns the resolvers to benchmark: from -f, the config file, or
+// the built-in list.
+func (c *Config) servers() ([]bench.DNSServer, error) {
+	if c.ResolversFile == "" && len(c.Servers) > 0 {
+		return c.Servers, nil
+	}
+	return loadServers(c.ResolversFile, c.OnlyMajorResolvers)
 }
 
 func loadDomains(sitesFile string) ([]string, error) {
@@ -275,8 +793,8 @@ func loadDomains(sitesFile string) ([]string, error) {
 // loadServers loads DNS servers from a file or uses built-in resolvers.
 // Format: name;ip per line. Comments start with #.
 // If resolversFile is empty, built-in resolvers are used based on onlyMajor flag.
-func loadServers(resolversFile string, onlyMajor bool) ([]DNSServer, error) {
-	servers := make([]DNSServer, 0)
+func loadServers(resolversFile string, onlyMajor bool) ([]bench.DNSServer, error) {
+	servers := make([]bench.DNSServer, 0)
 
 	if resolversFile == "" {
 		if onlyMajor {
@@ -326,7 +844,7 @@ func loadServers(resolversFile string, onlyMajor bool) ([]DNSServer, error) {
 			return nil, fmt.Errorf("invalid IP address at line %d: %s", lineNum, addr)
 		}
 
-		servers = append(servers, DNSServer{Name: name, Addr: addr})
+		servers = append(servers, bench.DNSServer{Name: name, Addr: addr})
 	}
 
 	if err := scanner.Err(); err != nil {
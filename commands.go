@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// command is a subcommand of dnsbench.
+type command struct {
+	name    string
+	args    string // arguments shown in the usage line
+	summary string
+	run     func(ctx context.Context, args []string) int
+}
+
+func commands() []command {
+	return []command{
+		{"run", "[options]", "Benchmark resolvers and print a summary (default)", runCommand},
+		{"serve", "[options]", "Start the Web UI dashboard", serveCommand},
+		{"monitor", "[options]", "Repeat the benchmark on a schedule and serve the state over HTTP", monitorCommand},
+		{"agent", "-server <url> [options]", "Run jobs from a central serve instance and report the results", agentCommand},
+		{"compare", "[options] <before> <after>", "Compare two runs per resolver", func(_ context.Context, args []string) int {
+			return runCompareCommand(args)
+		}},
+		{"history", "<list|show|delete|prune> [options]", "Manage stored runs", func(_ context.Context, args []string) int {
+			return runHistoryCommand(args)
+		}},
+		{"snippets", "[options] [run]", "Print resolver configuration for the best resolvers of a run", func(_ context.Context, args []string) int {
+			return runSnippetsCommand(args)
+		}},
+		{"proxy", "[options]", "Forward local DNS queries to upstream resolvers and measure them on live traffic", proxyCommand},
+		{"query", "[options] <domain>...", "Query one resolver and print each answer", queryCommand},
+		{"probe", "[options]", "Check which resolvers are reachable", probeCommand},
+	}
+}
+
+// dispatch runs the command named by the first argument and returns the exit
+// code. Arguments that start with a flag run the benchmark, so invocations
+// from before subcommands existed keep working.
+func dispatch(ctx context.Context, args []string) int {
+	initLogger(LogDefault)
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return legacyCommand(ctx, args)
+	}
+
+	name := args[0]
+	if name == "help" {
+		if len(args) == 1 {
+			printUsage(os.Stdout)
+			return 0
+		}
+		name, args = args[1], []string{args[1], "-h"}
+	}
+
+	for _, c := range commands() {
+		if c.name == name {
+			return c.run(ctx, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	//nolint:errcheck // best-effort help output
+	_, _ = fmt.Fprintf(w, `DNS Benchmark Tool
+
+Test DNS resolvers against popular websites to measure latency and reliability.
+
+Usage:
+  dnsbench <command> [options]
+  dnsbench [options]              same as dnsbench run [options]
+
+Commands:
+`)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	_ = tw.Flush() //nolint:errcheck // best-effort help output
+
+	//nolint:errcheck // best-effort help output
+	_, _ = fmt.Fprintf(w, `
+Run "dnsbench help <command>" or "dnsbench <command> -h" for the options of a command.
+
+Exit codes:
+  0    success
+  1    error
+  2    invalid usage
+  3    an SLO threshold was breached
+  130  interrupted; partial results were printed
+
+Examples:
+  # Default benchmark
+  dnsbench run
+
+  # Test with more repeats and longer timeout
+  dnsbench run -n 20 -t 3s
+
+  # Retry failed queries up to 3 times, backing off from 500ms
+  dnsbench run -retries 3 -backoff 500ms
+
+  # Use custom resolver list and increase concurrency
+  dnsbench run -f myresolvers.txt -c 10
+
+  # Rank by a composite score that cares mostly about tail latency
+  dnsbench run -sort score -weights success=0.3,p95=0.5,jitter=0.2
+
+  # Sample until the median is known within 1ms, at most 2000 queries per resolver
+  dnsbench run -adaptive -target-ci 1ms -max-queries 2000
+
+  # Write every query and response of a run to a pcap file for Wireshark
+  dnsbench run -major -capture run.pcap
+
+  # Replay the queries of a capture against the major resolvers at their original pace
+  dnsbench run -major -workload office.pcap -pacing original
+
+  # Compare the major resolvers overnight, spreading 20000 queries over 8 hours
+  dnsbench run -major -run-time 8h -run-queries 20000
+
+  # Fail a CI job if any internal resolver is slow or unreliable
+  dnsbench run -f internal.txt -slo-p95 50ms -slo-success 99.5 -slo-rank Internal-1=1 -slo-report verdict.json
+
+  # Open the dashboard on another port
+  dnsbench serve -listen :9090
+
+  # Monitor the major resolvers every 15 minutes, state at http://localhost:8080/api/monitor
+  dnsbench monitor -major -n 1 -cron "*/15 * * * *"
+
+  # Run jobs queued on a central server from this office
+  dnsbench agent -server http://bench.example.com:8080 -name office-berlin
+
+  # List stored runs and show one of them again
+  dnsbench history list
+  dnsbench history show 20250106-100730.123456
+
+  # Compare two runs, from -output json files or stored run IDs
+  dnsbench compare -output markdown before.json after.json
+
+  # Write configuration for the recommended resolver pair of the latest run
+  dnsbench snippets -format systemd-resolved,unbound -dot -o ./dns-config
+
+  # Serve DNS on port 5353 through the fastest of three upstreams, exporting every query
+  dnsbench proxy -listen 127.0.0.1:5353 -upstreams Cloudflare-1,Google-1,Quad9-1 -samples live.ndjson
+
+  # Query a single resolver by name or address
+  dnsbench query -server Cloudflare-1 -n 5 example.com
+
+  # Check which resolvers from a file are reachable
+  dnsbench probe -f myresolvers.txt
+`)
+}
+
+// newCommandFlagSet returns a flag set whose help names the command.
+func newCommandFlagSet(name, args, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		//nolint:errcheck // best-effort help output
+		_, _ = fmt.Fprintf(fs.Output(), "Usage:\n  dnsbench %s %s\n\n%s.\n\nOptions:\n", name, args, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// noArgs reports extra positional arguments, which usually mean a flag was
+// placed after them.
+func noArgs(fs *flag.FlagSet) (int, bool) {
+	if fs.NArg() == 0 {
+		return 0, true
+	}
+	fmt.Fprintf(os.Stderr, "Error: unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+	return 2, false
+}
+
+func runCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("run", "[options]", "Benchmark resolvers and print a summary")
+	if code, ok := parseCommand(fs, &config, args, configFlags, benchmarkFlags, logFlags, outputFlags, sloFlags, historyFlags, checkpointFlags, samplesFlags, captureFlags, workloadFlags); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+	return runBenchmarkCommand(ctx, &config)
+}
+
+func serveCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("serve", "[options]", "Start the Web UI dashboard. The benchmark options set the defaults of the form")
+	if code, ok := parseCommand(fs, &config, args, configFlags, benchmarkFlags, logFlags, historyFlags, listenFlags); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+	return serveCommandConfig(ctx, &config)
+}
+
+func monitorCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("monitor", "[options]", "Repeat the benchmark on a schedule and serve the state over HTTP")
+	if code, ok := parseCommand(fs, &config, args, configFlags, benchmarkFlags, logFlags, historyFlags, listenFlags, monitorFlags); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+	return monitorCommandConfig(ctx, &config)
+}
+
+// legacyCommand accepts the flags of dnsbench before subcommands existed:
+// the run options plus -ui and -monitor, which switch to serve and monitor.
+func legacyCommand(ctx context.Context, args []string) int {
+	var (
+		config  Config
+		serveUI bool
+		monitor bool
+	)
+	fs := flag.NewFlagSet("dnsbench", flag.ContinueOnError)
+	fs.Usage = func() {
+		printUsage(fs.Output())
+		//nolint:errcheck // best-effort help output
+		_, _ = fmt.Fprintf(fs.Output(), "\nOptions without a command (see dnsbench run -h):\n")
+		fs.PrintDefaults()
+	}
+	legacy := func(fs *flag.FlagSet, _ *Config) func() error {
+		fs.BoolVar(&serveUI, "ui", false, "Deprecated: use dnsbench serve")
+		fs.BoolVar(&monitor, "monitor", false, "Deprecated: use dnsbench monitor")
+		return func() error { return nil }
+	}
+	if code, ok := parseCommand(fs, &config, args,
+		configFlags, benchmarkFlags, logFlags, outputFlags, sloFlags, historyFlags, checkpointFlags, samplesFlags, captureFlags, workloadFlags, listenFlags, monitorFlags, legacy); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+
+	switch {
+	case monitor:
+		return monitorCommandConfig(ctx, &config)
+	case serveUI:
+		return serveCommandConfig(ctx, &config)
+	default:
+		return runBenchmarkCommand(ctx, &config)
+	}
+}
+
+func runBenchmarkCommand(ctx context.Context, config *Config) int {
+	initLogger(config.LogType)
+
+	slog.LogAttrs(ctx, slog.LevelDebug, "Starting", slog.Any("config", fmt.Sprintf("%#v", config)))
+	if err := run(ctx, config); err != nil {
+		if errors.Is(err, errSLOBreached) {
+			return exitSLOBreached
+		}
+		if errors.Is(err, errInterrupted) {
+			return exitInterrupted
+		}
+		slog.ErrorContext(ctx, "Benchmark failed", logattr.Err(err))
+		return 1
+	}
+	return 0
+}
+
+func serveCommandConfig(ctx context.Context, config *Config) int {
+	initLogger(config.LogType)
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := serveDashboard(ctx, config, nil); err != nil {
+		slog.ErrorContext(ctx, "UI server failed", logattr.Err(err))
+		return 1
+	}
+	return 0
+}
+
+func monitorCommandConfig(ctx context.Context, config *Config) int {
+	initLogger(config.LogType)
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := runMonitor(ctx, config); err != nil {
+		slog.ErrorContext(ctx, "Monitor failed", logattr.Err(err))
+		return 1
+	}
+	return 0
+}
+
+func agentCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("agent", "-server <url> [options]", "Poll a central dnsbench serve instance for jobs, run them and stream the results back. The benchmark options are the defaults jobs override")
+	if code, ok := parseCommand(fs, &config, args, configFlags, benchmarkFlags, logFlags, agentFlags); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+	initLogger(config.LogType)
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := runAgent(ctx, &config); err != nil {
+		slog.ErrorContext(ctx, "Agent failed", logattr.Err(err))
+		return 1
+	}
+	return 0
+}
+
+func queryCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("query", "[options] <domain>...", "Query one resolver and print the latency of each answer")
+	server := fs.String("server", "1.1.1.1", "Resolver to query: an IP address or the name of a built-in resolver")
+	count := fs.Int("n", 1, "Number of queries per domain")
+	qtype := fs.String("qtype", "A", "Record type to query, e.g. A, AAAA, MX or HTTPS")
+	fs.DurationVar(&config.LookupTimeout, "t", bench.DefaultTimeout, "Timeout per query attempt")
+	fs.IntVar(&config.Retry.Retries, "retries", 0, "Number of retries after a failed query attempt")
+	fs.DurationVar(&config.Retry.InitialBackoff, "backoff", 200*time.Millisecond, "Initial backoff between retries")
+	fs.DurationVar(&config.Retry.MaxBackoff, "max-backoff", 2*time.Second, "Maximum backoff between retries")
+	validate := func(*flag.FlagSet, *Config) func() error {
+		return func() error {
+			if *count < 1 {
+				return errors.New("n must be at least 1")
+			}
+			if config.LookupTimeout <= 0 {
+				return errors.New("timeout must be positive")
+			}
+			var err error
+			if config.QType, err = bench.ParseQType(*qtype); err != nil {
+				return err
+			}
+			return config.Retry.Validate()
+		}
+	}
+	if code, ok := parseCommand(fs, &config, args, logFlags, validate); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	initLogger(config.LogType)
+
+	addr, err := resolveServer(*server)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, domain := range fs.Args() {
+		if !isValidDomain(domain) {
+			fmt.Fprintf(os.Stderr, "Error: invalid domain %q\n", domain)
+			return 2
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	resolver := bench.NewResolver(addr, 1)
+	resolver.SetQType(config.QType)
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DOMAIN\tSERVER\tLATENCY\tATTEMPTS\tRCODE\tANSWERS\tERROR")
+	for _, domain := range fs.Args() {
+		for range *count {
+			res, err := resolver.QueryDNS(ctx, domain, config.LookupTimeout, config.Retry)
+			if ctx.Err() != nil {
+				_ = tw.Flush() //nolint:errcheck // interrupted
+				return 1
+			}
+			if err != nil {
+				failed++
+				rcode := res.RCode
+				if rcode == "" {
+					rcode = "-"
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t-\t%d\t%s\t%d\t%v\n", domain, addr, res.Attempts, rcode, res.Answers, err)
+				continue
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%.2fms\t%d\t%s\t%d\t\n", domain, addr, float64(res.Latency.Microseconds())/1000, res.Attempts, res.RCode, res.Answers)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return 1
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// resolveServer returns the address of s, which is either an IP address or
+// the name of a built-in resolver.
+func resolveServer(s string) (string, error) {
+	if net.ParseIP(s) != nil {
+		return s, nil
+	}
+	i := slices.IndexFunc(builtInResolvers, func(d bench.DNSServer) bool { return strings.EqualFold(d.Name, s) })
+	if i < 0 {
+		return "", fmt.Errorf("unknown resolver %q: use an IP address or a built-in resolver name", s)
+	}
+	return builtInResolvers[i].Addr, nil
+}
+
+// ProbeResult is the reachability of one resolver.
+type ProbeResult struct {
+	Server    bench.DNSServer `json:"server"`
+	Reachable bool            `json:"reachable"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+func probeCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("probe", "[options]", "Send one query to every resolver and report which are reachable")
+	fs.StringVar(&config.ResolversFile, "f", "", "Optional file with resolvers to probe (name;ip)")
+	fs.BoolVar(&config.OnlyMajorResolvers, "major", false, "Probe only major DNS resolvers")
+	fs.DurationVar(&config.PreflightTimeout, "t", bench.DefaultPreflight, "Timeout of the probe query")
+	domain := fs.String("domain", defaultSites[0], "Domain to query")
+	ipFamily := fs.String("ip", string(IPAuto), "Address families of the resolvers: auto (those this host has a route for), 4, 6 or both")
+	outputType := fs.String("output", "default", "Output format: default or json")
+	validate := func(*flag.FlagSet, *Config) func() error {
+		return func() error {
+			if config.PreflightTimeout <= 0 {
+				return errors.New("timeout must be positive")
+			}
+			family, err := parseIPFamily(*ipFamily)
+			if err != nil {
+				return err
+			}
+			config.IPFamily = family
+			if !isValidDomain(*domain) {
+				return fmt.Errorf("invalid domain %q", *domain)
+			}
+			output, err := parseOutputType(*outputType)
+			if err != nil {
+				return err
+			}
+			if output != OutputDefault && output != OutputJSON {
+				return fmt.Errorf("probe supports default and json output, not %q", *outputType)
+			}
+			config.OutputType = output
+			return nil
+		}
+	}
+	if code, ok := parseCommand(fs, &config, args, logFlags, validate); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+	initLogger(config.LogType)
+
+	servers, err := loadServers(config.ResolversFile, config.OnlyMajorResolvers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: loading servers: %v\n", err)
+		return 1
+	}
+
+	network := detectNetwork()
+	servers, skipped, err := selectFamilies(servers, config.IPFamily, network)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	unreachable := bench.ProbeResolvers(ctx, servers, *domain, config.PreflightTimeout)
+	if ctx.Err() != nil {
+		return 1
+	}
+
+	results := make([]ProbeResult, 0, len(servers))
+	for _, s := range servers {
+		reason, down := unreachable[s.Endpoint()]
+		results = append(results, ProbeResult{Server: s, Reachable: !down, Reason: reason})
+	}
+	if config.OutputType == OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	} else {
+		err = printProbeTable(os.Stdout, results, skipped, network)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if len(unreachable) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printProbeTable lists the reachability of every resolver. An address
+// family that is unreachable as a whole, or was skipped, is explained in one
+// note instead of a row per resolver.
+func printProbeTable(w io.Writer, results []ProbeResult, skipped []bench.DNSServer, network NetworkInfo) error {
+	servers := make([]bench.DNSServer, 0, len(results))
+	for _, r := range results {
+		servers = append(servers, r.Server)
+	}
+	outages := familyOutages(servers, func(i int) bool { return results[i].Reachable }, network)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "RESOLVER\tADDRESS\tSTATUS")
+	for _, r := range results {
+		if slices.ContainsFunc(outages, func(o familyOutage) bool { return o.Family == familyName(r.Server) }) {
+			continue
+		}
+		status := "reachable"
+		if !r.Reachable {
+			status = "unreachable: " + r.Reason
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Server.Name, r.Server.Endpoint(), status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(skipped) > 0 {
+		if _, err := fmt.Fprintf(w, "Note: %s\n", skippedNote(skipped, network)); err != nil {
+			return err
+		}
+	}
+	for _, o := range outages {
+		if _, err := fmt.Fprintf(w, "Note: %s\n", brokenNote(o, network)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestDispatch_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "Help", args: []string{"help"}, want: 0},
+		{name: "Command help", args: []string{"run", "-h"}, want: 0},
+		{name: "Help for command", args: []string{"help", "probe"}, want: 0},
+		{name: "History help", args: []string{"help", "history"}, want: 0},
+		{name: "Unknown command", args: []string{"bench"}, want: 2},
+		{name: "Unknown flag", args: []string{"run", "-bogus"}, want: 2},
+		{name: "Unexpected argument", args: []string{"run", "example.com"}, want: 2},
+		{name: "Invalid value", args: []string{"run", "-n", "0"}, want: 1},
+		{name: "Legacy invalid value", args: []string{"-n", "0"}, want: 1},
+		{name: "Backoff above max backoff", args: []string{"run", "-retries", "1", "-backoff", "2s", "-max-backoff", "1s"}, want: 1},
+		{name: "Legacy unknown flag", args: []string{"-bogus"}, want: 2},
+		{name: "SLO verdict and JSON on stdout", args: []string{"run", "-slo-p95", "10ms", "-slo-report", "-", "-output", "json"}, want: 1},
+		{name: "Serve rejects run flags", args: []string{"serve", "-slo-p95", "10ms"}, want: 2},
+		{name: "Monitor window", args: []string{"monitor", "-window", "0"}, want: 1},
+		{name: "Query without domain", args: []string{"query"}, want: 2},
+		{name: "Query unknown server", args: []string{"query", "-server", "nope", "example.com"}, want: 1},
+		{name: "Probe output", args: []string{"probe", "-output", "csv"}, want: 1},
+		{name: "Agent without server", args: []string{"agent", "-config", ""}, want: 1},
+		{name: "Agent invalid name", args: []string{"agent", "-config", "", "-server", "http://localhost:8080", "-name", "a b"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dispatch(context.Background(), tt.args); got != tt.want {
+				t.Errorf("dispatch(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommand_RunFlags(t *testing.T) {
+	args := []string{"-n", "5", "-t", "1s", "-sort", "score", "-output", "json", "-slo-rank", "A=1", "-slo-resolvers", "A, B", "-keep", "3"}
+
+	var config Config
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if code, ok := parseCommand(fs, &config, args, benchmarkFlags, logFlags, outputFlags, sloFlags, historyFlags); !ok {
+		t.Fatalf("parseCommand() failed with exit code %d", code)
+	}
+
+	if config.Repeats != 5 || config.LookupTimeout != time.Second {
+		t.Errorf("Repeats, LookupTimeout = %d, %v, want 5, 1s", config.Repeats, config.LookupTimeout)
+	}
+	if config.SortBy != SortScore || config.OutputType != OutputJSON {
+		t.Errorf("SortBy, OutputType = %v, %v, want score, json", config.SortBy, config.OutputType)
+	}
+	if config.SLO.MaxRank["A"] != 1 || len(config.SLO.Resolvers) != 2 {
+		t.Errorf("SLO = %+v", config.SLO)
+	}
+	if config.Retention.MaxRuns != 3 {
+		t.Errorf("Retention.MaxRuns = %d, want 3", config.Retention.MaxRuns)
+	}
+	if config.ScoreWeights != bench.DefaultScoreWeights {
+		t.Errorf("ScoreWeights not set to the defaults")
+	}
+}
+
+func TestResolveServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		want    string
+		wantErr bool
+	}{
+		{name: "Address", server: "192.0.2.1", want: "192.0.2.1"},
+		{name: "Built-in name", server: "cloudflare-1", want: "1.1.1.1"},
+		{name: "Unknown name", server: "nope", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveServer(tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveServer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
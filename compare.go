@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+)
+
+// Outcomes of comparing a resolver across two runs.
+const (
+	ChangeImproved  = "improved"
+	ChangeRegressed = "regressed"
+	ChangeMixed     = "mixed"
+	ChangeNone      = "unchanged"
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+)
+
+// ResolverDelta compares one resolver between a baseline and a later run.
+// Deltas are after minus before; success rate deltas are in percentage points.
+type ResolverDelta struct {
+	Server      bench.DNSServer `json:"server"`
+	Before      *bench.Stats    `json:"before,omitempty"`
+	After       *bench.Stats    `json:"after,omitempty"`
+	Median      float64         `json:"medianDelta"`
+	P95         float64         `json:"p95Delta"`
+	SuccessRate float64         `json:"successRateDelta"`
+	LatencyP    float64         `json:"latencyP"`
+	SuccessP    float64         `json:"successP"`
+	Change      string          `json:"change"`
+}
+
+// MarshalJSON writes undefined deltas, such as those of added resolvers, as null.
+func (d ResolverDelta) MarshalJSON() ([]byte, error) {
+	type plain ResolverDelta
+	return jsonnan.Marshal(plain(d))
+}
+
+// RunComparison is the result of comparing two runs.
+type RunComparison struct {
+	Before    string          `json:"before"`
+	After     string          `json:"after"`
+	Resolvers []ResolverDelta `json:"resolvers"`
+	// NetworkChanges lists how the hosts or networks of the runs differ,
+	// when both runs have a manifest.
+	NetworkChanges []string `json:"networkChanges,omitempty"`
+	// ClientChange is set when the runs were measured with different DNS
+	// clients, whose latencies are not comparable.
+	ClientChange string `json:"clientChange,omitempty"`
+}
+
+// Regressions returns the number of resolvers that got significantly worse.
+func (c *RunComparison) Regressions() int {
+	n := 0
+	for _, d := range c.Resolvers {
+		if d.Change == ChangeRegressed || d.Change == ChangeMixed {
+			n++
+		}
+	}
+	return n
+}
+
+// compareRuns matches resolvers by address and tests each pair for significant
+// changes. Latency uses a Mann-Whitney U test on the raw samples when both
+// runs have them and falls back to non-overlapping median confidence
+// intervals otherwise. Resolvers are listed in the order of the later run,
+// followed by those that were removed.
+func compareRuns(before, after []bench.BenchmarkResult) []ResolverDelta {
+	baseline := make(map[string]bench.BenchmarkResult, len(before))
+	for _, r := range before {
+		baseline[r.Server.Endpoint()] = r
+	}
+
+	deltas := make([]ResolverDelta, 0, max(len(before), len(after)))
+	seen := make(map[string]bool, len(after))
+	for _, a := range after {
+		seen[a.Server.Endpoint()] = true
+		b, ok := baseline[a.Server.Endpoint()]
+		if !ok {
+			deltas = append(deltas, newAddedDelta(a, ChangeAdded))
+			continue
+		}
+		deltas = append(deltas, compareResults(b, a))
+	}
+	for _, b := range before {
+		if !seen[b.Server.Endpoint()] {
+			deltas = append(deltas, newAddedDelta(b, ChangeRemoved))
+		}
+	}
+	return deltas
+}
+
+func newAddedDelta(r bench.BenchmarkResult, change string) ResolverDelta {
+	d := ResolverDelta{
+		Server:      r.Server,
+		Median:      math.NaN(),
+		P95:         math.NaN(),
+		SuccessRate: math.NaN(),
+		LatencyP:    math.NaN(),
+		SuccessP:    math.NaN(),
+		Change:      change,
+	}
+	stats := r.Stats
+	if change == ChangeAdded {
+		d.After = &stats
+	} else {
+		d.Before = &stats
+	}
+	return d
+}
+
+func compareResults(before, after bench.BenchmarkResult) ResolverDelta {
+	b, a := before.Stats, after.Stats
+	d := ResolverDelta{
+		Server:      after.Server,
+		Before:      &b,
+		After:       &a,
+		Median:      a.Median - b.Median,
+		P95:         a.P95 - b.P95,
+		SuccessRate: (a.SuccessRate() - b.SuccessRate()) * 100,
+		LatencyP:    math.NaN(),
+		SuccessP:    bench.TwoProportionP(b.Count, b.Total, a.Count, a.Total),
+	}
+
+	latencyChanged := false
+	if bl, al := before.Latencies(), after.Latencies(); len(bl) > 0 && len(al) > 0 {
+		_, d.LatencyP = bench.MannWhitneyU(bl, al)
+		latencyChanged = d.LatencyP < bench.SignificanceLevel
+	} else if !math.IsNaN(d.Median) {
+		latencyChanged = a.MedianCI.Low > b.MedianCI.High || a.MedianCI.High < b.MedianCI.Low
+	}
+	successChanged := d.SuccessP < bench.SignificanceLevel
+
+	var better, worse bool
+	if latencyChanged {
+		better, worse = d.Median < 0, d.Median > 0
+	}
+	if successChanged {
+		better = better || d.SuccessRate > 0
+		worse = worse || d.SuccessRate < 0
+	}
+
+	switch {
+	case better && worse:
+		d.Change = ChangeMixed
+	case better:
+		d.Change = ChangeImproved
+	case worse:
+		d.Change = ChangeRegressed
+	default:
+		d.Change = ChangeNone
+	}
+	return d
+}
+
+// loadRunResults reads results and, if recorded, the manifest from a JSON
+// file written by -output json, a stored run exported from the history, or,
+// if source is not a file, the stored run with that ID. The results of a
+// -output json file have no samples, so it also returns the pair analysis
+// recorded in its summary.
+func loadRunResults(source, historyDir string) ([]bench.BenchmarkResult, *Manifest, *PairAnalysis, error) {
+	//nolint:gosec // file path provided by user intentionally
+	data, err := os.ReadFile(source)
+	if errors.Is(err, os.ErrNotExist) {
+		if historyDir == "" {
+			return nil, nil, nil, fmt.Errorf("%s: no such file and run history is disabled", source)
+		}
+		store, err := openHistory(historyDir)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rec, err := store.Load(source)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %w", source, err)
+		}
+		return rec.Results, rec.Manifest, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var results []bench.BenchmarkResult
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing %s: %w", source, err)
+		}
+		return results, nil, nil, nil
+	}
+
+	// Both the -output json document and a HistoryRecord have a results
+	// list; only the former keeps failed resolvers separately.
+	var doc struct {
+		Summary struct {
+			Pairs *PairAnalysis `json:"pairs"`
+		} `json:"summary"`
+		Results  []bench.BenchmarkResult `json:"results"`
+		Failures []bench.BenchmarkResult `json:"failures"`
+		Manifest *Manifest               `json:"manifest"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, nil, fmt.Errorf("parsing %s: %w", source, err)
+	}
+	if doc.Results == nil && doc.Failures == nil {
+		return nil, nil, nil, fmt.Errorf("%s: no results found", source)
+	}
+	return append(doc.Results, doc.Failures...), doc.Manifest, doc.Summary.Pairs, nil
+}
+
+// runCompareCommand implements "dnsbench compare <before> <after>" and returns
+// the process exit code.
+func runCompareCommand(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	dir := fs.String("dir", defaultHistoryDir(), "History directory used to look up run IDs")
+	outputType := fs.String("output", "table", "Output format: table, markdown, or json")
+	fs.Usage = func() {
+		//nolint:errcheck // best-effort help output
+		_, _ = fmt.Fprintf(fs.Output(), `Usage:
+  dnsbench compare [options] <before> <after>
+
+Each run is a JSON file written with -output json or the ID of a stored run.
+
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var printFn func(io.Writer, *RunComparison)
+	switch strings.ToLower(*outputType) {
+	case "table", "default":
+		printFn = printComparisonTable
+	case "markdown", "md":
+		printFn = printComparisonMarkdown
+	case "json":
+		printFn = printComparisonJSON
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid output type %q\n", *outputType)
+		return 2
+	}
+
+	before, beforeManifest, _, err := loadRunResults(fs.Arg(0), *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	after, afterManifest, _, err := loadRunResults(fs.Arg(1), *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	comparison := &RunComparison{
+		Before:         fs.Arg(0),
+		After:          fs.Arg(1),
+		Resolvers:      compareRuns(before, after),
+		NetworkChanges: networkDifferences(beforeManifest, afterManifest),
+		ClientChange:   clientDifference(beforeManifest, afterManifest),
+	}
+	if comparison.ClientChange != "" {
+		fmt.Fprintf(os.Stderr, "Warning: the runs were measured with different DNS clients (%s); their latencies are not comparable\n", comparison.ClientChange)
+	}
+	if len(comparison.NetworkChanges) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the runs were measured from different hosts or networks:\n")
+		for _, change := range comparison.NetworkChanges {
+			fmt.Fprintf(os.Stderr, "  - %s\n", change)
+		}
+	}
+	printFn(os.Stdout, comparison)
+	return 0
+}
+
+func formatDelta(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f", v)
+}
+
+func formatStat(s *bench.Stats, v func(bench.Stats) float64) string {
+	if s == nil || math.IsNaN(v(*s)) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", v(*s))
+}
+
+func formatP(p float64) string {
+	if math.IsNaN(p) {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", p)
+}
+
+func statMedian(s bench.Stats) float64  { return s.Median }
+func statP95(s bench.Stats) float64     { return s.P95 }
+func statSuccess(s bench.Stats) float64 { return s.SuccessRate() * 100 }
+
+//nolint:errcheck // printing helper
+func printComparisonTable(w io.Writer, c *RunComparison) {
+	_, _ = fmt.Fprintf(w, "Comparing %s -> %s\n\n", c.Before, c.After)
+	_, _ = fmt.Fprintf(w, "%-20s %-15s %24s %24s %24s %8s %8s  %s\n",
+		"Resolver", "Address", "Median(ms)", "P95(ms)", "Success%", "p(lat)", "p(succ)", "Change")
+	_, _ = fmt.Fprintf(w, "%s\n", strings.Repeat("-", 145))
+	for _, d := range c.Resolvers {
+		change := d.Change
+		if d.Change == ChangeImproved || d.Change == ChangeRegressed || d.Change == ChangeMixed {
+			change = "* " + strings.ToUpper(change)
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %-15s %24s %24s %24s %8s %8s  %s\n",
+			truncateString(d.Server.Name, 20), d.Server.Endpoint(),
+			formatChange(d.Before, d.After, statMedian, d.Median),
+			formatChange(d.Before, d.After, statP95, d.P95),
+			formatChange(d.Before, d.After, statSuccess, d.SuccessRate),
+			formatP(d.LatencyP), formatP(d.SuccessP), change)
+	}
+	_, _ = fmt.Fprintf(w, "\n%d of %d resolvers regressed (p < %.2f)\n", c.Regressions(), len(c.Resolvers), bench.SignificanceLevel)
+}
+
+func formatChange(before, after *bench.Stats, v func(bench.Stats) float64, delta float64) string {
+	return fmt.Sprintf("%s -> %s (%s)", formatStat(before, v), formatStat(after, v), formatDelta(delta))
+}
+
+//nolint:errcheck // printing helper
+func printComparisonMarkdown(w io.Writer, c *RunComparison) {
+	_, _ = fmt.Fprintf(w, "### DNS benchmark: `%s` → `%s`\n\n", c.Before, c.After)
+	if c.ClientChange != "" {
+		_, _ = fmt.Fprintf(w, "> **Note:** the runs were measured with different DNS clients (%s); their latencies are not comparable.\n\n", c.ClientChange)
+	}
+	if len(c.NetworkChanges) > 0 {
+		_, _ = fmt.Fprintf(w, "> **Note:** the runs were measured from different hosts or networks (%s).\n\n", strings.Join(c.NetworkChanges, "; "))
+	}
+	_, _ = fmt.Fprintln(w, "| Resolver | Address | Median (ms) | P95 (ms) | Success % | p (latency) | p (success) | Change |")
+	_, _ = fmt.Fprintln(w, "|---|---|---:|---:|---:|---:|---:|---|")
+	for _, d := range c.Resolvers {
+		change := d.Change
+		if d.Change == ChangeImproved || d.Change == ChangeRegressed || d.Change == ChangeMixed {
+			change = "**" + change + "**"
+		}
+		_, _ = fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s | %s |\n",
+			d.Server.Name, d.Server.Endpoint(),
+			formatChange(d.Before, d.After, statMedian, d.Median),
+			formatChange(d.Before, d.After, statP95, d.P95),
+			formatChange(d.Before, d.After, statSuccess, d.SuccessRate),
+			formatP(d.LatencyP), formatP(d.SuccessP), change)
+	}
+	_, _ = fmt.Fprintf(w, "\n%d of %d resolvers regressed (p < %.2f).\n", c.Regressions(), len(c.Resolvers), bench.SignificanceLevel)
+}
+
+func printComparisonJSON(w io.Writer, c *RunComparison) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode json comparison: %v\n", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestCompareRuns(t *testing.T) {
+	steady := seq(10, 20)
+	before := []bench.BenchmarkResult{
+		testResult("steady", steady...),
+		testResult("slower", steady...),
+		testResult("gone", steady...),
+	}
+
+	after := []bench.BenchmarkResult{
+		testResult("steady", steady...),
+		testResult("slower", seq(30, 40)...),
+		testResult("new", steady...),
+	}
+
+	deltas := compareRuns(before, after)
+	want := map[string]string{
+		"steady": ChangeNone,
+		"slower": ChangeRegressed,
+		"new":    ChangeAdded,
+		"gone":   ChangeRemoved,
+	}
+	if len(deltas) != len(want) {
+		t.Fatalf("compareRuns() = %d deltas, want %d", len(deltas), len(want))
+	}
+	for _, d := range deltas {
+		if d.Change != want[d.Server.Name] {
+			t.Errorf("%s change = %q, want %q", d.Server.Name, d.Change, want[d.Server.Name])
+		}
+	}
+	if d := deltas[1]; d.Median <= 0 || d.LatencyP >= bench.SignificanceLevel {
+		t.Errorf("slower delta = %+v, want positive median delta with p < %v", d, bench.SignificanceLevel)
+	}
+	if d := deltas[2]; !math.IsNaN(d.Median) || d.Before != nil || d.After == nil {
+		t.Errorf("added delta = %+v, want NaN deltas and only after stats", d)
+	}
+}
+
+func TestCompareResults_SuccessRate(t *testing.T) {
+	before := testResult("r", seq(10, 100)...)
+	after := before
+	after.Stats.Total = 200
+
+	if d := compareResults(before, after); d.Change != ChangeRegressed || d.SuccessRate != -50 {
+		t.Errorf("compareResults() = %q, %v points, want regressed by 50 points", d.Change, d.SuccessRate)
+	}
+}
+
+func TestLoadRunResults_OutputJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	doc := `{"summary": {}, "results": [{"server": {"name": "A", "addr": "192.0.2.1"}, "stats": {"median": 5, "count": 1, "total": 1}}],
+		"failures": [{"server": {"name": "B", "addr": "192.0.2.2"}, "stats": {"median": null, "errors": 3, "total": 3}}]}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, _, err := loadRunResults(path, "")
+	if err != nil {
+		t.Fatalf("loadRunResults() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Stats.Median != 5 || !math.IsNaN(results[1].Stats.Median) {
+		t.Errorf("loadRunResults() = %+v, want A with median 5 and failed B", results)
+	}
+
+	if _, _, _, err := loadRunResults(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("loadRunResults(missing) error = nil, want error")
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// ConfigFile is the YAML file given with -config. It describes resolvers and
+// domain sets once, settings shared by every run under defaults, and named
+// profiles that override them. Flags given on the command line override both.
+type ConfigFile struct {
+	Resolvers  []ConfigResolver          `yaml:"resolvers"`
+	DomainSets map[string][]string       `yaml:"domainSets"`
+	Defaults   map[string]any            `yaml:"defaults"`
+	Profiles   map[string]map[string]any `yaml:"profiles"`
+}
+
+// ConfigResolver is a resolver defined in the config file.
+type ConfigResolver struct {
+	Name      string `yaml:"name"`
+	Addr      string `yaml:"addr"`
+	Transport string `yaml:"transport"`
+	Hostname  string `yaml:"hostname"`
+	Provider  string `yaml:"provider"`
+}
+
+// profileFlags maps the settings of a profile to the flags they set. Dotted
+// names are nested, e.g. slo.p95 is p95 inside an slo mapping.
+var profileFlags = map[string]string{
+	"major":         "major",
+	"repeats":       "n",
+	"timeout":       "t",
+	"concurrency":   "c",
+	"retries":       "retries",
+	"backoff":       "backoff",
+	"maxBackoff":    "max-backoff",
+	"warmup":        "warmup",
+	"preflight":     "preflight",
+	"breaker":       "breaker",
+	"adaptive":      "adaptive",
+	"targetCI":      "target-ci",
+	"maxQueries":    "max-queries",
+	"maxTime":       "max-time",
+	"runQueries":    "run-queries",
+	"runTime":       "run-time",
+	"qps":           "qps",
+	"rtt":           "rtt",
+	"rttMethod":     "rtt-method",
+	"ip":            "ip",
+	"qtype":         "qtype",
+	"samples":       "samples",
+	"capture":       "capture",
+	"workload":      "workload",
+	"pacing":        "pacing",
+	"weights":       "weights",
+	"seed":          "seed",
+	"output":        "output",
+	"sort":          "sort",
+	"log":           "log",
+	"history":       "history",
+	"keep":          "keep",
+	"keepFor":       "keep-for",
+	"listen":        "listen",
+	"agent.server":  "server",
+	"agent.name":    "name",
+	"agent.poll":    "poll",
+	"agent.token":   "agent-token",
+	"interval":      "interval",
+	"cron":          "cron",
+	"window":        "window",
+	"slo.median":    "slo-median",
+	"slo.p95":       "slo-p95",
+	"slo.success":   "slo-success",
+	"slo.rank":      "slo-rank",
+	"slo.resolvers": "slo-resolvers",
+	"slo.report":    "slo-report",
+
+	"proxy.mode":      "mode",
+	"proxy.upstreams": "upstreams",
+	"proxy.report":    "report",
+}
+
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dnsbench", "config.yaml")
+}
+
+// configFlags reads the config file and profile. It must be the first group
+// of a command: its validator sets every flag that was not given on the
+// command line from the file, before the other groups validate them.
+func configFlags(fs *flag.FlagSet, config *Config) func() error {
+	fs.StringVar(&config.ConfigFile, "config", defaultConfigFile(), "YAML config file with resolvers, domain sets and profiles (empty disables it)")
+	fs.StringVar(&config.Profile, "profile", "", "Named profile from the config file, e.g. office-quick")
+
+	return func() error {
+		explicit := false
+		fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+
+		if config.ConfigFile == "" {
+			if config.Profile != "" {
+				return errors.New("profile requires a config file")
+			}
+			return nil
+		}
+
+		file, err := loadConfigFile(config.ConfigFile)
+		if errors.Is(err, os.ErrNotExist) && !explicit && config.Profile == "" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return file.apply(fs, config)
+	}
+}
+
+func loadConfigFile(path string) (*ConfigFile, error) {
+	//nolint:gosec // file path provided by user intentionally
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var file ConfigFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// apply resolves the settings of the defaults and the selected profile and
+// stores them in config and in the flags of fs that were not set explicitly.
+func (f *ConfigFile) apply(fs *flag.FlagSet, config *Config) error {
+	settings := make(map[string]any, len(f.Defaults))
+	maps.Copy(settings, f.Defaults)
+	if config.Profile != "" {
+		profile, ok := f.Profiles[config.Profile]
+		if !ok {
+			return fmt.Errorf("profile %q not found in %s (available: %s)",
+				config.Profile, config.ConfigFile, strings.Join(slices.Sorted(maps.Keys(f.Profiles)), ", "))
+		}
+		maps.Copy(settings, profile)
+	}
+
+	catalogue, err := f.servers()
+	if err != nil {
+		return err
+	}
+
+	names, err := stringList(settings["resolvers"])
+	if err != nil {
+		return fmt.Errorf("resolvers: %w", err)
+	}
+	delete(settings, "resolvers")
+	explicit := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { explicit[fl.Name] = true })
+
+	switch {
+	case explicit["major"], len(names) == 0 && settings["major"] == true:
+		// -major replaces the resolvers of the file unless a profile names them.
+	case len(names) > 0:
+		config.Servers, err = selectServers(names, catalogue)
+		if err != nil {
+			return err
+		}
+	default:
+		config.Servers = catalogue
+	}
+
+	domains, err := stringList(settings["domains"])
+	if err != nil {
+		return fmt.Errorf("domains: %w", err)
+	}
+	delete(settings, "domains")
+	config.Domains, err = f.expandDomains(domains)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(settings))
+	if err := flattenSettings("", settings, values); err != nil {
+		return err
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		name := profileFlags[key]
+		if explicit[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, values[key]); err != nil {
+			return fmt.Errorf("%s: %s: %w", config.ConfigFile, key, err)
+		}
+	}
+	return nil
+}
+
+func (f *ConfigFile) servers() ([]bench.DNSServer, error) {
+	servers := make([]bench.DNSServer, 0, len(f.Resolvers))
+	for i, r := range f.Resolvers {
+		if r.Name == "" || r.Addr == "" {
+			return nil, fmt.Errorf("resolver %d: name and addr are required", i+1)
+		}
+		if net.ParseIP(r.Addr) == nil {
+			return nil, fmt.Errorf("resolver %s: invalid IP address %q", r.Name, r.Addr)
+		}
+		transport, err := bench.ParseTransport(r.Transport)
+		if err != nil {
+			return nil, fmt.Errorf("resolver %s: %w", r.Name, err)
+		}
+		if r.Hostname != "" && transport != bench.TransportTLS {
+			return nil, fmt.Errorf("resolver %s: hostname is only used with the tls transport", r.Name)
+		}
+		servers = append(servers, bench.DNSServer{Name: r.Name, Addr: r.Addr, Transport: transport, Hostname: r.Hostname, Provider: r.Provider})
+	}
+	return servers, nil
+}
+
+// selectServers looks up resolvers by name, first in the config file, then
+// among the built-in resolvers. "builtin" and "major" select the built-in
+// lists.
+func selectServers(names []string, catalogue []bench.DNSServer) ([]bench.DNSServer, error) {
+	var servers []bench.DNSServer
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "builtin":
+			servers = append(servers, builtInResolvers...)
+			continue
+		case "major":
+			servers = append(servers, builtinMajorResolvers...)
+			continue
+		}
+
+		match := func(s bench.DNSServer) bool { return strings.EqualFold(s.Name, name) }
+		if i := slices.IndexFunc(catalogue, match); i >= 0 {
+			servers = append(servers, catalogue[i])
+		} else if i := slices.IndexFunc(builtInResolvers, match); i >= 0 {
+			servers = append(servers, builtInResolvers[i])
+		} else {
+			return nil, fmt.Errorf("unknown resolver %q", name)
+		}
+	}
+	return servers, nil
+}
+
+// expandDomains replaces the names of domain sets with their domains.
+func (f *ConfigFile) expandDomains(entries []string) ([]string, error) {
+	var domains []string
+	for _, entry := range entries {
+		if set, ok := f.DomainSets[entry]; ok {
+			domains = append(domains, set...)
+			continue
+		}
+		domains = append(domains, entry)
+	}
+	for _, d := range domains {
+		if !isValidDomain(d) {
+			return nil, fmt.Errorf("domains: %q is neither a domain set nor a valid domain", d)
+		}
+	}
+	return domains, nil
+}
+
+// flattenSettings converts settings into flag values keyed by their dotted
+// name. Lists become comma-separated and mappings that are not sections,
+// such as weights and slo.rank, become comma-separated key=value pairs.
+func flattenSettings(prefix string, settings map[string]any, values map[string]string) error {
+	for key, v := range settings {
+		name := prefix + key
+		if section, ok := v.(map[string]any); ok && isSection(name) {
+			if err := flattenSettings(name+".", section, values); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := profileFlags[name]; !ok {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		values[name] = settingValue(v)
+	}
+	return nil
+}
+
+func isSection(name string) bool {
+	for key := range profileFlags {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func settingValue(v any) string {
+	switch v := v.(type) {
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			parts = append(parts, fmt.Sprint(e))
+		}
+		return strings.Join(parts, ",")
+	case map[string]any:
+		parts := make([]string, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			parts = append(parts, fmt.Sprintf("%s=%v", k, v[k]))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// stringList accepts a single string or a list of strings.
+func stringList(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of names, got %v", e)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("expected a name or a list of names, got %v", v)
+	}
+}
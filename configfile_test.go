@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+const testConfigFile = `
+resolvers:
+  - name: Internal-1
+    addr: 10.0.0.53
+  - name: Cloudflare-DoT
+    addr: 1.1.1.1
+    transport: tls
+    hostname: cloudflare-dns.com
+domainSets:
+  quick: [example.com, example.org]
+defaults:
+  repeats: 5
+  timeout: 2s
+  output: table
+  slo:
+    p95: 80ms
+profiles:
+  office-quick:
+    resolvers: [Internal-1, cloudflare-1]
+    domains: [quick, example.net]
+    repeats: 2
+    weights: {success: 0.5, p95: 0.5}
+    slo:
+      rank: {Internal-1: 1}
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func parseTestConfig(t *testing.T, args ...string) (*Config, bool) {
+	t.Helper()
+	var config Config
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	_, ok := parseCommand(fs, &config, args, configFlags, benchmarkFlags, outputFlags, sloFlags)
+	return &config, ok
+}
+
+func TestConfigFile_Defaults(t *testing.T) {
+	path := writeTestConfig(t, testConfigFile)
+
+	config, ok := parseTestConfig(t, "-config", path)
+	if !ok {
+		t.Fatal("parseCommand() failed")
+	}
+	if config.Repeats != 5 || config.LookupTimeout != 2*time.Second || config.OutputType != OutputTable {
+		t.Errorf("Repeats, LookupTimeout, OutputType = %d, %v, %v, want 5, 2s, table", config.Repeats, config.LookupTimeout, config.OutputType)
+	}
+	if config.SLO.MaxP95 != 80*time.Millisecond {
+		t.Errorf("SLO.MaxP95 = %v, want 80ms", config.SLO.MaxP95)
+	}
+	want := []bench.DNSServer{
+		{Name: "Internal-1", Addr: "10.0.0.53", Transport: bench.TransportUDP},
+		{Name: "Cloudflare-DoT", Addr: "1.1.1.1", Transport: bench.TransportTLS, Hostname: "cloudflare-dns.com"},
+	}
+	if len(config.Servers) != len(want) {
+		t.Fatalf("Servers = %+v, want %+v", config.Servers, want)
+	}
+	for i := range want {
+		if config.Servers[i] != want[i] {
+			t.Errorf("Servers[%d] = %+v, want %+v", i, config.Servers[i], want[i])
+		}
+	}
+	if config.Domains != nil {
+		t.Errorf("Domains = %v, want built-in domains", config.Domains)
+	}
+}
+
+func TestConfigFile_ProfileAndFlags(t *testing.T) {
+	path := writeTestConfig(t, testConfigFile)
+
+	config, ok := parseTestConfig(t, "-config", path, "-profile", "office-quick", "-t", "1s")
+	if !ok {
+		t.Fatal("parseCommand() failed")
+	}
+	if config.Repeats != 2 {
+		t.Errorf("Repeats = %d, want 2 from the profile", config.Repeats)
+	}
+	if config.LookupTimeout != time.Second {
+		t.Errorf("LookupTimeout = %v, want 1s from the command line", config.LookupTimeout)
+	}
+	if config.ScoreWeights != (bench.ScoreWeights{SuccessRate: 0.5, P95: 0.5}) {
+		t.Errorf("ScoreWeights = %+v", config.ScoreWeights)
+	}
+	if config.SLO.MaxRank["Internal-1"] != 1 {
+		t.Errorf("SLO.MaxRank = %v", config.SLO.MaxRank)
+	}
+	if len(config.Servers) != 2 || config.Servers[0].Addr != "10.0.0.53" || config.Servers[1].Addr != "1.1.1.1" {
+		t.Errorf("Servers = %+v", config.Servers)
+	}
+	if got := len(config.Domains); got != 3 {
+		t.Errorf("len(Domains) = %d, want 3", got)
+	}
+
+	config, ok = parseTestConfig(t, "-config", path, "-profile", "office-quick", "-major")
+	if !ok {
+		t.Fatal("parseCommand() failed")
+	}
+	if config.Servers != nil {
+		t.Errorf("Servers = %+v, want none with -major", config.Servers)
+	}
+}
+
+func TestConfigFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+	}{
+		{name: "Unknown profile", content: testConfigFile, args: []string{"-profile", "home"}},
+		{name: "Unknown setting", content: "defaults:\n  repeat: 3\n"},
+		{name: "Unknown section", content: "resolver: []\n"},
+		{name: "Invalid value", content: "defaults:\n  timeout: fast\n"},
+		{name: "Invalid transport", content: "resolvers:\n  - {name: A, addr: 1.1.1.1, transport: doh}\n"},
+		{name: "Unknown resolver", content: "defaults:\n  resolvers: [Nope]\n"},
+		{name: "Invalid domain", content: "defaults:\n  domains: [quick]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, tt.content)
+			if _, ok := parseTestConfig(t, append([]string{"-config", path}, tt.args...)...); ok {
+				t.Errorf("parseCommand() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestConfigFile_Missing(t *testing.T) {
+	if _, ok := parseTestConfig(t, "-config", filepath.Join(t.TempDir(), "missing.yaml")); ok {
+		t.Errorf("parseCommand() with a missing -config succeeded, want error")
+	}
+}
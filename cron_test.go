@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"0 0 30 2 *",
+	}
+
+	for _, expr := range tests {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) error = nil, want error", expr)
+		}
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	// 2025-01-06 is a Monday.
+	base := time.Date(2025, 1, 6, 10, 7, 30, 0, time.Local)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2025, 1, 6, 10, 8, 0, 0, time.Local)},
+		{expr: "*/15 * * * *", want: time.Date(2025, 1, 6, 10, 15, 0, 0, time.Local)},
+		{expr: "0 9-17 * * 1-5", want: time.Date(2025, 1, 6, 11, 0, 0, 0, time.Local)},
+		{expr: "30 2 * * *", want: time.Date(2025, 1, 7, 2, 30, 0, 0, time.Local)},
+		{expr: "0 0 1 * *", want: time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local)},
+		{expr: "0 0 * * 7", want: time.Date(2025, 1, 12, 0, 0, 0, 0, time.Local)},
+		{expr: "0 0 15 * 3", want: time.Date(2025, 1, 8, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -1,70 +1,115 @@
 package main
 
+import "github.com/handsomefox/dnsbench/bench"
+
 var (
-	builtInResolvers = []DNSServer{
+	builtInResolvers = []bench.DNSServer{
 		// Major providers
-		{Name: "Cloudflare-1", Addr: "1.1.1.1"},
-		{Name: "Cloudflare-2", Addr: "1.0.0.1"},
-		{Name: "Google-1", Addr: "8.8.8.8"},
-		{Name: "Google-2", Addr: "8.8.4.4"},
-		{Name: "Quad9-1", Addr: "9.9.9.9"},
-		{Name: "Quad9-2", Addr: "149.112.112.112"},
-		{Name: "Quad9-ECS-1", Addr: "9.9.9.11"},
-		{Name: "Quad9-ECS-2", Addr: "149.112.112.11"},
-		{Name: "OpenDNS-1", Addr: "208.67.222.222"},
-		{Name: "OpenDNS-2", Addr: "208.67.220.220"},
+		{Name: "Cloudflare-1", Addr: "1.1.1.1", Provider: "Cloudflare"},
+		{Name: "Cloudflare-2", Addr: "1.0.0.1", Provider: "Cloudflare"},
+		{Name: "Cloudflare-v6-1", Addr: "2606:4700:4700::1111", Provider: "Cloudflare"},
+		{Name: "Cloudflare-v6-2", Addr: "2606:4700:4700::1001", Provider: "Cloudflare"},
+		{Name: "Google-1", Addr: "8.8.8.8", Provider: "Google"},
+		{Name: "Google-2", Addr: "8.8.4.4", Provider: "Google"},
+		{Name: "Google-v6-1", Addr: "2001:4860:4860::8888", Provider: "Google"},
+		{Name: "Google-v6-2", Addr: "2001:4860:4860::8844", Provider: "Google"},
+		{Name: "Quad9-1", Addr: "9.9.9.9", Provider: "Quad9"},
+		{Name: "Quad9-2", Addr: "149.112.112.112", Provider: "Quad9"},
+		{Name: "Quad9-v6-1", Addr: "2620:fe::fe", Provider: "Quad9"},
+		{Name: "Quad9-v6-2", Addr: "2620:fe::9", Provider: "Quad9"},
+		{Name: "Quad9-ECS-1", Addr: "9.9.9.11", Provider: "Quad9-ECS"},
+		{Name: "Quad9-ECS-2", Addr: "149.112.112.11", Provider: "Quad9-ECS"},
+		{Name: "Quad9-ECS-v6-1", Addr: "2620:fe::11", Provider: "Quad9-ECS"},
+		{Name: "Quad9-ECS-v6-2", Addr: "2620:fe::fe:11", Provider: "Quad9-ECS"},
+		{Name: "OpenDNS-1", Addr: "208.67.222.222", Provider: "OpenDNS"},
+		{Name: "OpenDNS-2", Addr: "208.67.220.220", Provider: "OpenDNS"},
+		{Name: "OpenDNS-v6-1", Addr: "2620:119:35::35", Provider: "OpenDNS"},
+		{Name: "OpenDNS-v6-2", Addr: "2620:119:53::53", Provider: "OpenDNS"},
 
 		// Ad-blocking and filtering
-		{Name: "AdGuard-1", Addr: "94.140.14.14"},
-		{Name: "AdGuard-2", Addr: "94.140.15.15"},
-		{Name: "CleanBrowsing-1", Addr: "185.228.168.9"},
-		{Name: "CleanBrowsing-2", Addr: "185.228.169.9"},
-		{Name: "NextDNS-1", Addr: "45.90.28.0"},
-		{Name: "NextDNS-2", Addr: "45.90.30.0"},
-		{Name: "ControlD-1", Addr: "76.76.2.0"},
-		{Name: "ControlD-2", Addr: "76.76.10.0"},
+		{Name: "AdGuard-1", Addr: "94.140.14.14", Provider: "AdGuard"},
+		{Name: "AdGuard-2", Addr: "94.140.15.15", Provider: "AdGuard"},
+		{Name: "AdGuard-v6-1", Addr: "2a10:50c0::ad1:ff", Provider: "AdGuard"},
+		{Name: "AdGuard-v6-2", Addr: "2a10:50c0::ad2:ff", Provider: "AdGuard"},
+		{Name: "CleanBrowsing-1", Addr: "185.228.168.9", Provider: "CleanBrowsing"},
+		{Name: "CleanBrowsing-2", Addr: "185.228.169.9", Provider: "CleanBrowsing"},
+		{Name: "CleanBrowsing-v6-1", Addr: "2a0d:2a00:1::2", Provider: "CleanBrowsing"},
+		{Name: "CleanBrowsing-v6-2", Addr: "2a0d:2a00:2::2", Provider: "CleanBrowsing"},
+		{Name: "NextDNS-1", Addr: "45.90.28.0", Provider: "NextDNS"},
+		{Name: "NextDNS-2", Addr: "45.90.30.0", Provider: "NextDNS"},
+		{Name: "NextDNS-v6-1", Addr: "2a07:a8c0::", Provider: "NextDNS"},
+		{Name: "NextDNS-v6-2", Addr: "2a07:a8c1::", Provider: "NextDNS"},
+		{Name: "ControlD-1", Addr: "76.76.2.0", Provider: "ControlD"},
+		{Name: "ControlD-2", Addr: "76.76.10.0", Provider: "ControlD"},
+		{Name: "ControlD-v6-1", Addr: "2606:1a40::", Provider: "ControlD"},
+		{Name: "ControlD-v6-2", Addr: "2606:1a40:1::", Provider: "ControlD"},
 
 		// Privacy-focused
-		{Name: "Mullvad-1", Addr: "194.242.2.2"},
-		{Name: "Mullvad-2", Addr: "194.242.2.3"},
-		{Name: "DNS0-EU-1", Addr: "193.110.81.0"},
-		{Name: "DNS0-EU-2", Addr: "185.253.5.0"},
-		{Name: "UncensoredDNS-1", Addr: "91.239.100.100"},
-		{Name: "UncensoredDNS-2", Addr: "89.233.43.71"},
+		{Name: "Mullvad-1", Addr: "194.242.2.2", Provider: "Mullvad"},
+		{Name: "Mullvad-2", Addr: "194.242.2.3", Provider: "Mullvad"},
+		{Name: "Mullvad-v6-1", Addr: "2a07:e340::2", Provider: "Mullvad"},
+		{Name: "Mullvad-v6-2", Addr: "2a07:e340::3", Provider: "Mullvad"},
+		{Name: "DNS0-EU-1", Addr: "193.110.81.0", Provider: "DNS0-EU"},
+		{Name: "DNS0-EU-2", Addr: "185.253.5.0", Provider: "DNS0-EU"},
+		{Name: "DNS0-EU-v6-1", Addr: "2a0f:fc80::", Provider: "DNS0-EU"},
+		{Name: "DNS0-EU-v6-2", Addr: "2a0f:fc81::", Provider: "DNS0-EU"},
+		{Name: "UncensoredDNS-1", Addr: "91.239.100.100", Provider: "UncensoredDNS"},
+		{Name: "UncensoredDNS-2", Addr: "89.233.43.71", Provider: "UncensoredDNS"},
+		{Name: "UncensoredDNS-v6-1", Addr: "2001:67c:28a4::", Provider: "UncensoredDNS"},
+		{Name: "UncensoredDNS-v6-2", Addr: "2a01:3a0:53:53::", Provider: "UncensoredDNS"},
 
 		// Regional/National
-		{Name: "AliDNS-1", Addr: "223.5.5.5"},
-		{Name: "AliDNS-2", Addr: "223.6.6.6"},
-		{Name: "DNSPod-1", Addr: "119.29.29.29"},
-		{Name: "DNSPod-2", Addr: "119.28.28.28"},
-		{Name: "Canadian-Shield-1", Addr: "149.112.121.10"},
-		{Name: "Canadian-Shield-2", Addr: "149.112.122.10"},
+		{Name: "AliDNS-1", Addr: "223.5.5.5", Provider: "AliDNS"},
+		{Name: "AliDNS-2", Addr: "223.6.6.6", Provider: "AliDNS"},
+		{Name: "AliDNS-v6-1", Addr: "2400:3200::1", Provider: "AliDNS"},
+		{Name: "AliDNS-v6-2", Addr: "2400:3200:baba::1", Provider: "AliDNS"},
+		{Name: "DNSPod-1", Addr: "119.29.29.29", Provider: "DNSPod"},
+		{Name: "DNSPod-2", Addr: "119.28.28.28", Provider: "DNSPod"},
+		{Name: "DNSPod-v6-1", Addr: "2402:4e00::", Provider: "DNSPod"},
+		{Name: "Canadian-Shield-1", Addr: "149.112.121.10", Provider: "Canadian-Shield"},
+		{Name: "Canadian-Shield-2", Addr: "149.112.122.10", Provider: "Canadian-Shield"},
+		{Name: "Canadian-Shield-v6-1", Addr: "2620:10a:80bb::10", Provider: "Canadian-Shield"},
+		{Name: "Canadian-Shield-v6-2", Addr: "2620:10a:80bc::10", Provider: "Canadian-Shield"},
 
 		// Alternative providers
-		{Name: "DNS-SB-1", Addr: "185.222.222.222"},
-		{Name: "DNS-SB-2", Addr: "45.11.45.11"},
-		{Name: "LibreDNS-1", Addr: "116.202.176.26"},
-		{Name: "LibreDNS-2", Addr: "116.203.115.192"},
+		{Name: "DNS-SB-1", Addr: "185.222.222.222", Provider: "DNS-SB"},
+		{Name: "DNS-SB-2", Addr: "45.11.45.11", Provider: "DNS-SB"},
+		{Name: "DNS-SB-v6-1", Addr: "2a09::", Provider: "DNS-SB"},
+		{Name: "DNS-SB-v6-2", Addr: "2a11::", Provider: "DNS-SB"},
+		{Name: "LibreDNS-1", Addr: "116.202.176.26", Provider: "LibreDNS"},
+		{Name: "LibreDNS-2", Addr: "116.203.115.192", Provider: "LibreDNS"},
 	}
 
-	builtinMajorResolvers = []DNSServer{
-		{Name: "Cloudflare-1", Addr: "1.1.1.1"},
-		{Name: "Cloudflare-2", Addr: "1.0.0.1"},
-
-		{Name: "Google-1", Addr: "8.8.8.8"},
-		{Name: "Google-2", Addr: "8.8.4.4"},
-
-		{Name: "Quad9-1", Addr: "9.9.9.9"},
-		{Name: "Quad9-2", Addr: "149.112.112.112"},
-
-		{Name: "Quad9-ECS-1", Addr: "9.9.9.11"},
-		{Name: "Quad9-ECS-2", Addr: "149.112.112.11"},
-
-		{Name: "NextDNS-1", Addr: "45.90.28.0"},
-		{Name: "NextDNS-2", Addr: "45.90.30.0"},
-
-		{Name: "AdGuard-1", Addr: "94.140.14.14"},
-		{Name: "AdGuard-2", Addr: "94.140.15.15"},
+	builtinMajorResolvers = []bench.DNSServer{
+		{Name: "Cloudflare-1", Addr: "1.1.1.1", Provider: "Cloudflare"},
+		{Name: "Cloudflare-2", Addr: "1.0.0.1", Provider: "Cloudflare"},
+		{Name: "Cloudflare-v6-1", Addr: "2606:4700:4700::1111", Provider: "Cloudflare"},
+		{Name: "Cloudflare-v6-2", Addr: "2606:4700:4700::1001", Provider: "Cloudflare"},
+
+		{Name: "Google-1", Addr: "8.8.8.8", Provider: "Google"},
+		{Name: "Google-2", Addr: "8.8.4.4", Provider: "Google"},
+		{Name: "Google-v6-1", Addr: "2001:4860:4860::8888", Provider: "Google"},
+		{Name: "Google-v6-2", Addr: "2001:4860:4860::8844", Provider: "Google"},
+
+		{Name: "Quad9-1", Addr: "9.9.9.9", Provider: "Quad9"},
+		{Name: "Quad9-2", Addr: "149.112.112.112", Provider: "Quad9"},
+		{Name: "Quad9-v6-1", Addr: "2620:fe::fe", Provider: "Quad9"},
+		{Name: "Quad9-v6-2", Addr: "2620:fe::9", Provider: "Quad9"},
+
+		{Name: "Quad9-ECS-1", Addr: "9.9.9.11", Provider: "Quad9-ECS"},
+		{Name: "Quad9-ECS-2", Addr: "149.112.112.11", Provider: "Quad9-ECS"},
+		{Name: "Quad9-ECS-v6-1", Addr: "2620:fe::11", Provider: "Quad9-ECS"},
+		{Name: "Quad9-ECS-v6-2", Addr: "2620:fe::fe:11", Provider: "Quad9-ECS"},
+
+		{Name: "NextDNS-1", Addr: "45.90.28.0", Provider: "NextDNS"},
+		{Name: "NextDNS-2", Addr: "45.90.30.0", Provider: "NextDNS"},
+		{Name: "NextDNS-v6-1", Addr: "2a07:a8c0::", Provider: "NextDNS"},
+		{Name: "NextDNS-v6-2", Addr: "2a07:a8c1::", Provider: "NextDNS"},
+
+		{Name: "AdGuard-1", Addr: "94.140.14.14", Provider: "AdGuard"},
+		{Name: "AdGuard-2", Addr: "94.140.15.15", Provider: "AdGuard"},
+		{Name: "AdGuard-v6-1", Addr: "2a10:50c0::ad1:ff", Provider: "AdGuard"},
+		{Name: "AdGuard-v6-2", Addr: "2a10:50c0::ad2:ff", Provider: "AdGuard"},
 	}
 
 	defaultSites = []string{
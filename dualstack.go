@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"regexp"
+	"slices"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+)
+
+// IPFamily selects the address families of the resolvers that are queried.
+type IPFamily string
+
+const (
+	// IPAuto queries the families the host has a route for.
+	IPAuto IPFamily = "auto"
+	IP4    IPFamily = "4"
+	IP6    IPFamily = "6"
+	IPBoth IPFamily = "both"
+)
+
+func parseIPFamily(s string) (IPFamily, error) {
+	switch f := IPFamily(s); f {
+	case "", IPAuto:
+		return IPAuto, nil
+	case IP4, IP6, IPBoth:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid ip %q: expected auto, 4, 6 or both", s)
+	}
+}
+
+func familyName(s bench.DNSServer) string {
+	if s.IPv6() {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// selectFamilies returns the servers of family. With IPAuto it leaves out the
+// servers of a family the host has no route for and returns them as skipped,
+// unless that would leave nothing to query.
+func selectFamilies(servers []bench.DNSServer, family IPFamily, network NetworkInfo) (kept, skipped []bench.DNSServer, err error) {
+	var want func(bench.DNSServer) bool
+	switch family {
+	case IPBoth:
+		return servers, nil, nil
+	case IP4:
+		want = func(s bench.DNSServer) bool { return !s.IPv6() }
+	case IP6:
+		want = bench.DNSServer.IPv6
+	default:
+		has4, has6 := hasRoute(network, "IPv4"), hasRoute(network, "IPv6")
+		if has4 == has6 {
+			// Both families work, or detection found no route at all and
+			// the queries will tell.
+			return servers, nil, nil
+		}
+		want = func(s bench.DNSServer) bool { return s.IPv6() == has6 }
+	}
+
+	for _, s := range servers {
+		if want(s) {
+			kept = append(kept, s)
+		} else {
+			skipped = append(skipped, s)
+		}
+	}
+	switch {
+	case len(kept) > 0 && (family == IP4 || family == IP6):
+		return kept, nil, nil
+	case len(kept) > 0:
+		return kept, skipped, nil
+	case family == IP4 || family == IP6:
+		return nil, nil, fmt.Errorf("no IPv%s resolvers to query", family)
+	default:
+		return servers, nil, nil
+	}
+}
+
+// hasRoute reports whether network has an egress address of family that
+// reaches the internet. A unique local IPv6 address does not.
+func hasRoute(network NetworkInfo, family string) bool {
+	if family == "IPv4" {
+		return network.Addr != ""
+	}
+	addr, err := netip.ParseAddr(network.Addr6)
+	return err == nil && addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// skippedNote explains why the skipped resolvers were not queried.
+func skippedNote(skipped []bench.DNSServer, network NetworkInfo) string {
+	family := familyName(skipped[0])
+	if family == "IPv6" && network.Addr6 != "" {
+		return fmt.Sprintf("this host has only the unique local IPv6 address %s, which does not reach the internet; skipped %d IPv6 resolvers (use -ip both to query them anyway)",
+			network.Addr6, len(skipped))
+	}
+	return fmt.Sprintf("this host has no %s route; skipped %d %s resolvers (use -ip both to query them anyway)",
+		family, len(skipped), family)
+}
+
+// familyOutage is an address family whose resolvers all failed.
+type familyOutage struct {
+	Family        string
+	Resolvers     int
+	OtherAnswered bool
+}
+
+// familyOutages returns the families whose resolvers all failed because of
+// the network rather than the resolvers: a resolver of the other family
+// answered, or the host has no route for the family. answered reports
+// whether servers[i] answered.
+func familyOutages(servers []bench.DNSServer, answered func(i int) bool, network NetworkInfo) []familyOutage {
+	total, ok := make(map[string]int), make(map[string]int)
+	for i, s := range servers {
+		family := familyName(s)
+		total[family]++
+		if answered(i) {
+			ok[family]++
+		}
+	}
+
+	// Without any egress address the detection failed, and only the other
+	// family can tell whether the network is at fault.
+	detected := network.Addr != "" || network.Addr6 != ""
+	var outages []familyOutage
+	for _, family := range []string{"IPv4", "IPv6"} {
+		if total[family] == 0 || ok[family] > 0 {
+			continue
+		}
+		otherAnswered := ok["IPv4"]+ok["IPv6"] > 0
+		if otherAnswered || detected && !hasRoute(network, family) {
+			outages = append(outages, familyOutage{Family: family, Resolvers: total[family], OtherAnswered: otherAnswered})
+		}
+	}
+	return outages
+}
+
+// resultOutages returns the families of results that failed completely.
+func resultOutages(results []bench.BenchmarkResult, network NetworkInfo) []familyOutage {
+	servers := make([]bench.DNSServer, 0, len(results))
+	for _, r := range results {
+		servers = append(servers, r.Server)
+	}
+	return familyOutages(servers, func(i int) bool { return !results[i].Failed() }, network)
+}
+
+// DualStackRow compares the IPv4 and IPv6 endpoints of one provider, using
+// the fastest endpoint of each family. Medians of a family without a
+// successful endpoint are NaN.
+type DualStackRow struct {
+	Provider    string  `json:"provider"`
+	IPv4        string  `json:"ipv4,omitempty"`
+	IPv6        string  `json:"ipv6,omitempty"`
+	IPv4Median  float64 `json:"ipv4Median"`
+	IPv6Median  float64 `json:"ipv6Median"`
+	IPv4Success float64 `json:"ipv4SuccessRate"`
+	IPv6Success float64 `json:"ipv6SuccessRate"`
+	// Penalty is the IPv6 median minus the IPv4 median in milliseconds; it
+	// is negative when IPv6 is faster.
+	Penalty float64 `json:"v6Penalty"`
+}
+
+// MarshalJSON writes the medians and penalty of a failed family as null.
+func (r DualStackRow) MarshalJSON() ([]byte, error) {
+	type plain DualStackRow
+	return jsonnan.Marshal(plain(r))
+}
+
+// DualStack compares the providers that were measured over both IPv4 and IPv6.
+type DualStack struct {
+	Providers []DualStackRow `json:"providers"`
+	// Broken is "IPv4" or "IPv6" when every resolver of that family failed
+	// while the other family answered: the network, not the resolvers, is
+	// at fault.
+	Broken          string `json:"broken,omitempty"`
+	BrokenResolvers int    `json:"brokenResolvers,omitempty"`
+}
+
+// numberedSuffix matches the "-2" or "-v6-1" of catalogue names.
+var numberedSuffix = regexp.MustCompile(`(-v[46])?(-\d+)?$`)
+
+// providerOf groups the endpoints of a provider: by DNSServer.Provider, or
+// for resolvers without one by their name without a "-v6-1" style suffix.
+func providerOf(s bench.DNSServer) string {
+	if s.Provider != "" {
+		return s.Provider
+	}
+	if name := numberedSuffix.ReplaceAllString(s.Name, ""); name != "" {
+		return name
+	}
+	return s.Name
+}
+
+// dualStack compares the IPv4 and IPv6 results of every provider. It returns
+// nil unless results cover both families.
+func dualStack(results []bench.BenchmarkResult) *DualStack {
+	var (
+		order     []string
+		providers = make(map[string]*DualStackRow)
+		families  = make(map[string]map[string]bool)
+		total     = make(map[string]int)
+		ok        = make(map[string]int)
+	)
+	for _, r := range results {
+		family := familyName(r.Server)
+		total[family]++
+		name := providerOf(r.Server)
+		row := providers[name]
+		if row == nil {
+			row = &DualStackRow{Provider: name, IPv4Median: math.NaN(), IPv6Median: math.NaN()}
+			providers[name] = row
+			families[name] = make(map[string]bool)
+			order = append(order, name)
+		}
+		families[name][family] = true
+		if r.Failed() {
+			continue
+		}
+		ok[family]++
+
+		endpoint, median, success := &row.IPv4, &row.IPv4Median, &row.IPv4Success
+		if family == "IPv6" {
+			endpoint, median, success = &row.IPv6, &row.IPv6Median, &row.IPv6Success
+		}
+		if math.IsNaN(*median) || r.Stats.Median < *median {
+			*endpoint, *median, *success = r.Server.Name, r.Stats.Median, r.Stats.SuccessRate()*100
+		}
+	}
+	if total["IPv4"] == 0 || total["IPv6"] == 0 {
+		return nil
+	}
+
+	ds := &DualStack{Providers: []DualStackRow{}}
+	for _, family := range []string{"IPv4", "IPv6"} {
+		if ok[family] == 0 && ok["IPv4"]+ok["IPv6"] > 0 {
+			ds.Broken, ds.BrokenResolvers = family, total[family]
+		}
+	}
+	for _, name := range order {
+		row := providers[name]
+		if len(families[name]) < 2 {
+			continue
+		}
+		row.Penalty = row.IPv6Median - row.IPv4Median
+		ds.Providers = append(ds.Providers, *row)
+	}
+	return ds
+}
+
+// withoutFamily drops the results of family.
+func withoutFamily(results []bench.BenchmarkResult, family string) []bench.BenchmarkResult {
+	return slices.DeleteFunc(slices.Clone(results), func(r bench.BenchmarkResult) bool {
+		return familyName(r.Server) == family
+	})
+}
+
+// brokenNote explains why every resolver of the family of o failed.
+func brokenNote(o familyOutage, network NetworkInfo) string {
+	other, flag, addr := "IPv6", "-ip 6", network.Addr
+	if o.Family == "IPv6" {
+		other, flag, addr = "IPv4", "-ip 4", network.Addr6
+	}
+	failed := fmt.Sprintf("all %d %s resolvers failed", o.Resolvers, o.Family)
+	hint := "Check the network connection."
+	if o.OtherAnswered {
+		failed += fmt.Sprintf(" while %s ones answered", other)
+		hint = fmt.Sprintf("Run with %s or the default -ip auto to leave them out.", flag)
+	}
+	switch {
+	case hasRoute(network, o.Family):
+		return fmt.Sprintf("%s looks broken on this network: %s, although the host has the %s address %s. Check its %s route and firewall, or run with %s.",
+			o.Family, failed, o.Family, addr, o.Family, flag)
+	case addr != "":
+		return fmt.Sprintf("%s is not available on this host: %s, and its only %s address, %s, is unique local. %s",
+			o.Family, failed, o.Family, addr, hint)
+	default:
+		return fmt.Sprintf("%s is not available on this host: %s. %s", o.Family, failed, hint)
+	}
+}
+
+func hasDualStackRows(ds *DualStack) bool {
+	return ds != nil && slices.ContainsFunc(ds.Providers, func(r DualStackRow) bool { return !math.IsNaN(r.Penalty) })
+}
+
+// printDualStackTable lists the providers measured over both families side
+// by side. Providers where either family failed are shown with dashes.
+//
+//nolint:errcheck // printing helper
+func printDualStackTable(w io.Writer, ds *DualStack) {
+	_, _ = fmt.Fprintf(w, "%-20s %12s %12s %15s %10s %10s %10s\n",
+		"Provider", "IPv4 Med(ms)", "IPv6 Med(ms)", "v6 Penalty(ms)", "Penalty", "IPv4 OK", "IPv6 OK")
+	ms := func(v float64) string {
+		if math.IsNaN(v) {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", v)
+	}
+	for _, r := range ds.Providers {
+		percent := "-"
+		if !math.IsNaN(r.Penalty) && r.IPv4Median > 0 {
+			percent = fmt.Sprintf("%+.0f%%", r.Penalty/r.IPv4Median*100)
+		}
+		penalty := "-"
+		if !math.IsNaN(r.Penalty) {
+			penalty = fmt.Sprintf("%+.2f", r.Penalty)
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %12s %12s %15s %10s %9.1f%% %9.1f%%\n",
+			truncateString(r.Provider, 20), ms(r.IPv4Median), ms(r.IPv6Median), penalty, percent, r.IPv4Success, r.IPv6Success)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+var testDualStackServers = []bench.DNSServer{
+	{Name: "Cloudflare-1", Addr: "1.1.1.1", Provider: "Cloudflare"},
+	{Name: "Cloudflare-v6-1", Addr: "2606:4700:4700::1111", Provider: "Cloudflare"},
+	{Name: "Internal-1", Addr: "10.0.0.53"},
+}
+
+func serverNames(servers []bench.DNSServer) []string {
+	names := make([]string, 0, len(servers))
+	for _, s := range servers {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestSelectFamilies(t *testing.T) {
+	dualStack := NetworkInfo{Addr: "192.0.2.2", Addr6: "2001:db8::2"}
+	v4Only := NetworkInfo{Addr: "192.0.2.2"}
+	v6Only := NetworkInfo{Addr6: "2001:db8::2"}
+	uniqueLocal := NetworkInfo{Addr: "192.0.2.2", Addr6: "fd00::2"}
+
+	tests := []struct {
+		name        string
+		family      IPFamily
+		network     NetworkInfo
+		servers     []bench.DNSServer
+		wantKept    []string
+		wantSkipped []string
+		wantErr     bool
+	}{
+		{name: "Auto dual-stack", family: IPAuto, network: dualStack, servers: testDualStackServers, wantKept: []string{"Cloudflare-1", "Cloudflare-v6-1", "Internal-1"}},
+		{name: "Auto IPv4 only", family: IPAuto, network: v4Only, servers: testDualStackServers, wantKept: []string{"Cloudflare-1", "Internal-1"}, wantSkipped: []string{"Cloudflare-v6-1"}},
+		{name: "Auto IPv6 only", family: IPAuto, network: v6Only, servers: testDualStackServers, wantKept: []string{"Cloudflare-v6-1"}, wantSkipped: []string{"Cloudflare-1", "Internal-1"}},
+		{name: "Auto unique local IPv6", family: IPAuto, network: uniqueLocal, servers: testDualStackServers, wantKept: []string{"Cloudflare-1", "Internal-1"}, wantSkipped: []string{"Cloudflare-v6-1"}},
+		{name: "Auto without routes", family: IPAuto, servers: testDualStackServers, wantKept: []string{"Cloudflare-1", "Cloudflare-v6-1", "Internal-1"}},
+		{name: "Auto keeps the only family", family: IPAuto, network: v4Only, servers: testDualStackServers[1:2], wantKept: []string{"Cloudflare-v6-1"}},
+		{name: "Both", family: IPBoth, network: v4Only, servers: testDualStackServers, wantKept: []string{"Cloudflare-1", "Cloudflare-v6-1", "Internal-1"}},
+		{name: "IPv6", family: IP6, network: dualStack, servers: testDualStackServers, wantKept: []string{"Cloudflare-v6-1"}},
+		{name: "IPv6 without resolvers", family: IP6, network: dualStack, servers: testDualStackServers[2:], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped, err := selectFamilies(tt.servers, tt.family, tt.network)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectFamilies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := serverNames(kept); !slices.Equal(got, tt.wantKept) {
+				t.Errorf("kept = %v, want %v", got, tt.wantKept)
+			}
+			if got := serverNames(skipped); !slices.Equal(got, tt.wantSkipped) {
+				t.Errorf("skipped = %v, want %v", got, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestProviderOf(t *testing.T) {
+	tests := []struct {
+		server bench.DNSServer
+		want   string
+	}{
+		{server: bench.DNSServer{Name: "Cloudflare-v6-1", Provider: "Cloudflare"}, want: "Cloudflare"},
+		{server: bench.DNSServer{Name: "Office-v6-2"}, want: "Office"},
+		{server: bench.DNSServer{Name: "Office-1"}, want: "Office"},
+		{server: bench.DNSServer{Name: "Router"}, want: "Router"},
+		{server: bench.DNSServer{Name: "-1"}, want: "-1"},
+	}
+
+	for _, tt := range tests {
+		if got := providerOf(tt.server); got != tt.want {
+			t.Errorf("providerOf(%q) = %q, want %q", tt.server.Name, got, tt.want)
+		}
+	}
+}
+
+func TestDualStack(t *testing.T) {
+	if ds := dualStack([]bench.BenchmarkResult{withAddr(testResult("A-1", 10), "192.0.2.1")}); ds != nil {
+		t.Errorf("dualStack() of IPv4 results = %+v, want nil", ds)
+	}
+
+	ds := dualStack([]bench.BenchmarkResult{
+		withAddr(testResult("A-1", 10, 10), "192.0.2.1"),
+		withAddr(testResult("A-2", 8, 8), "192.0.2.2"),
+		withAddr(testResult("A-v6-1", 12, 12), "2001:db8::1"),
+		withAddr(testResult("B-1", 20, 20), "192.0.2.3"),
+		deadResult("B-v6-1", "2001:db8::3"),
+		withAddr(testResult("C-1", 5), "192.0.2.4"),
+	})
+	if ds == nil || ds.Broken != "" || len(ds.Providers) != 2 {
+		t.Fatalf("dualStack() = %+v, want providers A and B", ds)
+	}
+	a, b := ds.Providers[0], ds.Providers[1]
+	if a.Provider != "A" || a.IPv4 != "A-2" || a.Penalty != 4 || a.IPv6Success != 100 {
+		t.Errorf("A = %+v, want A-2 as the IPv4 endpoint and a 4ms penalty", a)
+	}
+	if b.Provider != "B" || !math.IsNaN(b.IPv6Median) || !math.IsNaN(b.Penalty) {
+		t.Errorf("B = %+v, want a failed IPv6 family", b)
+	}
+
+	broken := dualStack([]bench.BenchmarkResult{
+		withAddr(testResult("A-1", 10), "192.0.2.1"),
+		deadResult("A-v6-1", "2001:db8::1"),
+		deadResult("B-v6-1", "2001:db8::2"),
+	})
+	if broken.Broken != "IPv6" || broken.BrokenResolvers != 2 {
+		t.Fatalf("Broken = %q, %d, want IPv6, 2", broken.Broken, broken.BrokenResolvers)
+	}
+}
+
+func TestFamilyOutages(t *testing.T) {
+	v4Answered := []bench.BenchmarkResult{
+		withAddr(testResult("A-1", 10), "192.0.2.1"),
+		deadResult("A-v6-1", "2001:db8::1"),
+		deadResult("B-v6-1", "2001:db8::2"),
+	}
+	nothingAnswered := []bench.BenchmarkResult{deadResult("A-v6-1", "2001:db8::1"), deadResult("B-v6-1", "2001:db8::2")}
+
+	tests := []struct {
+		name     string
+		results  []bench.BenchmarkResult
+		network  NetworkInfo
+		want     []familyOutage
+		wantNote string
+	}{
+		{
+			name:     "No IPv6 address",
+			results:  v4Answered,
+			network:  NetworkInfo{Addr: "192.0.2.2"},
+			want:     []familyOutage{{Family: "IPv6", Resolvers: 2, OtherAnswered: true}},
+			wantNote: "IPv6 is not available on this host: all 2 IPv6 resolvers failed while IPv4 ones answered.",
+		},
+		{
+			name:     "Global IPv6 address",
+			results:  v4Answered,
+			network:  NetworkInfo{Addr: "192.0.2.2", Addr6: "2001:db8::2"},
+			want:     []familyOutage{{Family: "IPv6", Resolvers: 2, OtherAnswered: true}},
+			wantNote: "IPv6 looks broken on this network",
+		},
+		{
+			name:     "Only a unique local address",
+			results:  nothingAnswered,
+			network:  NetworkInfo{Addr6: "fd00::2"},
+			want:     []familyOutage{{Family: "IPv6", Resolvers: 2}},
+			wantNote: "its only IPv6 address, fd00::2, is unique local",
+		},
+		{name: "Resolvers at fault", results: nothingAnswered, network: NetworkInfo{Addr6: "2001:db8::2"}},
+		{name: "Network unknown", results: nothingAnswered},
+		{name: "Both families answered", results: append(v4Answered, withAddr(testResult("C-v6-1", 10), "2001:db8::3")), network: NetworkInfo{Addr: "192.0.2.2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resultOutages(tt.results, tt.network)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("resultOutages() = %+v, want %+v", got, tt.want)
+			}
+			if len(got) > 0 {
+				if note := brokenNote(got[0], tt.network); !strings.Contains(note, tt.wantNote) {
+					t.Errorf("brokenNote() = %q, want it to contain %q", note, tt.wantNote)
+				}
+			}
+		})
+	}
+}
@@ -4,5 +4,7 @@ go 1.24.5
 
 require (
 	github.com/phsym/console-slog v0.3.1
+	golang.org/x/net v0.50.0
 	golang.org/x/sync v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// historySummaryDir is the subdirectory of the history directory that holds
+// the summary of each run.
+const historySummaryDir = "summaries"
+
+// Sources a stored run can come from.
+const (
+	SourceCLI     = "cli"
+	SourceUI      = "ui"
+	SourceMonitor = "monitor"
+)
+
+var (
+	errRunNotFound = errors.New("run not found")
+
+	historyIDPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z._-]*$`)
+)
+
+// HistoryRecord is a persisted benchmark run with everything needed to
+// reproduce or re-analyse it.
+type HistoryRecord struct {
+	ID        string             `json:"id"`
+	Source    string             `json:"source"`
+	Started   time.Time          `json:"started"`
+	Finished  time.Time          `json:"finished"`
+	Options   runOptions         `json:"options"`
+	Resolvers []bench.DNSServer  `json:"resolvers"`
+	Domains   []string           `json:"domains"`
+	Results   resultsWithSamples `json:"results"`
+	Manifest  *Manifest          `json:"manifest,omitempty"`
+}
+
+// resultsWithSamples are results stored with their raw samples, which
+// bench.BenchmarkResult leaves out of its JSON.
+type resultsWithSamples []bench.BenchmarkResult
+
+// sampledResult is the stored form of a result with its samples.
+type sampledResult struct {
+	bench.BenchmarkResult
+	Samples []bench.Sample `json:"samples,omitempty"`
+}
+
+func (r resultsWithSamples) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	stored := make([]sampledResult, len(r))
+	for i, res := range r {
+		stored[i] = sampledResult{BenchmarkResult: res, Samples: res.Samples}
+	}
+	return json.Marshal(stored)
+}
+
+func (r *resultsWithSamples) UnmarshalJSON(data []byte) error {
+	var stored []sampledResult
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*r = nil
+	for _, s := range stored {
+		s.BenchmarkResult.Samples = s.Samples
+		*r = append(*r, s.BenchmarkResult)
+	}
+	return nil
+}
+
+// HistorySummary describes a stored run without its results.
+type HistorySummary struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Resolvers int       `json:"resolvers"`
+	Domains   int       `json:"domains"`
+	Queries   int       `json:"queries"`
+	Failed    int       `json:"failed"`
+	Fastest   string    `json:"fastest,omitempty"`
+}
+
+// RetentionPolicy bounds how many runs the history keeps. Zero values disable
+// the corresponding limit.
+type RetentionPolicy struct {
+	MaxRuns int
+	MaxAge  time.Duration
+}
+
+// HistoryStore keeps one JSON file per run in a directory, and the summary
+// of each run in a small file of its own in the summaries subdirectory, so
+// that listing and pruning do not read the samples of every run.
+type HistoryStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// defaultHistoryDir returns the per-user history directory, or "" if the
+// platform has no config directory.
+func defaultHistoryDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dnsbench", "history")
+}
+
+func openHistory(dir string) (*HistoryStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, historySummaryDir), 0o750); err != nil {
+		return nil, fmt.Errorf("creating history directory: %w", err)
+	}
+	return &HistoryStore{dir: dir}, nil
+}
+
+// Save writes rec, assigning an ID derived from its start time if it has none.
+func (h *HistoryStore) Save(rec *HistoryRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if rec.ID == "" {
+		rec.ID = rec.Started.UTC().Format("20060102-150405.000000")
+	}
+	if !historyIDPattern.MatchString(rec.ID) {
+		return fmt.Errorf("invalid run id %q", rec.ID)
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding run: %w", err)
+	}
+	if err := writeFileAtomic(h.path(rec.ID), data); err != nil {
+		return err
+	}
+	return h.saveSummary(rec.Summary())
+}
+
+// saveSummary writes the listing entry of a run next to its file.
+func (h *HistoryStore) saveSummary(summary HistorySummary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("encoding run summary: %w", err)
+	}
+	return writeFileAtomic(h.summaryPath(summary.ID), data)
+}
+
+// writeFileAtomic writes data to a temporary file first and renames it to
+// path, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".run-*")
+	if err != nil {
+		return fmt.Errorf("creating run file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()           //nolint:errcheck // already failing
+		_ = os.Remove(tmp.Name()) //nolint:errcheck // best-effort cleanup
+		return fmt.Errorf("writing run file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name()) //nolint:errcheck // best-effort cleanup
+		return fmt.Errorf("writing run file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load returns the stored run with the given ID.
+func (h *HistoryStore) Load(id string) (*HistoryRecord, error) {
+	if !historyIDPattern.MatchString(id) {
+		return nil, errRunNotFound
+	}
+
+	data, err := os.ReadFile(h.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errRunNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading run %s: %w", id, err)
+	}
+
+	var rec HistoryRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parsing run %s: %w", id, err)
+	}
+	return &rec, nil
+}
+
+// List summarises all stored runs, newest first, from their summary files.
+// A run stored without one, by an older version, is read once to write it.
+// Unreadable files are logged and skipped.
+func (h *HistoryStore) List() ([]HistorySummary, error) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading history directory: %w", err)
+	}
+
+	summaries := make([]HistorySummary, 0, len(entries))
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok || !historyIDPattern.MatchString(id) {
+			continue
+		}
+		summary, err := h.summary(id)
+		if err != nil {
+			slog.Warn("Skipping unreadable run", slog.String("id", id), logattr.Err(err))
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+
+	slices.SortFunc(summaries, func(a, b HistorySummary) int {
+		return cmp.Or(b.Started.Compare(a.Started), strings.Compare(b.ID, a.ID))
+	})
+	return summaries, nil
+}
+
+// summary returns the listing entry of the run with the given ID.
+func (h *HistoryStore) summary(id string) (HistorySummary, error) {
+	var summary HistorySummary
+	data, err := os.ReadFile(h.summaryPath(id))
+	if err == nil && json.Unmarshal(data, &summary) == nil && summary.ID == id {
+		return summary, nil
+	}
+
+	rec, err := h.Load(id)
+	if err != nil {
+		return summary, err
+	}
+	summary = rec.Summary()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.saveSummary(summary); err != nil {
+		slog.Warn("Could not write run summary", slog.String("id", id), logattr.Err(err))
+	}
+	return summary, nil
+}
+
+// Delete removes the stored run with the given ID.
+func (h *HistoryStore) Delete(id string) error {
+	if !historyIDPattern.MatchString(id) {
+		return errRunNotFound
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err := os.Remove(h.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return errRunNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(h.summaryPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Prune deletes runs that fall outside the retention policy and returns
+// their IDs.
+func (h *HistoryStore) Prune(policy RetentionPolicy) ([]string, error) {
+	runs, err := h.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	cutoff := time.Now().Add(-policy.MaxAge)
+	for i, run := range runs {
+		tooMany := policy.MaxRuns > 0 && i >= policy.MaxRuns
+		tooOld := policy.MaxAge > 0 && run.Started.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := h.Delete(run.ID); err != nil && !errors.Is(err, errRunNotFound) {
+			return removed, err
+		}
+		removed = append(removed, run.ID)
+	}
+	return removed, nil
+}
+
+func (h *HistoryStore) path(id string) string {
+	return filepath.Join(h.dir, id+".json")
+}
+
+func (h *HistoryStore) summaryPath(id string) string {
+	return filepath.Join(h.dir, historySummaryDir, id+".json")
+}
+
+// Summary returns the listing entry for the run.
+func (r *HistoryRecord) Summary() HistorySummary {
+	s := HistorySummary{
+		ID:        r.ID,
+		Source:    r.Source,
+		Started:   r.Started,
+		Finished:  r.Finished,
+		Resolvers: len(r.Resolvers),
+		Domains:   len(r.Domains),
+	}
+
+	best := math.Inf(1)
+	for _, res := range r.Results {
+		s.Queries += res.Stats.Total
+		if res.Failed() {
+			s.Failed++
+			continue
+		}
+		if res.Stats.Median < best {
+			best = res.Stats.Median
+			s.Fastest = res.Server.Name
+		}
+	}
+	return s
+}
+
+// recordRun stores a finished run in the configured history and applies the
+// retention policy. Failures are logged; they never fail the benchmark itself.
+func recordRun(ctx context.Context, config *Config, source string, manifest *Manifest, servers []bench.DNSServer, domains []string, results []bench.BenchmarkResult) {
+	if config.HistoryDir == "" {
+		return
+	}
+
+	store, err := openHistory(config.HistoryDir)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Could not open run history", logattr.Err(err))
+		return
+	}
+
+	rec := &HistoryRecord{
+		Source:    source,
+		Started:   manifest.Started,
+		Finished:  manifest.Finished,
+		Options:   optionsFromConfig(config),
+		Resolvers: servers,
+		Domains:   domains,
+		Results:   results,
+		Manifest:  manifest,
+	}
+	if err := store.Save(rec); err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Could not save run to history", logattr.Err(err))
+		return
+	}
+	slog.LogAttrs(ctx, slog.LevelDebug, "Saved run to history", slog.String("id", rec.ID))
+
+	removed, err := store.Prune(config.Retention)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Could not prune run history", logattr.Err(err))
+	}
+	if len(removed) > 0 {
+		slog.LogAttrs(ctx, slog.LevelDebug, "Pruned run history", slog.Int("removed", len(removed)))
+	}
+}
+
+// runHistoryCommand implements "dnsbench history <list|show|delete|prune>"
+// and returns the process exit code.
+func runHistoryCommand(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	dir := fs.String("dir", defaultHistoryDir(), "History directory")
+	outputType := fs.String("output", "default", "Output format for list and show: default, csv, table, or json")
+	keep := fs.Int("keep", 0, "prune: number of newest runs to keep (0 keeps all)")
+	keepFor := fs.Duration("keep-for", 0, "prune: delete runs older than this (e.g. 720h, 0 keeps all)")
+	fs.Usage = func() {
+		//nolint:errcheck // best-effort help output
+		_, _ = fmt.Fprintf(fs.Output(), `Usage:
+  dnsbench history list [options]
+  dnsbench history show [options] <id>
+  dnsbench history delete [options] <id>...
+  dnsbench history prune [options]
+
+Options:
+`)
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	command := args[0]
+	if command == "-h" || command == "-help" || command == "--help" {
+		fs.Usage()
+		return 0
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	output, err := parseOutputType(*outputType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *dir == "" {
+		fmt.Fprintf(os.Stderr, "Error: no history directory, use -dir\n")
+		return 1
+	}
+	store, err := openHistory(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch command {
+	case "list":
+		err = historyList(store, output)
+	case "show":
+		if fs.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Error: show takes exactly one run id\n")
+			return 2
+		}
+		err = historyShow(store, fs.Arg(0), output)
+	case "delete":
+		if fs.NArg() == 0 {
+			fmt.Fprintf(os.Stderr, "Error: delete takes at least one run id\n")
+			return 2
+		}
+		for _, id := range fs.Args() {
+			if err = store.Delete(id); err != nil {
+				err = fmt.Errorf("%s: %w", id, err)
+				break
+			}
+			fmt.Printf("Deleted %s\n", id)
+		}
+	case "prune":
+		if *keep <= 0 && *keepFor <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: prune needs -keep or -keep-for\n")
+			return 2
+		}
+		var removed []string
+		removed, err = store.Prune(RetentionPolicy{MaxRuns: *keep, MaxAge: *keepFor})
+		fmt.Printf("Pruned %d runs\n", len(removed))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown history command %q\n", command)
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+//nolint:errcheck // printing helper
+func historyList(store *HistoryStore, output OutputType) error {
+	runs, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	if output == OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(runs)
+	}
+
+	if len(runs) == 0 {
+		fmt.Println("No stored runs")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tSTARTED\tSOURCE\tRESOLVERS\tDOMAINS\tQUERIES\tFAILED\tFASTEST")
+	for _, r := range runs {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			r.ID, r.Started.Local().Format(time.DateTime), r.Source,
+			r.Resolvers, r.Domains, r.Queries, r.Failed, r.Fastest)
+	}
+	return tw.Flush()
+}
+
+func historyShow(store *HistoryStore, id string, output OutputType) error {
+	rec, err := store.Load(id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", id, err)
+	}
+
+	if output == OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rec)
+	}
+
+	if output == OutputDefault {
+		fmt.Printf("Run %s (%s)\n", rec.ID, rec.Source)
+		fmt.Printf("Started %s, took %s\n",
+			rec.Started.Local().Format(time.DateTime), rec.Finished.Sub(rec.Started).Round(time.Second))
+		fmt.Printf("%d resolvers, %d domains\n", len(rec.Resolvers), len(rec.Domains))
+	}
+	printSummary(rec.Results, output, SortDefault, rec.Manifest)
+	return nil
+}
+
+type pruneRequest struct {
+	MaxRuns  int   `json:"maxRuns"`
+	MaxAgeMs int64 `json:"maxAgeMs"`
+}
+
+func (s *uiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.history == nil {
+		http.Error(w, "run history is disabled", http.StatusNotFound)
+		return
+	}
+
+	runs, err := s.history.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, runs)
+}
+
+// handleHistoryRun serves GET and DELETE on /api/history/{id} and POST on
+// /api/history/prune.
+func (s *uiServer) handleHistoryRun(w http.ResponseWriter, r *http.Request) {
+	if s.history == nil {
+		http.Error(w, "run history is disabled", http.StatusNotFound)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/history/")
+
+	if id == "prune" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		policy := s.baseConfig.Retention
+		if r.ContentLength != 0 {
+			var req pruneRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			policy = RetentionPolicy{MaxRuns: req.MaxRuns, MaxAge: time.Duration(req.MaxAgeMs) * time.Millisecond}
+		}
+		removed, err := s.history.Prune(policy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string][]string{"removed": removed})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rec, err := s.history.Load(id)
+		if errors.Is(err, errRunNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, rec)
+	case http.MethodDelete:
+		err := s.history.Delete(id)
+		if errors.Is(err, errRunNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestHistoryStore_SaveLoad(t *testing.T) {
+	store, err := openHistory(t.TempDir())
+	if err != nil {
+		t.Fatalf("openHistory() error = %v", err)
+	}
+
+	dead := bench.BenchmarkResult{
+		Server:  bench.DNSServer{Name: "dead", Addr: "192.0.2.2"},
+		Stats:   bench.CalculateStats(nil, 4, 4),
+		Failure: "unreachable in pre-flight probe: timeout",
+	}
+	rec := &HistoryRecord{
+		Source:  SourceCLI,
+		Started: time.Now(),
+		Domains: []string{"example.com"},
+		Results: []bench.BenchmarkResult{testResult("fast", 1, 2, 3), dead},
+	}
+	if err := store.Save(rec); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if rec.ID == "" {
+		t.Fatal("Save() did not assign an id")
+	}
+
+	got, err := store.Load(rec.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(got.Results) != 2 || len(got.Results[0].Samples) != 3 {
+		t.Fatalf("Load() results = %+v, want 2 results with samples", got.Results)
+	}
+	if got.Results[0].Stats.Median != 2 {
+		t.Errorf("Load() median = %v, want 2", got.Results[0].Stats.Median)
+	}
+	if !math.IsNaN(got.Results[1].Stats.Median) || got.Results[1].Stats.Errors != 4 {
+		t.Errorf("Load() failed stats = %+v, want NaN median and 4 errors", got.Results[1].Stats)
+	}
+
+	summary := got.Summary()
+	if summary.Fastest != "fast" || summary.Failed != 1 || summary.Queries != 7 {
+		t.Errorf("Summary() = %+v, want fastest=fast, failed=1, queries=7", summary)
+	}
+
+	if _, err := store.Load("../etc/passwd"); !errors.Is(err, errRunNotFound) {
+		t.Errorf("Load(traversal) error = %v, want errRunNotFound", err)
+	}
+}
+
+func TestHistoryStore_Prune(t *testing.T) {
+	store, err := openHistory(t.TempDir())
+	if err != nil {
+		t.Fatalf("openHistory() error = %v", err)
+	}
+
+	now := time.Now()
+	for _, age := range []time.Duration{0, time.Hour, 2 * time.Hour, 48 * time.Hour} {
+		if err := store.Save(&HistoryRecord{Source: SourceCLI, Started: now.Add(-age)}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	removed, err := store.Prune(RetentionPolicy{MaxAge: 24 * time.Hour})
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("Prune(max age) = %v, %v, want 1 removed", removed, err)
+	}
+
+	removed, err = store.Prune(RetentionPolicy{MaxRuns: 2})
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("Prune(max runs) = %v, %v, want 1 removed", removed, err)
+	}
+
+	runs, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(runs) != 2 || !runs[0].Started.After(runs[1].Started) {
+		t.Errorf("List() = %+v, want the 2 newest runs, newest first", runs)
+	}
+
+	if err := store.Delete(runs[0].ID); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := store.Delete(runs[0].ID); !errors.Is(err, errRunNotFound) {
+		t.Errorf("Delete(again) error = %v, want errRunNotFound", err)
+	}
+}
+
+func TestHistoryStore_ListFromSummaries(t *testing.T) {
+	store, err := openHistory(t.TempDir())
+	if err != nil {
+		t.Fatalf("openHistory() error = %v", err)
+	}
+
+	now := time.Now()
+	stored := &HistoryRecord{Source: SourceCLI, Started: now, Results: []bench.BenchmarkResult{testResult("fast", 1, 2)}}
+	legacy := &HistoryRecord{Source: SourceCLI, Started: now.Add(-time.Hour)}
+	for _, rec := range []*HistoryRecord{stored, legacy} {
+		if err := store.Save(rec); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	// Listing reads the summary, not the run file, and rebuilds the
+	// summary of a run stored without one.
+	if err := os.WriteFile(store.path(stored.ID), []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(store.summaryPath(legacy.ID)); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != stored.ID || runs[0].Fastest != "fast" || runs[1].ID != legacy.ID {
+		t.Errorf("List() = %+v, want both runs from their summaries", runs)
+	}
+	if _, err := os.Stat(store.summaryPath(legacy.ID)); err != nil {
+		t.Errorf("List() did not write the missing summary: %v", err)
+	}
+
+	if err := store.Delete(stored.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(store.summaryPath(stored.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Delete() left the summary behind: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Package jsonnan encodes structs as JSON with NaN floats written as null.
+package jsonnan
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Marshal encodes the struct v like encoding/json, except that NaN floats,
+// including those of nested structs, are written as null since JSON has no
+// representation for them. It is meant to be called from MarshalJSON methods
+// on a method-less copy of the type:
+//
+//	func (s Stats) MarshalJSON() ([]byte, error) {
+//		type plain Stats
+//		return jsonnan.Marshal(plain(s))
+//	}
+func Marshal(v any) ([]byte, error) {
+	fields, ok := nullNaNs(reflect.ValueOf(v)).(jsonFields)
+	if !ok {
+		return json.Marshal(v)
+	}
+	return fields.MarshalJSON()
+}
+
+var jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+
+func nullNaNs(v reflect.Value) any {
+	switch {
+	case v.Type().Implements(jsonMarshalerType):
+		return v.Interface()
+	case v.Kind() == reflect.Float64:
+		if math.IsNaN(v.Float()) {
+			return nil
+		}
+		return v.Float()
+	case v.Kind() == reflect.Struct:
+		fields := make(jsonFields, 0, v.NumField())
+		for i := range v.NumField() {
+			name, opts, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			if strings.Contains(opts, "omitempty") && v.Field(i).IsZero() {
+				continue
+			}
+			fields = append(fields, jsonField{name: name, value: nullNaNs(v.Field(i))})
+		}
+		return fields
+	default:
+		return v.Interface()
+	}
+}
+
+type jsonField struct {
+	name  string
+	value any
+}
+
+// jsonFields marshals as an object while preserving field order.
+type jsonFields []jsonField
+
+func (f jsonFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
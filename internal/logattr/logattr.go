@@ -0,0 +1,13 @@
+// Package logattr builds the slog attributes shared by dnsbench and its
+// benchmark library.
+package logattr
+
+import "log/slog"
+
+// Err returns err as the "err" attribute.
+func Err(err error) slog.Attr {
+	if err != nil {
+		return slog.String("err", err.Error())
+	}
+	return slog.String("err", "<nil>")
+}
@@ -0,0 +1,23 @@
+// Package sleep waits for points in time without outliving a context.
+package sleep
+
+import (
+	"context"
+	"time"
+)
+
+// Until waits until t and returns false if ctx was canceled first.
+func Until(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
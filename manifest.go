@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version string
+
+// buildVersion returns the version of this binary, falling back to the
+// module version or VCS revision recorded by the Go toolchain.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var rev, dirty string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value[:min(len(s.Value), 12)]
+		case "vcs.modified":
+			if s.Value == "true" {
+				dirty = "-dirty"
+			}
+		}
+	}
+	if rev == "" {
+		return "devel"
+	}
+	return "devel-" + rev + dirty
+}
+
+// Manifest records how and from where a run was measured, so that results
+// taken on different machines or networks can be told apart later.
+type Manifest struct {
+	Version  string      `json:"version"`
+	Seed     uint64      `json:"seed"`
+	Started  time.Time   `json:"started"`
+	Finished time.Time   `json:"finished"`
+	Hostname string      `json:"hostname"`
+	OS       string      `json:"os"`
+	Network  NetworkInfo `json:"network"`
+	Config   *Config     `json:"config"`
+	// Client is the DNS client the run was measured with; runs recorded
+	// before it was added used bench.ClientGoResolver.
+	Client string `json:"client,omitempty"`
+	// Partial is set when the run was interrupted before every resolver was
+	// measured.
+	Partial bool `json:"partial,omitempty"`
+	// Skipped lists the resolvers left out with -ip auto because the host
+	// has no route for their address family.
+	Skipped []bench.DNSServer `json:"skipped,omitempty"`
+}
+
+// NetworkInfo describes the network path of the host at the start of a run.
+type NetworkInfo struct {
+	Interface string `json:"interface,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	// Addr6 is the IPv6 egress address; it is empty on hosts without an
+	// IPv6 route, as Addr is on IPv6-only hosts.
+	Addr6           string   `json:"addr6,omitempty"`
+	Gateway         string   `json:"gateway,omitempty"`
+	SystemResolvers []string `json:"systemResolvers,omitempty"`
+	// VPN is set when the egress interface looks like a tunnel.
+	VPN bool `json:"vpn,omitempty"`
+}
+
+// newManifest starts the manifest of a run with the settings in config. A
+// zero seed is replaced with a random one so the run can be repeated.
+func newManifest(config *Config) *Manifest {
+	snapshot := *config
+	snapshot.AgentToken = ""
+	for snapshot.Seed == 0 {
+		// 53 bits survive a round trip through JSON numbers in JavaScript.
+		//nolint:gosec // seeds backoff jitter, not security sensitive
+		snapshot.Seed = rand.Uint64() >> 11
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+	return &Manifest{
+		Version:  buildVersion(),
+		Seed:     snapshot.Seed,
+		Started:  time.Now(),
+		Hostname: hostname,
+		OS:       runtime.GOOS + "/" + runtime.GOARCH,
+		Network:  detectNetwork(),
+		Config:   &snapshot,
+		Client:   bench.ClientWire,
+	}
+}
+
+// vpnInterfacePrefixes are name prefixes of common tunnel interfaces.
+var vpnInterfacePrefixes = []string{"tun", "tap", "wg", "utun", "ppp", "ipsec", "tailscale", "zt", "nordlynx", "cscotun", "gpd"}
+
+func detectNetwork() NetworkInfo {
+	var info NetworkInfo
+
+	// Connecting a UDP socket sends nothing, but makes the kernel choose the
+	// route and with it the source address used to reach the internet.
+	if conn, err := net.Dial("udp", "1.1.1.1:53"); err == nil {
+		if local, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+			info.Addr = local.IP.String()
+			info.Interface = interfaceWithIP(local.IP)
+		}
+		_ = conn.Close() //nolint:errcheck // nothing was sent
+	}
+	if conn, err := net.Dial("udp6", "[2606:4700:4700::1111]:53"); err == nil {
+		if local, ok := conn.LocalAddr().(*net.UDPAddr); ok && local.IP.IsGlobalUnicast() {
+			info.Addr6 = local.IP.String()
+			if info.Interface == "" {
+				info.Interface = interfaceWithIP(local.IP)
+			}
+		}
+		_ = conn.Close() //nolint:errcheck // nothing was sent
+	}
+
+	info.VPN = slices.ContainsFunc(vpnInterfacePrefixes, func(p string) bool {
+		return info.Interface != "" && strings.HasPrefix(strings.ToLower(info.Interface), p)
+	})
+
+	//nolint:gosec // fixed system path
+	if f, err := os.Open("/proc/net/route"); err == nil {
+		info.Gateway = parseRouteTable(f, info.Interface)
+		_ = f.Close() //nolint:errcheck // read-only
+	}
+
+	info.SystemResolvers = readResolvConf("/etc/resolv.conf")
+	if slices.Equal(info.SystemResolvers, []string{"127.0.0.53"}) {
+		// systemd-resolved: report its upstream servers as well.
+		info.SystemResolvers = append(info.SystemResolvers, readResolvConf("/run/systemd/resolve/resolv.conf")...)
+	}
+	return info
+}
+
+func interfaceWithIP(ip net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
+
+// parseRouteTable returns the default gateway from a Linux /proc/net/route
+// table, preferring the route through iface.
+func parseRouteTable(r io.Reader, iface string) string {
+	var gateway string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || v == 0 {
+			continue
+		}
+		// The kernel writes the address in host (little-endian) byte order.
+		ip := net.IPv4(byte(v), byte(v>>8), byte(v>>16), byte(v>>24)).String()
+		if fields[0] == iface {
+			return ip
+		}
+		if gateway == "" {
+			gateway = ip
+		}
+	}
+	return gateway
+}
+
+func readResolvConf(path string) []string {
+	//nolint:gosec // fixed system path
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck // read-only
+	return parseResolvConf(f)
+}
+
+// parseResolvConf returns the nameserver entries of a resolv.conf file.
+func parseResolvConf(r io.Reader) []string {
+	var servers []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// networkDifferences lists how the networks of two runs differ; it is empty
+// when either run has no manifest.
+func networkDifferences(before, after *Manifest) []string {
+	if before == nil || after == nil {
+		return nil
+	}
+	var diffs []string
+	differ := func(what, a, b string) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", what, orDash(a), orDash(b)))
+		}
+	}
+	differ("host", before.Hostname, after.Hostname)
+	differ("egress interface", before.Network.Interface, after.Network.Interface)
+	differ("egress address", before.Network.Addr, after.Network.Addr)
+	differ("egress IPv6 address", before.Network.Addr6, after.Network.Addr6)
+	differ("gateway", before.Network.Gateway, after.Network.Gateway)
+	differ("system resolvers", strings.Join(before.Network.SystemResolvers, ","), strings.Join(after.Network.SystemResolvers, ","))
+	if before.Network.VPN != after.Network.VPN {
+		diffs = append(diffs, fmt.Sprintf("VPN: %t -> %t", before.Network.VPN, after.Network.VPN))
+	}
+	return diffs
+}
+
+// client returns the DNS client the run was measured with.
+func (m *Manifest) client() string {
+	if m.Client == "" {
+		return bench.ClientGoResolver
+	}
+	return m.Client
+}
+
+// clientDifference describes how the DNS clients of two runs differ; it is
+// empty when they are the same or either run has no manifest.
+func clientDifference(before, after *Manifest) string {
+	if before == nil || after == nil || before.client() == after.client() {
+		return ""
+	}
+	return before.client() + " -> " + after.client()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+//nolint:errcheck // printing helper
+func printManifest(w io.Writer, m *Manifest) {
+	n := m.Network
+	_, _ = fmt.Fprintf(w, "\nMeasured by dnsbench %s on %s (%s), seed %d\n", m.Version, orDash(m.Hostname), m.OS, m.Seed)
+	_, _ = fmt.Fprintf(w, "Network: %s %s, IPv6 %s via gateway %s, system resolvers %s\n",
+		orDash(n.Interface), orDash(n.Addr), orDash(n.Addr6), orDash(n.Gateway), orDash(strings.Join(n.SystemResolvers, ", ")))
+	if n.VPN {
+		_, _ = fmt.Fprintf(w, "Note: %s looks like a VPN tunnel\n", n.Interface)
+	}
+	if len(m.Skipped) > 0 {
+		_, _ = fmt.Fprintf(w, "Note: %s\n", skippedNote(m.Skipped, m.Network))
+	}
+	if m.client() != bench.ClientWire {
+		_, _ = fmt.Fprintf(w, "Note: measured with Go's resolver (an A and an AAAA query per lookup); latencies are not comparable with %s runs\n", bench.ClientWire)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testRouteTable = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+tun0	00000000	0100080A	0003	0	0	50	00000000	0	0	0
+`
+
+func TestParseRouteTable(t *testing.T) {
+	tests := []struct {
+		iface string
+		want  string
+	}{
+		{iface: "eth0", want: "192.168.1.1"},
+		{iface: "tun0", want: "10.8.0.1"},
+		{iface: "", want: "192.168.1.1"},
+	}
+
+	for _, tt := range tests {
+		if got := parseRouteTable(strings.NewReader(testRouteTable), tt.iface); got != tt.want {
+			t.Errorf("parseRouteTable(%q) = %q, want %q", tt.iface, got, tt.want)
+		}
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	conf := "# generated\nsearch example.com\nnameserver 10.0.0.53\nnameserver  2001:db8::53\noptions edns0\n"
+	want := []string{"10.0.0.53", "2001:db8::53"}
+	if got := parseResolvConf(strings.NewReader(conf)); !slices.Equal(got, want) {
+		t.Errorf("parseResolvConf() = %v, want %v", got, want)
+	}
+}
+
+func TestNetworkDifferences(t *testing.T) {
+	office := &Manifest{Hostname: "laptop", Network: NetworkInfo{Interface: "eth0", Addr: "192.168.1.10", Gateway: "192.168.1.1"}}
+	vpn := &Manifest{Hostname: "laptop", Network: NetworkInfo{Interface: "tun0", Addr: "10.8.0.2", Gateway: "192.168.1.1", VPN: true}}
+
+	if got := networkDifferences(office, office); len(got) != 0 {
+		t.Errorf("networkDifferences(same) = %v, want none", got)
+	}
+	if got := networkDifferences(office, nil); len(got) != 0 {
+		t.Errorf("networkDifferences(without manifest) = %v, want none", got)
+	}
+	got := networkDifferences(office, vpn)
+	want := []string{"egress interface: eth0 -> tun0", "egress address: 192.168.1.10 -> 10.8.0.2", "VPN: false -> true"}
+	if !slices.Equal(got, want) {
+		t.Errorf("networkDifferences() = %q, want %q", got, want)
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	config := &Config{Repeats: 3, OutputType: OutputJSON, SortBy: SortScore}
+
+	m := newManifest(config)
+	if m.Seed == 0 || m.Config.Seed != m.Seed {
+		t.Errorf("Seed = %d, Config.Seed = %d, want the same non-zero seed", m.Seed, m.Config.Seed)
+	}
+	if config.Seed != 0 {
+		t.Errorf("newManifest() changed the seed of the caller's config")
+	}
+	if seeded := newManifest(&Config{Seed: 7}); seeded.Seed != 7 {
+		t.Errorf("Seed = %d, want 7", seeded.Seed)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"OutputType":"json"`) {
+		t.Errorf("manifest JSON = %s, want the output type by name", data)
+	}
+	var decoded Manifest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if decoded.Config.OutputType != OutputJSON || decoded.Config.SortBy != SortScore || decoded.Config.Repeats != 3 {
+		t.Errorf("decoded Config = %+v", decoded.Config)
+	}
+}
+
+func TestClientDifference(t *testing.T) {
+	legacy := &Manifest{}
+	wire := newManifest(&Config{})
+
+	tests := []struct {
+		name          string
+		before, after *Manifest
+		want          string
+	}{
+		{name: "same client", before: wire, after: wire},
+		{name: "without manifest", before: legacy, after: nil},
+		{name: "before the wire client", before: legacy, after: wire, want: "go-resolver -> wire"},
+	}
+	for _, tt := range tests {
+		if got := clientDifference(tt.before, tt.after); got != tt.want {
+			t.Errorf("%s: clientDifference() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewManifest_OmitsAgentToken(t *testing.T) {
+	m := newManifest(&Config{AgentToken: "SECRET123", AgentName: "berlin"})
+	if m.Config.AgentToken != "" {
+		t.Errorf("Config.AgentToken = %q, want it cleared", m.Config.AgentToken)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if strings.Contains(string(data), "SECRET123") || strings.Contains(string(data), "AgentToken") {
+		t.Errorf("manifest JSON = %s, want no agent token", data)
+	}
+	if !strings.Contains(string(data), `"AgentName":"berlin"`) {
+		t.Errorf("manifest JSON = %s, want the agent name", data)
+	}
+}
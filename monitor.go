@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+	"github.com/handsomefox/dnsbench/internal/sleep"
+)
+
+// Monitor repeats a benchmark on a schedule and keeps a rolling window of
+// results per resolver. Failed cycles are logged and the next one runs as planned.
+type Monitor struct {
+	config   *Config
+	servers  []bench.DNSServer
+	domains  []string
+	schedule schedule
+	window   int
+
+	mu           sync.RWMutex
+	started      time.Time
+	cycles       int
+	failedCycles int
+	lastCycle    time.Time
+	nextCycle    time.Time
+	lastError    string
+	resolvers    map[string]*rollingWindow
+}
+
+type rollingWindow struct {
+	server  bench.DNSServer
+	entries []windowEntry
+}
+
+type windowEntry struct {
+	at     time.Time
+	result bench.BenchmarkResult
+}
+
+// MonitorSnapshot is the state exposed over /api/monitor.
+type MonitorSnapshot struct {
+	Started      time.Time         `json:"started"`
+	Cycles       int               `json:"cycles"`
+	FailedCycles int               `json:"failedCycles"`
+	LastCycle    *time.Time        `json:"lastCycle,omitempty"`
+	NextCycle    time.Time         `json:"nextCycle"`
+	LastError    string            `json:"lastError,omitempty"`
+	Window       int               `json:"window"`
+	Resolvers    []MonitorResolver `json:"resolvers"`
+}
+
+// MonitorResolver summarises one resolver over the rolling window.
+type MonitorResolver struct {
+	Server  bench.DNSServer `json:"server"`
+	Latest  bench.Stats     `json:"latest"`
+	Window  bench.Stats     `json:"window"`
+	History []MonitorPoint  `json:"history"`
+}
+
+// MonitorPoint is the outcome of one cycle for one resolver.
+type MonitorPoint struct {
+	At          time.Time `json:"at"`
+	Median      float64   `json:"median"`
+	P95         float64   `json:"p95"`
+	SuccessRate float64   `json:"successRate"`
+	Failure     string    `json:"failure,omitempty"`
+}
+
+// MarshalJSON writes NaN medians of failed cycles as null.
+func (p MonitorPoint) MarshalJSON() ([]byte, error) {
+	type plain MonitorPoint
+	return jsonnan.Marshal(plain(p))
+}
+
+func newMonitor(config *Config, servers []bench.DNSServer, domains []string) (*Monitor, error) {
+	var sched schedule = intervalSchedule(config.MonitorInterval)
+	if config.MonitorCron != "" {
+		cron, err := parseCron(config.MonitorCron)
+		if err != nil {
+			return nil, err
+		}
+		sched = cron
+	}
+
+	return &Monitor{
+		config:    config,
+		servers:   servers,
+		domains:   domains,
+		schedule:  sched,
+		window:    max(config.MonitorWindow, 1),
+		resolvers: make(map[string]*rollingWindow),
+	}, nil
+}
+
+// Run executes cycles until ctx is canceled. With an interval schedule the
+// first cycle starts immediately; with a cron schedule it waits for the first match.
+func (m *Monitor) Run(ctx context.Context, hub *SSEHub) {
+	now := time.Now()
+	next := now
+	if _, ok := m.schedule.(*cronSchedule); ok {
+		next = m.schedule.Next(now)
+	}
+
+	m.mu.Lock()
+	m.started = now
+	m.nextCycle = next
+	m.mu.Unlock()
+
+	for {
+		if !sleep.Until(ctx, next) {
+			return
+		}
+
+		start := time.Now()
+		m.runCycle(ctx, hub, start)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Skip slots that were missed while a long cycle was running.
+		next = m.schedule.Next(start)
+		for !next.IsZero() && next.Before(time.Now()) {
+			next = m.schedule.Next(next)
+		}
+		if next.IsZero() {
+			slog.Error("Monitor schedule has no further cycles")
+			return
+		}
+
+		m.mu.Lock()
+		m.nextCycle = next
+		m.mu.Unlock()
+	}
+}
+
+func (m *Monitor) runCycle(ctx context.Context, hub *SSEHub, start time.Time) {
+	defer func() {
+		// Keep monitoring through unexpected failures in a single cycle.
+		if r := recover(); r != nil {
+			slog.Error("Monitor cycle panicked", slog.String("panic", fmt.Sprint(r)))
+			m.recordFailure(fmt.Errorf("cycle panicked: %v", r))
+		}
+	}()
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "Starting monitor cycle", slog.Int("cycle", m.cycles+1))
+
+	var reporter bench.BenchmarkReporter = bench.NoopReporter{}
+	if hub != nil {
+		reporter = NewSSEReporter(hub, "monitor-"+strconv.FormatInt(start.UnixNano(), 10))
+	}
+
+	manifest := newManifest(m.config)
+	results, err := runBenchmark(ctx, m.config, manifest, m.servers, m.domains, reporter)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Monitor cycle failed", logattr.Err(err))
+		m.recordFailure(err)
+		return
+	}
+
+	m.record(start, results)
+	recordRun(ctx, m.config, SourceMonitor, manifest, m.servers, m.domains, results)
+}
+
+func (m *Monitor) recordFailure(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cycles++
+	m.failedCycles++
+	m.lastError = err.Error()
+}
+
+func (m *Monitor) record(at time.Time, results []bench.BenchmarkResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cycles++
+	m.lastCycle = at
+	m.lastError = ""
+
+	for _, r := range results {
+		w, ok := m.resolvers[r.Server.Endpoint()]
+		if !ok {
+			w = &rollingWindow{server: r.Server}
+			m.resolvers[r.Server.Endpoint()] = w
+		}
+		w.entries = append(w.entries, windowEntry{at: at, result: r})
+		if len(w.entries) > m.window {
+			w.entries = w.entries[len(w.entries)-m.window:]
+		}
+	}
+}
+
+// Snapshot returns the current monitor state, with resolvers in configured order.
+func (m *Monitor) Snapshot() MonitorSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snap := MonitorSnapshot{
+		Started:      m.started,
+		Cycles:       m.cycles,
+		FailedCycles: m.failedCycles,
+		NextCycle:    m.nextCycle,
+		LastError:    m.lastError,
+		Window:       m.window,
+		Resolvers:    make([]MonitorResolver, 0, len(m.resolvers)),
+	}
+	if !m.lastCycle.IsZero() {
+		last := m.lastCycle
+		snap.LastCycle = &last
+	}
+
+	for _, server := range m.servers {
+		w, ok := m.resolvers[server.Endpoint()]
+		if !ok || len(w.entries) == 0 {
+			continue
+		}
+		snap.Resolvers = append(snap.Resolvers, w.summary())
+	}
+	return snap
+}
+
+func (w *rollingWindow) summary() MonitorResolver {
+	var samples []bench.Sample
+	history := make([]MonitorPoint, 0, len(w.entries))
+	for _, e := range w.entries {
+		samples = append(samples, e.result.Samples...)
+		history = append(history, MonitorPoint{
+			At:          e.at,
+			Median:      e.result.Stats.Median,
+			P95:         e.result.Stats.P95,
+			SuccessRate: e.result.Stats.SuccessRate(),
+			Failure:     e.result.Failure,
+		})
+	}
+
+	return MonitorResolver{
+		Server:  w.server,
+		Latest:  w.entries[len(w.entries)-1].result.Stats,
+		Window:  bench.SummarizeSamples(samples),
+		History: history,
+	}
+}
+
+func (s *uiServer) handleMonitor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.monitor.Snapshot())
+}
+
+// runMonitor starts the HTTP server and the monitoring loop.
+func runMonitor(ctx context.Context, config *Config) error {
+	domains, err := config.domains()
+	if err != nil {
+		return fmt.Errorf("loading domains: %w", err)
+	}
+
+	servers, err := config.servers()
+	if err != nil {
+		return fmt.Errorf("loading servers: %w", err)
+	}
+
+	monitor, err := newMonitor(config, servers, domains)
+	if err != nil {
+		return err
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "Starting monitor",
+		slog.Int("resolvers", len(servers)),
+		slog.Int("domains", len(domains)),
+		slog.Duration("interval", config.MonitorInterval),
+		slog.String("cron", config.MonitorCron),
+		slog.Int("window", monitor.window),
+	)
+
+	return serveDashboard(ctx, config, monitor)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestMonitor_RollingWindow(t *testing.T) {
+	config := &Config{MonitorInterval: time.Minute, MonitorWindow: 2}
+	servers := []bench.DNSServer{{Name: "A", Addr: "A"}}
+	m, err := newMonitor(config, servers, []string{"example.com"})
+	if err != nil {
+		t.Fatalf("newMonitor() error = %v", err)
+	}
+
+	start := time.Now()
+	for i, l := range []float64{100, 10, 20} {
+		m.record(start.Add(time.Duration(i)*time.Minute), []bench.BenchmarkResult{testResult("A", l, l)})
+	}
+	m.recordFailure(bench.ErrNoAddresses)
+
+	snap := m.Snapshot()
+	if snap.Cycles != 4 || snap.FailedCycles != 1 {
+		t.Errorf("Snapshot() cycles = %d/%d failed, want 4/1", snap.Cycles, snap.FailedCycles)
+	}
+	if len(snap.Resolvers) != 1 {
+		t.Fatalf("Snapshot() resolvers = %d, want 1", len(snap.Resolvers))
+	}
+
+	r := snap.Resolvers[0]
+	if len(r.History) != 2 {
+		t.Fatalf("history length = %d, want 2", len(r.History))
+	}
+	if r.History[0].Median != 10 || r.Latest.Median != 20 {
+		t.Errorf("history = %v, latest median = %v, want oldest cycle dropped", r.History, r.Latest.Median)
+	}
+	if r.Window.Count != 4 || r.Window.Median != 15 {
+		t.Errorf("window stats = %d samples, median %v, want 4 samples, median 15", r.Window.Count, r.Window.Median)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+)
+
+// maxListedPairs bounds how many pairs are reported; with every pair of the
+// catalogue there would be thousands.
+const maxListedPairs = 10
+
+// PairStats is the effective latency of a resolver pair in one mode, in
+// milliseconds. Availability is the percentage of queries answered.
+type PairStats struct {
+	Median       float64 `json:"median"`
+	P95          float64 `json:"p95"`
+	Availability float64 `json:"availability"`
+}
+
+// MarshalJSON writes the latencies of a pair without answers as null.
+func (s PairStats) MarshalJSON() ([]byte, error) {
+	type plain PairStats
+	return jsonnan.Marshal(plain(s))
+}
+
+// ResolverPair is a primary and secondary resolver simulated over the
+// samples of both. Failover queries the secondary only after the primary
+// failed, like glibc and systemd-resolved; Race queries both at once and
+// takes the first answer, like dnsmasq with all-servers.
+type ResolverPair struct {
+	Primary      string    `json:"primary"`
+	Secondary    string    `json:"secondary"`
+	SameProvider bool      `json:"sameProvider,omitempty"`
+	Queries      int       `json:"queries"`
+	Failover     PairStats `json:"failover"`
+	Race         PairStats `json:"race"`
+}
+
+// PairAnalysis ranks the resolver pairs by failover availability, then
+// median. Recommended is the best pair of two different providers, or the
+// best pair when every resolver belongs to the same provider.
+type PairAnalysis struct {
+	Pairs       []ResolverPair `json:"pairs"`
+	Recommended *ResolverPair  `json:"recommended,omitempty"`
+	// Fastest is the best pair overall when it shares a provider and was
+	// therefore passed over.
+	Fastest *ResolverPair `json:"fastest,omitempty"`
+}
+
+// samplesByDomain groups the samples of r by domain, in the order they were taken.
+func samplesByDomain(r bench.BenchmarkResult) map[string][]bench.Sample {
+	m := make(map[string][]bench.Sample)
+	for _, s := range r.Samples {
+		m[s.Domain] = append(m[s.Domain], s)
+	}
+	return m
+}
+
+// simulatePair replays the queries both resolvers answered for the same
+// domain, matching the n-th query of a domain on one resolver with the n-th
+// on the other. A failed primary costs the time it took to give up on it.
+func simulatePair(primary, secondary bench.BenchmarkResult, first, second map[string][]bench.Sample) ResolverPair {
+	var failover, race []bench.Sample
+	for domain, ps := range first {
+		ss := second[domain]
+		for i := range min(len(ps), len(ss)) {
+			p, s := ps[i], ss[i]
+			switch {
+			case p.Error == "":
+				failover = append(failover, bench.Sample{Latency: p.Latency, Attempts: 1})
+			case s.Error == "":
+				failover = append(failover, bench.Sample{Latency: p.Total + s.Latency, Attempts: 1})
+			default:
+				failover = append(failover, bench.Sample{Attempts: 1, Error: p.Error})
+			}
+
+			switch {
+			case p.Error == "" && s.Error == "":
+				race = append(race, bench.Sample{Latency: min(p.Latency, s.Latency), Attempts: 1})
+			case p.Error == "":
+				race = append(race, bench.Sample{Latency: p.Latency, Attempts: 1})
+			case s.Error == "":
+				race = append(race, bench.Sample{Latency: s.Latency, Attempts: 1})
+			default:
+				race = append(race, bench.Sample{Attempts: 1, Error: p.Error})
+			}
+		}
+	}
+
+	return ResolverPair{
+		Primary:      primary.Server.Name,
+		Secondary:    secondary.Server.Name,
+		SameProvider: providerOf(primary.Server) == providerOf(secondary.Server),
+		Queries:      len(failover),
+		Failover:     pairStats(failover),
+		Race:         pairStats(race),
+	}
+}
+
+func pairStats(samples []bench.Sample) PairStats {
+	stats := bench.SummarizeSamples(samples)
+	return PairStats{Median: stats.Median, P95: stats.P95, Availability: stats.SuccessRate() * 100}
+}
+
+// comparePairs orders pairs by failover availability, then median and p95.
+func comparePairs(a, b ResolverPair) int {
+	return cmp.Or(
+		cmp.Compare(b.Failover.Availability, a.Failover.Availability),
+		cmp.Compare(a.Failover.Median, b.Failover.Median),
+		cmp.Compare(a.Failover.P95, b.Failover.P95),
+	)
+}
+
+// resolverPairs simulates every pair of the resolvers in valid that have raw
+// samples, each in its better order. It returns nil for fewer than two.
+func resolverPairs(valid []bench.BenchmarkResult) *PairAnalysis {
+	var (
+		results []bench.BenchmarkResult
+		domains []map[string][]bench.Sample
+	)
+	for _, r := range valid {
+		if len(r.Samples) > 0 {
+			results = append(results, r)
+			domains = append(domains, samplesByDomain(r))
+		}
+	}
+	if len(results) < 2 {
+		return nil
+	}
+
+	var pairs []ResolverPair
+	for i := range results {
+		for j := i + 1; j < len(results); j++ {
+			pair := simulatePair(results[i], results[j], domains[i], domains[j])
+			if reverse := simulatePair(results[j], results[i], domains[j], domains[i]); comparePairs(reverse, pair) < 0 {
+				pair = reverse
+			}
+			if pair.Queries > 0 {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(pairs, comparePairs)
+
+	analysis := &PairAnalysis{}
+	best := pairs[0]
+	if i := slices.IndexFunc(pairs, func(p ResolverPair) bool { return !p.SameProvider }); i >= 0 {
+		best = pairs[i]
+		if i > 0 {
+			fastest := pairs[0]
+			analysis.Fastest = &fastest
+		}
+	}
+	analysis.Recommended = &best
+	analysis.Pairs = pairs[:min(len(pairs), maxListedPairs)]
+	return analysis
+}
+
+// printPairTable lists the best pairs; pairs that share a provider are marked.
+//
+//nolint:errcheck // printing helper
+func printPairTable(w io.Writer, analysis *PairAnalysis, limit int) {
+	_, _ = fmt.Fprintf(w, "%-20s %-20s %12s %12s %9s %12s %9s\n",
+		"Primary", "Secondary", "Failover Med", "Failover P95", "Avail", "Race Med", "Avail")
+	for _, p := range analysis.Pairs[:min(len(analysis.Pairs), limit)] {
+		secondary := p.Secondary
+		if p.SameProvider {
+			secondary += " *"
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %-20s %12.2f %12.2f %8.2f%% %12.2f %8.2f%%\n",
+			truncateString(p.Primary, 20), truncateString(secondary, 20),
+			p.Failover.Median, p.Failover.P95, p.Failover.Availability, p.Race.Median, p.Race.Availability)
+	}
+	if slices.ContainsFunc(analysis.Pairs[:min(len(analysis.Pairs), limit)], func(p ResolverPair) bool { return p.SameProvider }) {
+		_, _ = fmt.Fprintln(w, "* same provider as the primary: one outage takes down both")
+	}
+}
+
+// pairRecommendation describes the recommended pair in one or two sentences.
+func pairRecommendation(analysis *PairAnalysis) string {
+	r := analysis.Recommended
+	note := fmt.Sprintf("Recommended pair: %s (primary) + %s (secondary): %.2fms median, %.2fms p95 and %.2f%% availability with failover, %.2fms median when both are queried at once.",
+		r.Primary, r.Secondary, r.Failover.Median, r.Failover.P95, r.Failover.Availability, r.Race.Median)
+	switch {
+	case r.SameProvider:
+		note += " Every measured resolver belongs to the same provider; add another provider for independent failover."
+	case analysis.Fastest != nil:
+		f := analysis.Fastest
+		note += fmt.Sprintf(" %s + %s ranks higher (%.2fms median) but shares a provider.", f.Primary, f.Secondary, f.Failover.Median)
+	}
+	return note
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestResolverPairs_Failover(t *testing.T) {
+	nan := math.NaN()
+	analysis := resolverPairs([]bench.BenchmarkResult{
+		testResult("Cloudflare-1", 10, 10, 10, nan),
+		testResult("Cloudflare-2", 11, 11, 11, nan),
+		testResult("Quad9-1", 20, 20, 20, 20),
+	})
+	if analysis == nil || len(analysis.Pairs) != 3 {
+		t.Fatalf("resolverPairs() = %+v, want 3 pairs", analysis)
+	}
+
+	best := analysis.Recommended
+	if best.Primary != "Cloudflare-1" || best.Secondary != "Quad9-1" || analysis.Fastest != nil {
+		t.Fatalf("Recommended = %+v, want Cloudflare-1 + Quad9-1", best)
+	}
+	if best.Failover.Availability != 100 || best.Failover.Median != 10 || best.Race.Median != 10 {
+		t.Errorf("Recommended = %+v, want full availability at a 10ms median", best)
+	}
+	if last := analysis.Pairs[2]; !last.SameProvider || last.Failover.Availability != 75 {
+		t.Errorf("last pair = %+v, want Cloudflare-1 + Cloudflare-2 with the shared outage", last)
+	}
+}
+
+func TestResolverPairs_ProviderDiversity(t *testing.T) {
+	analysis := resolverPairs([]bench.BenchmarkResult{
+		testResult("Cloudflare-1", 10, 10),
+		testResult("Cloudflare-2", 11, 11),
+		testResult("Quad9-1", 20, 20),
+	})
+	if analysis.Recommended.Secondary != "Quad9-1" {
+		t.Errorf("Recommended = %+v, want a second provider", analysis.Recommended)
+	}
+	if analysis.Fastest == nil || analysis.Fastest.Secondary != "Cloudflare-2" {
+		t.Errorf("Fastest = %+v, want the Cloudflare pair", analysis.Fastest)
+	}
+	if note := pairRecommendation(analysis); !strings.Contains(note, "shares a provider") {
+		t.Errorf("pairRecommendation() = %q", note)
+	}
+
+	single := resolverPairs([]bench.BenchmarkResult{
+		testResult("Cloudflare-1", 10),
+		testResult("Cloudflare-2", 11),
+	})
+	if !single.Recommended.SameProvider {
+		t.Errorf("Recommended = %+v, want the only pair", single.Recommended)
+	}
+
+	if got := resolverPairs([]bench.BenchmarkResult{testResult("Cloudflare-1", 10)}); got != nil {
+		t.Errorf("resolverPairs() of one resolver = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// defaultUpstreams are forwarded to when neither -upstreams, -f nor the
+// config file name any resolvers: one address of each large public provider.
+var defaultUpstreams = []string{"Cloudflare-1", "Google-1", "Quad9-1"}
+
+func proxyCommand(ctx context.Context, args []string) int {
+	var config Config
+	fs := newCommandFlagSet("proxy", "[options]",
+		"Answer DNS queries on a local address by forwarding them to upstream resolvers, and rank the upstreams by their latency on this traffic. Point a host or a test client at the listen address")
+	if code, ok := parseCommand(fs, &config, args, configFlags, proxyFlags, logFlags, outputFlags, samplesFlags, captureFlags); !ok {
+		return code
+	}
+	if code, ok := noArgs(fs); !ok {
+		return code
+	}
+	initLogger(config.LogType)
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := runProxy(ctx, &config); err != nil {
+		slog.ErrorContext(ctx, "Proxy failed", logattr.Err(err))
+		return 1
+	}
+	return 0
+}
+
+// proxyFlags sets the listen address, the upstreams and how they are queried.
+func proxyFlags(fs *flag.FlagSet, config *Config) func() error {
+	var mode, upstreams string
+
+	fs.StringVar(&config.ListenAddr, "listen", "127.0.0.1:5353", "Address to answer DNS queries on, over UDP and TCP")
+	fs.StringVar(&mode, "mode", string(bench.ProxyFastest), "How queries are forwarded: fastest, race (all upstreams, first answer wins) or round-robin")
+	fs.StringVar(&upstreams, "upstreams", "", "Comma-separated resolver names or IP addresses to forward to (default: the -f or config file resolvers, else "+strings.Join(defaultUpstreams, ", ")+")")
+	fs.StringVar(&config.ResolversFile, "f", "", "Optional file with extra resolvers (name;ip)")
+	fs.DurationVar(&config.LookupTimeout, "t", bench.DefaultTimeout, "Timeout of a forwarded query before the next upstream is tried")
+	fs.IntVar(&config.MaxConcurrency, "c", bench.DefaultConcurrency(), "Maximum forwarded queries in flight per upstream; client queries are handled at most this many times the upstreams at once")
+	fs.DurationVar(&config.ReportInterval, "report", time.Minute, "Time between upstream tables printed while running (0 prints only the final summary)")
+
+	return func() error {
+		m, err := bench.ParseProxyMode(mode)
+		if err != nil {
+			return err
+		}
+		config.ProxyMode = m
+		switch {
+		case config.ListenAddr == "":
+			return errors.New("listen address must not be empty")
+		case config.LookupTimeout <= 0:
+			return errors.New("timeout must be positive")
+		case config.MaxConcurrency < 1:
+			return errors.New("concurrency must be at least 1")
+		case config.ReportInterval < 0:
+			return errors.New("report must not be negative")
+		}
+		for name := range strings.SplitSeq(upstreams, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.Upstreams = append(config.Upstreams, name)
+			}
+		}
+		return nil
+	}
+}
+
+// proxyUpstreams returns the resolvers the proxy forwards to. Names are
+// looked up in the -f or config file resolvers and the built-in list;
+// addresses that are not listed are queried over UDP.
+func proxyUpstreams(config *Config) ([]bench.DNSServer, error) {
+	if len(config.Upstreams) == 0 && (config.ResolversFile != "" || len(config.Servers) > 0) {
+		return config.servers()
+	}
+
+	known, err := config.servers()
+	if err != nil {
+		return nil, err
+	}
+	known = append(known, builtInResolvers...)
+	names := config.Upstreams
+	if len(names) == 0 {
+		names = defaultUpstreams
+	}
+
+	servers := make([]bench.DNSServer, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(known, func(s bench.DNSServer) bool {
+			return strings.EqualFold(s.Name, name) || s.Addr == name
+		})
+		switch {
+		case i >= 0:
+			servers = append(servers, known[i])
+		case net.ParseIP(name) != nil:
+			servers = append(servers, bench.DNSServer{Name: name, Addr: name})
+		default:
+			return nil, fmt.Errorf("unknown upstream %q: use an IP address or a resolver name", name)
+		}
+	}
+	return servers, nil
+}
+
+// runProxy serves until ctx is done, printing the upstream table every
+// report interval and the summary at the end.
+func runProxy(ctx context.Context, config *Config) error {
+	servers, err := proxyUpstreams(config)
+	if err != nil {
+		return fmt.Errorf("loading upstreams: %w", err)
+	}
+
+	var sinks []bench.SampleReporter
+	if config.SamplesFile != "" {
+		export, err := createSampleExport(config.SamplesFile, bench.QTypeA)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = export.Close() }() //nolint:errcheck // every line is already written
+		sinks = append(sinks, export)
+	}
+
+	opts := []bench.Option{
+		bench.WithTimeout(config.LookupTimeout),
+		bench.WithConcurrency(config.MaxConcurrency),
+		bench.WithReporter(sampleTee{reporters: sinks}),
+	}
+	if config.CaptureFile != "" {
+		capture, err := createCapture(config.CaptureFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := capture.Close(); err != nil {
+				slog.LogAttrs(ctx, slog.LevelWarn, "Could not write capture", logattr.Err(err))
+			}
+		}()
+		opts = append(opts, bench.WithCapture(capture.CaptureWriter))
+	}
+
+	proxy, err := bench.NewProxy(servers, config.ProxyMode, opts...)
+	if err != nil {
+		return err
+	}
+
+	if config.ReportInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(config.ReportInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-ticker.C:
+					printProxyTable(proxy, now)
+				}
+			}
+		}()
+	}
+
+	if err := proxy.Serve(ctx, config.ListenAddr); err != nil {
+		return err
+	}
+	printSummary(proxy.Results(), config.OutputType, config.SortBy, nil)
+	return nil
+}
+
+// printProxyTable prints the upstreams that answered at least one query so
+// far, best first.
+//
+//nolint:errcheck // printing helper
+func printProxyTable(proxy *bench.Proxy, now time.Time) {
+	valid, _ := rankResults(proxy.Results(), SortDefault)
+	if len(valid) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "\n%s\n", now.Format(time.DateTime))
+	printResultsTable(os.Stdout, valid, false)
+}
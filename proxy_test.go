@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestProxyUpstreams(t *testing.T) {
+	internal := bench.DNSServer{Name: "Internal-1", Addr: "10.0.0.53", Transport: bench.TransportTCP}
+	tests := []struct {
+		name    string
+		config  Config
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", want: []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}},
+		{name: "config file resolvers", config: Config{Servers: []bench.DNSServer{internal}}, want: []string{"10.0.0.53"}},
+		{
+			name:   "names and addresses",
+			config: Config{Servers: []bench.DNSServer{internal}, Upstreams: []string{"internal-1", "Google-2", "192.0.2.53"}},
+			want:   []string{"10.0.0.53", "8.8.4.4", "192.0.2.53"},
+		},
+		{name: "unknown name", config: Config{Upstreams: []string{"Nowhere-1"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, err := proxyUpstreams(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("proxyUpstreams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := make([]string, 0, len(servers))
+			for _, s := range servers {
+				got = append(got, s.Addr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("proxyUpstreams() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("proxyUpstreams()[%d] = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+	if servers, _ := proxyUpstreams(&Config{Servers: []bench.DNSServer{internal}, Upstreams: []string{"Internal-1"}}); servers[0].Transport != bench.TransportTCP {
+		t.Errorf("proxyUpstreams() = %+v, want the transport of the config file resolver", servers[0])
+	}
+}
@@ -2,33 +2,23 @@ package main
 
 import (
 	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
 )
 
-// BenchmarkReporter provides hooks during benchmark execution.
-type BenchmarkReporter interface {
-	OnStart(totalResolvers int, domains []string)
-	OnResolverStart(server DNSServer, index, total int)
-	OnQueryResult(server DNSServer, domain string, latencyMs float64, err error)
-	OnResolverDone(server DNSServer, stats Stats, took time.Duration)
-	OnComplete(results []BenchmarkResult, err error)
+// eventSink receives the events of a reporter: the SSE hub of the dashboard,
+// or the connection of an agent to its central server.
+type eventSink interface {
+	Broadcast(evt SSEEvent)
 }
 
-// NoopReporter is used when no callbacks are needed.
-type NoopReporter struct{}
-
-func (NoopReporter) OnStart(_ int, _ []string)                               {}
-func (NoopReporter) OnResolverStart(_ DNSServer, _, _ int)                   {}
-func (NoopReporter) OnQueryResult(_ DNSServer, _ string, _ float64, _ error) {}
-func (NoopReporter) OnResolverDone(_ DNSServer, _ Stats, _ time.Duration)    {}
-func (NoopReporter) OnComplete(_ []BenchmarkResult, _ error)                 {}
-
 // SSEReporter emits progress updates over SSE.
 type SSEReporter struct {
-	hub   *SSEHub
+	hub   eventSink
 	runID string
 }
 
-func NewSSEReporter(hub *SSEHub, runID string) *SSEReporter {
+func NewSSEReporter(hub eventSink, runID string) *SSEReporter {
 	return &SSEReporter{hub: hub, runID: runID}
 }
 
@@ -44,7 +34,7 @@ func (r *SSEReporter) OnStart(totalResolvers int, domains []string) {
 	})
 }
 
-func (r *SSEReporter) OnResolverStart(server DNSServer, index, total int) {
+func (r *SSEReporter) OnResolverStart(server bench.DNSServer, index, total int) {
 	r.hub.Broadcast(SSEEvent{
 		Type:  "resolver_start",
 		RunID: r.runID,
@@ -56,7 +46,18 @@ func (r *SSEReporter) OnResolverStart(server DNSServer, index, total int) {
 	})
 }
 
-func (r *SSEReporter) OnQueryResult(server DNSServer, domain string, latencyMs float64, err error) {
+func (r *SSEReporter) OnWarmupDone(server bench.DNSServer, cold bench.Stats) {
+	r.hub.Broadcast(SSEEvent{
+		Type:  "warmup_done",
+		RunID: r.runID,
+		Detail: map[string]interface{}{
+			"server": server,
+			"cold":   cold,
+		},
+	})
+}
+
+func (r *SSEReporter) OnQueryResult(server bench.DNSServer, domain string, latencyMs float64, err error) {
 	detail := map[string]interface{}{
 		"server":  server,
 		"domain":  domain,
@@ -72,7 +73,18 @@ func (r *SSEReporter) OnQueryResult(server DNSServer, domain string, latencyMs f
 	})
 }
 
-func (r *SSEReporter) OnResolverDone(server DNSServer, stats Stats, took time.Duration) {
+func (r *SSEReporter) OnProgress(server bench.DNSServer, progress bench.Progress) {
+	r.hub.Broadcast(SSEEvent{
+		Type:  "progress",
+		RunID: r.runID,
+		Detail: map[string]interface{}{
+			"server":   server,
+			"progress": progress,
+		},
+	})
+}
+
+func (r *SSEReporter) OnResolverDone(server bench.DNSServer, stats bench.Stats, took time.Duration) {
 	r.hub.Broadcast(SSEEvent{
 		Type:  "resolver_done",
 		RunID: r.runID,
@@ -84,7 +96,7 @@ func (r *SSEReporter) OnResolverDone(server DNSServer, stats Stats, took time.Du
 	})
 }
 
-func (r *SSEReporter) OnComplete(results []BenchmarkResult, err error) {
+func (r *SSEReporter) OnComplete(results []bench.BenchmarkResult, err error) {
 	detail := map[string]interface{}{
 		"results": results,
 	}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
+)
+
+// sampleRecord is one line of a sample export: a single query as it completed.
+type sampleRecord struct {
+	Time       time.Time       `json:"time"`
+	Resolver   string          `json:"resolver"`
+	Addr       string          `json:"addr"`
+	Transport  bench.Transport `json:"transport"`
+	Domain     string          `json:"domain"`
+	QType      bench.QType     `json:"qtype"`
+	Attempts   int             `json:"attempts"`
+	Latency    float64         `json:"latency"`
+	Total      float64         `json:"total"`
+	RCode      string          `json:"rcode"`
+	Answers    int             `json:"answers"`
+	ErrorClass string          `json:"errorClass"`
+	Error      string          `json:"error"`
+}
+
+var sampleColumns = []string{
+	"time", "resolver", "addr", "transport", "domain", "qtype", "attempts",
+	"latency_ms", "total_ms", "rcode", "answers", "error_class", "error",
+}
+
+func (r *sampleRecord) csv() []string {
+	return []string{
+		r.Time.Format(time.RFC3339Nano), r.Resolver, r.Addr, r.Transport.String(), r.Domain, r.QType.String(),
+		strconv.Itoa(r.Attempts), strconv.FormatFloat(r.Latency, 'f', 3, 64), strconv.FormatFloat(r.Total, 'f', 3, 64),
+		r.RCode, strconv.Itoa(r.Answers), r.ErrorClass, r.Error,
+	}
+}
+
+// SampleExport writes every measured query to a file as soon as it
+// completes: NDJSON, or CSV when the file name ends in .csv. It is a
+// bench.SampleReporter; write errors are logged once and stop the export
+// without affecting the run.
+type SampleExport struct {
+	bench.NoopReporter
+
+	path  string
+	qtype bench.QType
+	file  *os.File
+	enc   *json.Encoder
+	csv   *csv.Writer
+	err   error
+}
+
+// createSampleExport creates the export file at path, replacing an existing one.
+func createSampleExport(path string, qtype bench.QType) (*SampleExport, error) {
+	//nolint:gosec // file path provided by user intentionally
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating sample export: %w", err)
+	}
+	e := &SampleExport{path: path, qtype: qtype, file: file}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		e.csv = csv.NewWriter(file)
+		e.write(func() error { return e.csv.Write(sampleColumns) })
+	} else {
+		e.enc = json.NewEncoder(file)
+	}
+	if e.err != nil {
+		_ = file.Close() //nolint:errcheck // already failing
+		return nil, fmt.Errorf("writing sample export: %w", e.err)
+	}
+	return e, nil
+}
+
+func (e *SampleExport) write(encode func() error) {
+	if e.err != nil {
+		return
+	}
+	if err := encode(); err != nil {
+		e.err = err
+		slog.Warn("Could not write sample export, continuing without it",
+			slog.String("path", e.path),
+			logattr.Err(err),
+		)
+	}
+}
+
+func (e *SampleExport) OnSample(server bench.DNSServer, sample bench.Sample) {
+	record := sampleRecord{
+		Time:       time.Now(),
+		Resolver:   server.Name,
+		Addr:       server.Addr,
+		Transport:  server.Transport,
+		Domain:     sample.Domain,
+		QType:      cmp.Or(sample.QType, e.qtype),
+		Attempts:   sample.Attempts,
+		Latency:    sample.Latency,
+		Total:      sample.Total,
+		RCode:      sample.RCode,
+		Answers:    sample.Answers,
+		ErrorClass: sample.ErrorClass,
+		Error:      sample.Error,
+	}
+	if record.Transport == "" {
+		record.Transport = bench.TransportUDP
+	}
+	if e.csv != nil {
+		// Flushing every record keeps the file complete up to the last
+		// query if the run is killed, like the NDJSON lines.
+		e.write(func() error {
+			if err := e.csv.Write(record.csv()); err != nil {
+				return err
+			}
+			e.csv.Flush()
+			return e.csv.Error()
+		})
+		return
+	}
+	e.write(func() error { return e.enc.Encode(record) })
+}
+
+func (e *SampleExport) OnResolverResult(bench.BenchmarkResult) {}
+
+func (e *SampleExport) Close() error {
+	return e.file.Close()
+}
+
+// sampleTee passes the samples of a run to several sample reporters, such as
+// the checkpoint and the sample export.
+type sampleTee struct {
+	bench.NoopReporter
+
+	reporters []bench.SampleReporter
+}
+
+func (t sampleTee) OnSample(server bench.DNSServer, sample bench.Sample) {
+	for _, r := range t.reporters {
+		r.OnSample(server, sample)
+	}
+}
+
+func (t sampleTee) OnResolverResult(result bench.BenchmarkResult) {
+	for _, r := range t.reporters {
+		r.OnResolverResult(result)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func exportSamples(t *testing.T, name string) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	export, err := createSampleExport(path, bench.QTypeAAAA)
+	if err != nil {
+		t.Fatalf("createSampleExport() error = %v", err)
+	}
+	server := bench.DNSServer{Name: "Cloudflare-1", Addr: "1.1.1.1"}
+	reporter := sampleTee{reporters: []bench.SampleReporter{export}}
+	reporter.OnSample(server, bench.Sample{Domain: "example.com", Latency: 12.5, Total: 12.5, Attempts: 1, RCode: "NOERROR", Answers: 2})
+	reporter.OnSample(server, bench.Sample{Domain: "example.org", Total: 1000, Attempts: 2, Error: "timeout, retried", ErrorClass: "timeout"})
+	if err := export.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSampleExport_NDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(exportSamples(t, "samples.ndjson"))), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("export has %d lines, want 2", len(lines))
+	}
+	var first sampleRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", lines[0], err)
+	}
+	if first.Resolver != "Cloudflare-1" || first.Transport != bench.TransportUDP || first.QType != bench.QTypeAAAA ||
+		first.Latency != 12.5 || first.RCode != "NOERROR" || first.Answers != 2 || first.Time.IsZero() {
+		t.Errorf("first record = %+v", first)
+	}
+}
+
+func TestSampleExport_CSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(string(exportSamples(t, "samples.csv")))).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	if len(rows) != 3 || len(rows[0]) != len(sampleColumns) {
+		t.Fatalf("export = %v, want a header and 2 rows of %d columns", rows, len(sampleColumns))
+	}
+	if got := rows[2]; got[5] != "AAAA" || got[6] != "2" || got[11] != "timeout" || got[12] != "timeout, retried" {
+		t.Errorf("second row = %v", got)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// SortOrder selects how printSummary ranks resolvers.
+type SortOrder int
+
+const (
+	SortDefault SortOrder = iota
+	SortScore
+)
+
+func (o SortOrder) String() string {
+	switch o {
+	case SortScore:
+		return "score"
+	default:
+		return "default"
+	}
+}
+
+// MarshalText writes the sort order by name in manifests.
+func (s SortOrder) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *SortOrder) UnmarshalText(b []byte) error {
+	v, err := parseSortOrder(string(b))
+	*s = v
+	return err
+}
+
+func parseSortOrder(s string) (SortOrder, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return SortDefault, nil
+	case "score":
+		return SortScore, nil
+	default:
+		return SortDefault, fmt.Errorf("invalid sort order %q", s)
+	}
+}
+
+// parseScoreWeights parses a weight list such as "success=0.5,median=0.3,p95=0.2".
+// Metrics that are not mentioned get a weight of zero.
+func parseScoreWeights(spec string) (bench.ScoreWeights, error) {
+	var w bench.ScoreWeights
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return w, fmt.Errorf("invalid weight %q: expected metric=value", part)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return w, fmt.Errorf("invalid weight %q: %w", part, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "success", "successrate":
+			w.SuccessRate = f
+		case "median":
+			w.Median = f
+		case "p95":
+			w.P95 = f
+		case "jitter":
+			w.Jitter = f
+		default:
+			return w, fmt.Errorf("unknown score metric %q", key)
+		}
+	}
+	return w, w.Validate()
+}
+
+// loadScoreWeights reads weights from a JSON file with the same field names as bench.ScoreWeights.
+func loadScoreWeights(path string) (bench.ScoreWeights, error) {
+	//nolint:gosec // file path provided by user intentionally
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return bench.ScoreWeights{}, fmt.Errorf("reading weights file: %w", err)
+	}
+	var w bench.ScoreWeights
+	if err := json.Unmarshal(data, &w); err != nil {
+		return bench.ScoreWeights{}, fmt.Errorf("parsing weights file: %w", err)
+	}
+	return w, w.Validate()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestParseScoreWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    bench.ScoreWeights
+		wantErr bool
+	}{
+		{
+			name: "All metrics",
+			spec: "success=0.4, median=0.3,p95=0.2,jitter=0.1",
+			want: bench.ScoreWeights{SuccessRate: 0.4, Median: 0.3, P95: 0.2, Jitter: 0.1},
+		},
+		{
+			name: "Single metric",
+			spec: "p95=1",
+			want: bench.ScoreWeights{P95: 1},
+		},
+		{name: "Unknown metric", spec: "speed=1", wantErr: true},
+		{name: "Missing value", spec: "median", wantErr: true},
+		{name: "Negative weight", spec: "median=-1", wantErr: true},
+		{name: "All zero", spec: "median=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScoreWeights(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScoreWeights() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseScoreWeights() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
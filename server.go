@@ -15,6 +15,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/logattr"
 )
 
 //go:embed webui/dist/* webui/dist/assets/*
@@ -30,24 +33,88 @@ func init() {
 }
 
 type runOptions struct {
-	Repeats     int  `json:"repeats"`
-	TimeoutMs   int  `json:"timeoutMs"`
-	Concurrency int  `json:"concurrency"`
-	Warmup      int  `json:"warmup"`
-	OnlyMajor   bool `json:"onlyMajor"`
+	Repeats      int  `json:"repeats"`
+	TimeoutMs    int  `json:"timeoutMs"`
+	Concurrency  int  `json:"concurrency"`
+	OnlyMajor    bool `json:"onlyMajor"`
+	BackoffMs    int  `json:"backoffMs"`
+	MaxBackoffMs int  `json:"maxBackoffMs"`
+
+	// Warmup, Retries, PreflightMs and Breaker are pointers so that a
+	// request without them keeps the configured warmup, retry policy,
+	// pre-flight probe and circuit breaker instead of disabling them.
+	Warmup      *int `json:"warmup,omitempty"`
+	Retries     *int `json:"retries,omitempty"`
+	PreflightMs *int `json:"preflightMs,omitempty"`
+	Breaker     *int `json:"breaker,omitempty"`
+
+	// Adaptive and the budgets are pointers so that a request without them
+	// keeps the configured sampling and budgets instead of resetting them.
+	Adaptive   *bool  `json:"adaptive,omitempty"`
+	MaxQueries *int   `json:"maxQueries,omitempty"`
+	MaxTimeMs  *int64 `json:"maxTimeMs,omitempty"`
+	RunQueries *int   `json:"runQueries,omitempty"`
+	RunTimeMs  *int64 `json:"runTimeMs,omitempty"`
+
+	QPS float64 `json:"qps"`
+
+	TargetCIMs int `json:"targetCiMs"`
+
+	// RTTProbes is a pointer so that a request without it keeps the default
+	// instead of disabling the measurement.
+	RTTProbes *int            `json:"rttProbes,omitempty"`
+	RTTMethod bench.RTTMethod `json:"rttMethod,omitempty"`
+
+	IPFamily IPFamily    `json:"ip,omitempty"`
+	QType    bench.QType `json:"qtype,omitempty"`
+
+	Weights *bench.ScoreWeights `json:"weights,omitempty"`
+}
+
+// optionsFromConfig describes config in the form accepted by /api/run.
+func optionsFromConfig(config *Config) runOptions {
+	weights, rttProbes := config.ScoreWeights, config.RTTProbes
+	warmup, retries := config.WarmupRuns, config.Retry.Retries
+	preflightMs, breaker := int(config.PreflightTimeout.Milliseconds()), config.BreakerThreshold
+	adaptive, maxQueries, maxTimeMs := config.Adaptive, config.MaxQueries, config.MaxTime.Milliseconds()
+	runQueries, runTimeMs := config.RunQueries, config.RunTime.Milliseconds()
+	return runOptions{
+		Repeats:      config.Repeats,
+		TimeoutMs:    int(config.LookupTimeout.Milliseconds()),
+		Concurrency:  config.MaxConcurrency,
+		Warmup:       &warmup,
+		OnlyMajor:    config.OnlyMajorResolvers,
+		Retries:      &retries,
+		BackoffMs:    int(config.Retry.InitialBackoff.Milliseconds()),
+		MaxBackoffMs: int(config.Retry.MaxBackoff.Milliseconds()),
+		PreflightMs:  &preflightMs,
+		Breaker:      &breaker,
+		Adaptive:     &adaptive,
+		TargetCIMs:   int(config.TargetCI.Milliseconds()),
+		MaxQueries:   &maxQueries,
+		MaxTimeMs:    &maxTimeMs,
+		RunQueries:   &runQueries,
+		RunTimeMs:    &runTimeMs,
+		QPS:          config.QPS,
+		RTTProbes:    &rttProbes,
+		RTTMethod:    config.RTTMethod,
+		IPFamily:     config.IPFamily,
+		QType:        config.QType,
+		Weights:      &weights,
+	}
 }
 
 type runRequest struct {
-	Domains   []string    `json:"domains"`
-	Resolvers []DNSServer `json:"resolvers"`
-	Options   runOptions  `json:"options"`
+	Domains   []string          `json:"domains"`
+	Resolvers []bench.DNSServer `json:"resolvers"`
+	Options   runOptions        `json:"options"`
 }
 
 type defaultsResponse struct {
-	Resolvers      []DNSServer `json:"resolvers"`
-	MajorResolvers []DNSServer `json:"majorResolvers"`
-	Domains        []string    `json:"domains"`
-	Options        runOptions  `json:"options"`
+	Resolvers      []bench.DNSServer `json:"resolvers"`
+	MajorResolvers []bench.DNSServer `json:"majorResolvers"`
+	Domains        []string          `json:"domains"`
+	Options        runOptions        `json:"options"`
 }
 
 type uiServer struct {
@@ -57,9 +124,15 @@ type uiServer struct {
 	mu         sync.Mutex
 	cancel     context.CancelFunc
 	currentRun string
+	monitor    *Monitor
+	history    *HistoryStore
+	fleet      *Fleet
 }
 
-func serveDashboard(ctx context.Context, config *Config) error {
+// serveDashboard serves the Web UI and its API until ctx is canceled. When
+// monitor is set, its loop runs alongside and its state is served at
+// /api/monitor; no browser is opened since monitors usually run headless.
+func serveDashboard(ctx context.Context, config *Config, monitor *Monitor) error {
 	if webUISub == nil {
 		return errors.New("embedded UI assets not found; run `make ui-build` first")
 	}
@@ -69,6 +142,15 @@ func serveDashboard(ctx context.Context, config *Config) error {
 		hub:        hub,
 		baseConfig: config,
 		ctx:        ctx,
+		monitor:    monitor,
+		fleet:      newFleet(),
+	}
+	if config.HistoryDir != "" {
+		history, err := openHistory(config.HistoryDir)
+		if err != nil {
+			slog.Warn("Run history unavailable", logattr.Err(err))
+		}
+		srv.history = history
 	}
 
 	mux := http.NewServeMux()
@@ -79,6 +161,12 @@ func serveDashboard(ctx context.Context, config *Config) error {
 	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
 		hub.Handle(w, r)
 	})
+	mux.HandleFunc("/api/history", srv.handleHistory)
+	mux.HandleFunc("/api/history/", srv.handleHistoryRun)
+	srv.registerAgentRoutes(mux)
+	if monitor != nil {
+		mux.HandleFunc("/api/monitor", srv.handleMonitor)
+	}
 
 	// Static UI at root
 	fileServer := http.FileServer(http.FS(webUISub))
@@ -93,6 +181,9 @@ func serveDashboard(ctx context.Context, config *Config) error {
 
 	// Attempt to open the UI in the browser (best effort).
 	go func(ctx context.Context) {
+		if monitor != nil {
+			return
+		}
 		select {
 		case <-ctx.Done():
 			return
@@ -111,7 +202,7 @@ func serveDashboard(ctx context.Context, config *Config) error {
 		if err := openBrowser(ctx, url); err != nil {
 			slog.Warn(
 				"failed to open browser for Web UI",
-				slogErr(err),
+				logattr.Err(err),
 				slog.String("url", url),
 			)
 		}
@@ -122,10 +213,14 @@ func serveDashboard(ctx context.Context, config *Config) error {
 		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			slog.Warn("graceful shutdown failed", slogErr(err))
+			slog.Warn("graceful shutdown failed", logattr.Err(err))
 		}
 	}()
 
+	if monitor != nil {
+		go monitor.Run(ctx, hub)
+	}
+
 	slog.Info("Starting Web UI server", slog.String("addr", config.ListenAddr))
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("http server: %w", err)
@@ -138,12 +233,13 @@ func (s *uiServer) handleDefaults(w http.ResponseWriter, _ *http.Request) {
 		Resolvers:      builtInResolvers,
 		MajorResolvers: builtinMajorResolvers,
 		Domains:        defaultSites,
-		Options: runOptions{
-			Repeats:     s.baseConfig.Repeats,
-			TimeoutMs:   int(s.baseConfig.LookupTimeout.Milliseconds()),
-			Concurrency: s.baseConfig.MaxConcurrency,
-			Warmup:      s.baseConfig.WarmupRuns,
-		},
+		Options:        optionsFromConfig(s.baseConfig),
+	}
+	if len(s.baseConfig.Servers) > 0 {
+		resp.Resolvers = s.baseConfig.Servers
+	}
+	if len(s.baseConfig.Domains) > 0 {
+		resp.Domains = s.baseConfig.Domains
 	}
 	writeJSON(w, resp)
 }
@@ -161,7 +257,7 @@ func (s *uiServer) handleRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cfg, servers, domains, err := s.buildRunConfig(&req)
+	cfg, servers, domains, err := buildRunConfig(s.baseConfig, &req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -181,12 +277,14 @@ func (s *uiServer) handleRun(w http.ResponseWriter, r *http.Request) {
 	s.mu.Unlock()
 
 	go func() {
-		results, runErr := runBenchmark(runCtx, cfg, servers, domains, reporter)
+		manifest := newManifest(cfg)
+		results, runErr := runBenchmark(runCtx, cfg, manifest, servers, domains, reporter)
 		if runErr != nil {
-			slog.LogAttrs(runCtx, slog.LevelWarn, "benchmark finished with error", slogErr(runErr))
+			slog.LogAttrs(runCtx, slog.LevelWarn, "benchmark finished with error", logattr.Err(runErr))
 		}
 		if runErr == nil {
 			slog.LogAttrs(runCtx, slog.LevelInfo, "benchmark completed", slog.Int("results", len(results)))
+			recordRun(runCtx, cfg, SourceUI, manifest, servers, domains, results)
 		}
 	}()
 
@@ -247,8 +345,10 @@ func (s *uiServer) handleReset(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]string{"status": "reset"})
 }
 
-func (s *uiServer) buildRunConfig(req *runRequest) (*Config, []DNSServer, []string, error) {
-	cfg := *s.baseConfig
+// buildRunConfig applies the options of a run request to a copy of base and
+// picks the domains and resolvers to use.
+func buildRunConfig(base *Config, req *runRequest) (*Config, []bench.DNSServer, []string, error) {
+	cfg := *base
 
 	if req.Options.Repeats > 0 {
 		cfg.Repeats = req.Options.Repeats
@@ -262,19 +362,107 @@ func (s *uiServer) buildRunConfig(req *runRequest) (*Config, []DNSServer, []stri
 	if cfg.LookupTimeout < 100*time.Millisecond {
 		return nil, nil, nil, errors.New("timeout must be at least 100ms")
 	}
-	cfg.WarmupRuns = req.Options.Warmup
+	if req.Options.Warmup != nil {
+		if *req.Options.Warmup < 0 {
+			return nil, nil, nil, errors.New("warmup must not be negative")
+		}
+		cfg.WarmupRuns = *req.Options.Warmup
+	}
+	if req.Options.Retries != nil {
+		cfg.Retry.Retries = *req.Options.Retries
+	}
+	if req.Options.BackoffMs > 0 {
+		cfg.Retry.InitialBackoff = time.Duration(req.Options.BackoffMs) * time.Millisecond
+	}
+	if req.Options.MaxBackoffMs > 0 {
+		cfg.Retry.MaxBackoff = time.Duration(req.Options.MaxBackoffMs) * time.Millisecond
+	}
+	if err := cfg.Retry.Validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	if req.Options.PreflightMs != nil {
+		if *req.Options.PreflightMs < 0 {
+			return nil, nil, nil, errors.New("preflight must not be negative")
+		}
+		cfg.PreflightTimeout = time.Duration(*req.Options.PreflightMs) * time.Millisecond
+	}
+	if req.Options.Breaker != nil {
+		if *req.Options.Breaker < 0 {
+			return nil, nil, nil, errors.New("breaker must not be negative")
+		}
+		cfg.BreakerThreshold = *req.Options.Breaker
+	}
+	if req.Options.Adaptive != nil {
+		cfg.Adaptive = *req.Options.Adaptive
+	}
+	if req.Options.TargetCIMs > 0 {
+		cfg.TargetCI = time.Duration(req.Options.TargetCIMs) * time.Millisecond
+	}
+	if req.Options.MaxQueries != nil {
+		cfg.MaxQueries = *req.Options.MaxQueries
+	}
+	if req.Options.MaxTimeMs != nil {
+		cfg.MaxTime = time.Duration(*req.Options.MaxTimeMs) * time.Millisecond
+	}
+	if req.Options.RunQueries != nil {
+		cfg.RunQueries = *req.Options.RunQueries
+	}
+	if req.Options.RunTimeMs != nil {
+		cfg.RunTime = time.Duration(*req.Options.RunTimeMs) * time.Millisecond
+	}
+	if req.Options.QPS > 0 {
+		cfg.QPS = req.Options.QPS
+	}
+	if err := validateBudgets(&cfg); err != nil {
+		return nil, nil, nil, err
+	}
+	if req.Options.RTTProbes != nil {
+		if *req.Options.RTTProbes < 0 {
+			return nil, nil, nil, errors.New("rtt must not be negative")
+		}
+		cfg.RTTProbes = *req.Options.RTTProbes
+	}
+	if req.Options.RTTMethod != "" {
+		method, err := bench.ParseRTTMethod(string(req.Options.RTTMethod))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cfg.RTTMethod = method
+	}
+	if req.Options.IPFamily != "" {
+		family, err := parseIPFamily(string(req.Options.IPFamily))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cfg.IPFamily = family
+	}
+	if req.Options.QType != 0 {
+		cfg.QType = req.Options.QType
+	}
+	if req.Options.Weights != nil {
+		if err := req.Options.Weights.Validate(); err != nil {
+			return nil, nil, nil, err
+		}
+		cfg.ScoreWeights = *req.Options.Weights
+	}
 	cfg.OnlyMajorResolvers = cfg.OnlyMajorResolvers || req.Options.OnlyMajor
 
 	domains := req.Domains
 	if len(domains) == 0 {
 		domains = defaultSites
+		if len(cfg.Domains) > 0 {
+			domains = cfg.Domains
+		}
 	}
 
 	servers := req.Resolvers
 	if len(servers) == 0 {
-		if cfg.OnlyMajorResolvers {
+		switch {
+		case cfg.OnlyMajorResolvers:
 			servers = builtinMajorResolvers
-		} else {
+		case len(cfg.Servers) > 0:
+			servers = cfg.Servers
+		default:
 			servers = builtInResolvers
 		}
 	}
@@ -306,7 +494,7 @@ func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if f, err := h.fs.Open(path); err == nil {
 		defer func() {
 			if cerr := f.Close(); cerr != nil {
-				slog.Warn("failed to close asset file", slogErr(cerr))
+				slog.Warn("failed to close asset file", logattr.Err(cerr))
 			}
 		}()
 		h.fileServer.ServeHTTP(w, r)
@@ -320,7 +508,7 @@ func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() {
 		if cerr := index.Close(); cerr != nil {
-			slog.Warn("failed to close index.html", slogErr(cerr))
+			slog.Warn("failed to close index.html", logattr.Err(cerr))
 		}
 	}()
 	r.URL.Path = "/"
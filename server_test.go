@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// runSettings holds the Config fields a run request may leave out.
+type runSettings struct {
+	Warmup     int
+	Retries    int
+	Preflight  time.Duration
+	Breaker    int
+	Adaptive   bool
+	MaxQueries int
+	MaxTime    time.Duration
+	RunQueries int
+	RunTime    time.Duration
+}
+
+func settingsOf(c *Config) runSettings {
+	return runSettings{
+		Warmup:     c.WarmupRuns,
+		Retries:    c.Retry.Retries,
+		Preflight:  c.PreflightTimeout,
+		Breaker:    c.BreakerThreshold,
+		Adaptive:   c.Adaptive,
+		MaxQueries: c.MaxQueries,
+		MaxTime:    c.MaxTime,
+		RunQueries: c.RunQueries,
+		RunTime:    c.RunTime,
+	}
+}
+
+func TestBuildRunConfig_OmittedOptionsKeepBase(t *testing.T) {
+	base := &Config{
+		LookupTimeout:    time.Second,
+		Retry:            bench.RetryPolicy{Retries: 2, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 100 * time.Millisecond},
+		WarmupRuns:       1,
+		PreflightTimeout: 2 * time.Second,
+		BreakerThreshold: 5,
+		Adaptive:         true,
+		TargetCI:         2 * time.Millisecond,
+		MaxQueries:       50,
+		MaxTime:          time.Minute,
+		RunQueries:       500,
+		RunTime:          time.Hour,
+	}
+
+	tests := []struct {
+		name    string
+		options string
+		want    func(s *runSettings)
+		wantErr bool
+	}{
+		{name: "omitted keeps the base", options: `{}`, want: func(*runSettings) {}},
+		{name: "repeats only keeps the base", options: `{"repeats": 5}`, want: func(*runSettings) {}},
+		{name: "warmup", options: `{"warmup": 3}`, want: func(s *runSettings) { s.Warmup = 3 }},
+		{name: "zero warmup disables", options: `{"warmup": 0}`, want: func(s *runSettings) { s.Warmup = 0 }},
+		{name: "negative warmup", options: `{"warmup": -1}`, wantErr: true},
+		{name: "retries", options: `{"retries": 4}`, want: func(s *runSettings) { s.Retries = 4 }},
+		{name: "zero retries disables", options: `{"retries": 0}`, want: func(s *runSettings) { s.Retries = 0 }},
+		{name: "negative retries", options: `{"retries": -1}`, wantErr: true},
+		{
+			name: "preflight and breaker", options: `{"preflightMs": 500, "breaker": 3}`,
+			want: func(s *runSettings) { s.Preflight, s.Breaker = 500*time.Millisecond, 3 },
+		},
+		{
+			name: "zero preflight and breaker disable", options: `{"preflightMs": 0, "breaker": 0}`,
+			want: func(s *runSettings) { s.Preflight, s.Breaker = 0, 0 },
+		},
+		{name: "negative preflight", options: `{"preflightMs": -1}`, wantErr: true},
+		{name: "negative breaker", options: `{"breaker": -1}`, wantErr: true},
+		{name: "adaptive off", options: `{"adaptive": false}`, want: func(s *runSettings) { s.Adaptive = false }},
+		{
+			name: "budgets", options: `{"maxQueries": 20, "maxTimeMs": 30000}`,
+			want: func(s *runSettings) { s.MaxQueries, s.MaxTime = 20, 30*time.Second },
+		},
+		{
+			name: "zero budgets disable", options: `{"maxQueries": 0, "maxTimeMs": 0}`,
+			want: func(s *runSettings) { s.MaxQueries, s.MaxTime = 0, 0 },
+		},
+		{name: "negative max queries", options: `{"maxQueries": -1}`, wantErr: true},
+		{name: "negative max time", options: `{"maxTimeMs": -1}`, wantErr: true},
+		{
+			name: "run budgets", options: `{"runQueries": 100, "runTimeMs": 60000}`,
+			want: func(s *runSettings) { s.RunQueries, s.RunTime = 100, time.Minute },
+		},
+		{
+			name: "zero run budgets disable", options: `{"runQueries": 0, "runTimeMs": 0}`,
+			want: func(s *runSettings) { s.RunQueries, s.RunTime = 0, 0 },
+		},
+		{name: "negative run queries", options: `{"runQueries": -1}`, wantErr: true},
+		{name: "negative run time", options: `{"runTimeMs": -1}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req runRequest
+			if err := json.Unmarshal([]byte(`{"options": `+tt.options+`}`), &req); err != nil {
+				t.Fatal(err)
+			}
+			cfg, _, _, err := buildRunConfig(base, &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildRunConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := settingsOf(base)
+			tt.want(&want)
+			if got := settingsOf(cfg); got != want {
+				t.Errorf("buildRunConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
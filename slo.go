@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+	"github.com/handsomefox/dnsbench/internal/jsonnan"
+)
+
+// exitSLOBreached is the exit code of a run that completed but breached an SLO,
+// distinct from the generic failure code 1.
+const exitSLOBreached = 3
+
+var errSLOBreached = errors.New("SLO breached")
+
+// SLO holds thresholds checked after a run. Zero values disable a check.
+type SLO struct {
+	MaxMedian  time.Duration
+	MaxP95     time.Duration
+	MinSuccess float64 // percent
+	// Resolvers limits the median, p95 and success checks to these names or
+	// addresses; empty means every resolver in the run.
+	Resolvers []string
+	// MaxRank requires resolvers, by name or address, to rank at or above a
+	// position. Ranks are tie-aware: a resolver statistically tied with the
+	// one in second place ranks second.
+	MaxRank map[string]int
+}
+
+func (s *SLO) enabled() bool {
+	return s.MaxMedian > 0 || s.MaxP95 > 0 || s.MinSuccess > 0 || len(s.MaxRank) > 0
+}
+
+// SLO check names used in verdicts.
+const (
+	CheckMedian  = "median"
+	CheckP95     = "p95"
+	CheckSuccess = "success"
+	CheckRank    = "rank"
+	CheckPresent = "present"
+)
+
+// SLOBreach describes one failed check. Limit and Actual are in milliseconds
+// for latency checks, percent for success and a position for rank.
+type SLOBreach struct {
+	Resolver string  `json:"resolver"`
+	Addr     string  `json:"addr,omitempty"`
+	Check    string  `json:"check"`
+	Limit    float64 `json:"limit"`
+	Actual   float64 `json:"actual"`
+	Message  string  `json:"message"`
+}
+
+// MarshalJSON writes the actual value of resolvers without successful queries as null.
+func (b SLOBreach) MarshalJSON() ([]byte, error) {
+	type plain SLOBreach
+	return jsonnan.Marshal(plain(b))
+}
+
+// SLOVerdict is the machine-readable outcome of evaluating an SLO.
+type SLOVerdict struct {
+	Passed   bool        `json:"passed"`
+	Checks   int         `json:"checks"`
+	Breaches []SLOBreach `json:"breaches"`
+}
+
+// evaluateSLO checks results against slo, ranking them the same way the summary does.
+func evaluateSLO(results []bench.BenchmarkResult, slo *SLO, sortBy SortOrder) SLOVerdict {
+	v := SLOVerdict{Breaches: []SLOBreach{}}
+	breach := func(r bench.BenchmarkResult, check string, limit, actual float64, format string, args ...any) {
+		v.Breaches = append(v.Breaches, SLOBreach{
+			Resolver: r.Server.Name,
+			Addr:     r.Server.Addr,
+			Check:    check,
+			Limit:    limit,
+			Actual:   actual,
+			Message:  fmt.Sprintf("%s (%s): ", r.Server.Name, r.Server.Endpoint()) + fmt.Sprintf(format, args...),
+		})
+	}
+	missing := func(target string) {
+		v.Checks++
+		v.Breaches = append(v.Breaches, SLOBreach{
+			Resolver: target,
+			Check:    CheckPresent,
+			Limit:    math.NaN(),
+			Actual:   math.NaN(),
+			Message:  fmt.Sprintf("%s: resolver not found in results", target),
+		})
+	}
+
+	for _, target := range slo.Resolvers {
+		if !slices.ContainsFunc(results, func(r bench.BenchmarkResult) bool { return matchesResolver(r.Server, target) }) {
+			missing(target)
+		}
+	}
+
+	for _, r := range results {
+		if len(slo.Resolvers) > 0 && !slices.ContainsFunc(slo.Resolvers, func(t string) bool { return matchesResolver(r.Server, t) }) {
+			continue
+		}
+		s := r.Stats
+		if limit := slo.MaxMedian.Seconds() * 1000; limit > 0 {
+			v.Checks++
+			if math.IsNaN(s.Median) || s.Median > limit {
+				breach(r, CheckMedian, limit, s.Median, "median %.2fms exceeds %.2fms", s.Median, limit)
+			}
+		}
+		if limit := slo.MaxP95.Seconds() * 1000; limit > 0 {
+			v.Checks++
+			if math.IsNaN(s.P95) || s.P95 > limit {
+				breach(r, CheckP95, limit, s.P95, "p95 %.2fms exceeds %.2fms", s.P95, limit)
+			}
+		}
+		if slo.MinSuccess > 0 {
+			v.Checks++
+			if rate := s.SuccessRate() * 100; rate < slo.MinSuccess {
+				breach(r, CheckSuccess, slo.MinSuccess, rate, "success rate %.2f%% below %.2f%%", rate, slo.MinSuccess)
+			}
+		}
+	}
+
+	if len(slo.MaxRank) > 0 {
+		valid, failed := rankResults(results, sortBy)
+		ranks := make(map[string]int, len(valid))
+		_, groups := bench.CompareRanking(valid)
+		for _, g := range groups {
+			for _, name := range g.Resolvers {
+				ranks[name] = g.Rank
+			}
+		}
+
+		targets := make([]string, 0, len(slo.MaxRank))
+		for target := range slo.MaxRank {
+			targets = append(targets, target)
+		}
+		slices.Sort(targets)
+
+		for _, target := range targets {
+			limit := slo.MaxRank[target]
+			i := slices.IndexFunc(valid, func(r bench.BenchmarkResult) bool { return matchesResolver(r.Server, target) })
+			if i < 0 {
+				j := slices.IndexFunc(failed, func(r bench.BenchmarkResult) bool { return matchesResolver(r.Server, target) })
+				if j < 0 {
+					missing(target)
+					continue
+				}
+				v.Checks++
+				breach(failed[j], CheckRank, float64(limit), math.NaN(), "failed, so not ranked (limit top %d)", limit)
+				continue
+			}
+			v.Checks++
+			if rank := ranks[valid[i].Server.Name]; rank > limit {
+				breach(valid[i], CheckRank, float64(limit), float64(rank), "ranked %d, outside the top %d", rank, limit)
+			}
+		}
+	}
+
+	v.Passed = len(v.Breaches) == 0
+	return v
+}
+
+func matchesResolver(server bench.DNSServer, target string) bool {
+	return strings.EqualFold(server.Name, target) || server.Addr == target || server.Endpoint() == target
+}
+
+// parseRankSLO parses a list such as "Internal-1=1,Cloudflare-1=3".
+func parseRankSLO(spec string) (map[string]int, error) {
+	ranks := make(map[string]int)
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid rank SLO %q: expected resolver=N", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid rank SLO %q: rank must be a positive integer", part)
+		}
+		ranks[strings.TrimSpace(name)] = n
+	}
+	return ranks, nil
+}
+
+// reportVerdict prints breaches to stderr and, if path is set, writes the
+// verdict as JSON to that file, or to stdout for "-".
+func reportVerdict(v SLOVerdict, path string) error {
+	if v.Passed {
+		fmt.Fprintf(os.Stderr, "SLO passed (%d checks)\n", v.Checks)
+	} else {
+		fmt.Fprintf(os.Stderr, "SLO breached (%d of %d checks failed):\n", len(v.Breaches), v.Checks)
+		for _, b := range v.Breaches {
+			fmt.Fprintf(os.Stderr, "  - %s\n", b.Message)
+		}
+	}
+
+	if path == "" {
+		return nil
+	}
+	if path == "-" {
+		return writeVerdict(os.Stdout, v)
+	}
+
+	//nolint:gosec // file path provided by user intentionally
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("writing SLO report: %w", err)
+	}
+	if err := writeVerdict(f, v); err != nil {
+		_ = f.Close() //nolint:errcheck // already failing
+		return fmt.Errorf("writing SLO report: %w", err)
+	}
+	return f.Close()
+}
+
+func writeVerdict(w io.Writer, v SLOVerdict) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
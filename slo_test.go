@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestEvaluateSLO(t *testing.T) {
+	fast := testResult("fast", seq(10, 20)...)
+	slow := testResult("slow", seq(80, 20)...)
+	dead := bench.BenchmarkResult{
+		Server: bench.DNSServer{Name: "dead", Addr: "192.0.2.3"},
+		Stats:  bench.CalculateStats(nil, 5, 5),
+	}
+	results := []bench.BenchmarkResult{slow, dead, fast}
+
+	tests := []struct {
+		name   string
+		slo    SLO
+		checks int
+		want   []string
+	}{
+		{
+			name:   "p95 per resolver",
+			slo:    SLO{MaxP95: 50 * time.Millisecond},
+			checks: 3,
+			want:   []string{"slow/p95", "dead/p95"},
+		},
+		{
+			name:   "success limited to some resolvers",
+			slo:    SLO{MinSuccess: 99, Resolvers: []string{"fast", "192.0.2.3"}},
+			checks: 2,
+			want:   []string{"dead/success"},
+		},
+		{
+			name:   "rank",
+			slo:    SLO{MaxRank: map[string]int{"fast": 1, "slow": 1, "dead": 2}},
+			checks: 3,
+			want:   []string{"dead/rank", "slow/rank"},
+		},
+		{
+			name:   "missing resolver",
+			slo:    SLO{MaxRank: map[string]int{"internal": 1}},
+			checks: 1,
+			want:   []string{"internal/present"},
+		},
+		{
+			name:   "passes",
+			slo:    SLO{MaxMedian: 25 * time.Millisecond, Resolvers: []string{"fast"}},
+			checks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := evaluateSLO(results, &tt.slo, SortDefault)
+			var got []string
+			for _, b := range v.Breaches {
+				got = append(got, b.Resolver+"/"+b.Check)
+			}
+			if v.Checks != tt.checks || v.Passed != (len(tt.want) == 0) || len(got) != len(tt.want) {
+				t.Fatalf("evaluateSLO() = %d checks, passed %v, breaches %v, want %d checks, breaches %v",
+					v.Checks, v.Passed, got, tt.checks, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("breach %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRankSLO(t *testing.T) {
+	got, err := parseRankSLO("Internal-1=1, 10.0.0.53=3")
+	if err != nil || got["Internal-1"] != 1 || got["10.0.0.53"] != 3 {
+		t.Errorf("parseRankSLO() = %v, %v", got, err)
+	}
+	for _, spec := range []string{"Internal-1", "x=0", "=2", "x=a"} {
+		if _, err := parseRankSLO(spec); err == nil {
+			t.Errorf("parseRankSLO(%q) error = nil, want error", spec)
+		}
+	}
+}
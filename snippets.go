@@ -0,0 +1,382 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// SnippetFormat is a resolver configuration that dnsbench can write.
+type SnippetFormat string
+
+const (
+	SnippetResolvConf      SnippetFormat = "resolv.conf"
+	SnippetSystemdResolved SnippetFormat = "systemd-resolved"
+	SnippetDnsmasq         SnippetFormat = "dnsmasq"
+	SnippetUnbound         SnippetFormat = "unbound"
+	SnippetCoreDNS         SnippetFormat = "coredns"
+	SnippetNetworkManager  SnippetFormat = "networkmanager"
+)
+
+var snippetFormats = []SnippetFormat{
+	SnippetResolvConf, SnippetSystemdResolved, SnippetDnsmasq, SnippetUnbound, SnippetCoreDNS, SnippetNetworkManager,
+}
+
+// snippetFiles names the file each format is written to with -o.
+var snippetFiles = map[SnippetFormat]string{
+	SnippetResolvConf:      "resolv.conf",
+	SnippetSystemdResolved: "resolved-dnsbench.conf",
+	SnippetDnsmasq:         "dnsmasq-dnsbench.conf",
+	SnippetUnbound:         "unbound-forward.conf",
+	SnippetCoreDNS:         "Corefile",
+	SnippetNetworkManager:  "dnsbench.nmconnection",
+}
+
+// parseSnippetFormats parses a comma-separated list of formats; "all" selects
+// every format.
+func parseSnippetFormats(s string) ([]SnippetFormat, error) {
+	var formats []SnippetFormat
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch f := SnippetFormat(name); {
+		case name == "all":
+			return snippetFormats, nil
+		case slices.Contains(snippetFormats, f):
+			if !slices.Contains(formats, f) {
+				formats = append(formats, f)
+			}
+		default:
+			return nil, fmt.Errorf("invalid format %q: expected all, resolv.conf, systemd-resolved, dnsmasq, unbound, coredns or networkmanager", name)
+		}
+	}
+	return formats, nil
+}
+
+// knownTLSNames are the DNS-over-TLS certificate names of providers in the
+// built-in catalogue, used with -dot for resolvers that were measured over UDP.
+var knownTLSNames = map[string]string{
+	"Cloudflare": "cloudflare-dns.com",
+	"Google":     "dns.google",
+	"Quad9":      "dns.quad9.net",
+	"AdGuard":    "dns.adguard-dns.com",
+	"DNS0-EU":    "dns0.eu",
+}
+
+// tlsName returns the name to verify in the certificate of s over DNS over
+// TLS, or "" when it is not known.
+func tlsName(s bench.DNSServer) string {
+	if s.Transport == bench.TransportTLS && s.Hostname != "" {
+		return s.Hostname
+	}
+	return knownTLSNames[providerOf(s)]
+}
+
+// selectSnippetServers picks the resolvers to configure from the results of
+// a run: the names in names, in that order, or else the recommended pair of
+// the pair analysis followed by the rest of the ranking, n in total. pairs is
+// the recorded analysis of results without samples; without either, the
+// fastest resolver is paired with the fastest of another provider.
+func selectSnippetServers(results []bench.BenchmarkResult, pairs *PairAnalysis, names []string, n int) ([]bench.DNSServer, error) {
+	valid, _ := rankResults(results, SortDefault)
+	if len(names) > 0 {
+		servers := make([]bench.DNSServer, 0, len(names))
+		for _, name := range names {
+			i := slices.IndexFunc(results, func(r bench.BenchmarkResult) bool {
+				return strings.EqualFold(r.Server.Name, name) || r.Server.Addr == name
+			})
+			if i < 0 {
+				return nil, fmt.Errorf("resolver %q is not in the run", name)
+			}
+			servers = append(servers, results[i].Server)
+		}
+		return servers, nil
+	}
+	if len(valid) == 0 {
+		return nil, errors.New("no resolver of the run answered")
+	}
+
+	var servers []bench.DNSServer
+	add := func(name string) {
+		if len(servers) < n && !slices.ContainsFunc(servers, func(s bench.DNSServer) bool { return s.Name == name }) {
+			if i := slices.IndexFunc(valid, func(r bench.BenchmarkResult) bool { return r.Server.Name == name }); i >= 0 {
+				servers = append(servers, valid[i].Server)
+			}
+		}
+	}
+	if analysis := resolverPairs(valid); analysis != nil {
+		pairs = analysis
+	}
+	if pairs != nil && pairs.Recommended != nil {
+		add(pairs.Recommended.Primary)
+		add(pairs.Recommended.Secondary)
+	} else {
+		add(valid[0].Server.Name)
+		if i := slices.IndexFunc(valid, func(r bench.BenchmarkResult) bool { return providerOf(r.Server) != providerOf(valid[0].Server) }); i >= 0 {
+			add(valid[i].Server.Name)
+		}
+	}
+	for _, r := range valid {
+		add(r.Server.Name)
+	}
+	return servers, nil
+}
+
+// renderSnippet returns the configuration of format that uses servers in
+// order, the first as the primary. With dot it configures DNS over TLS where
+// the format and the certificate names of the servers allow it.
+func renderSnippet(format SnippetFormat, servers []bench.DNSServer, dot bool, source string) string {
+	var b strings.Builder
+	line := func(format string, args ...any) { fmt.Fprintf(&b, format+"\n", args...) }
+
+	names := make([]string, 0, len(servers))
+	for _, s := range servers {
+		names = append(names, s.Name)
+	}
+	line("# Generated by dnsbench from %s: %s", source, strings.Join(names, ", "))
+	allTLS := dot && !slices.ContainsFunc(servers, func(s bench.DNSServer) bool { return tlsName(s) == "" })
+
+	switch format {
+	case SnippetResolvConf:
+		line("# Replace /etc/resolv.conf, unless a service such as systemd-resolved manages it.")
+		if dot {
+			line("# The C library resolver cannot use DNS over TLS; these are plain DNS.")
+		}
+		if len(servers) > 3 {
+			line("# Only the first 3 nameservers are used.")
+		}
+		for _, s := range servers {
+			line("nameserver %s", s.Addr)
+		}
+
+	case SnippetSystemdResolved:
+		line("# Save as /etc/systemd/resolved.conf.d/dnsbench.conf and run: systemctl restart systemd-resolved")
+		dns := make([]string, 0, len(servers))
+		for _, s := range servers {
+			if name := tlsName(s); dot && name != "" {
+				dns = append(dns, s.Addr+"#"+name)
+			} else {
+				dns = append(dns, s.Addr)
+			}
+		}
+		line("[Resolve]")
+		line("DNS=%s", strings.Join(dns, " "))
+		line("Domains=~.")
+		switch {
+		case allTLS:
+			line("DNSOverTLS=yes")
+		case dot:
+			line("# Some servers have no known certificate name, so DNS over TLS is opportunistic.")
+			line("DNSOverTLS=opportunistic")
+		}
+
+	case SnippetDnsmasq:
+		line("# Save as /etc/dnsmasq.d/dnsbench.conf and restart dnsmasq.")
+		if dot {
+			line("# dnsmasq cannot forward over DNS over TLS; these are plain DNS.")
+		}
+		line("no-resolv")
+		line("# Ask the servers in order; replace with all-servers to race them.")
+		line("strict-order")
+		for _, s := range servers {
+			line("server=%s", s.Addr)
+		}
+
+	case SnippetUnbound:
+		line("# Include from unbound.conf and run: unbound-control reload")
+		if allTLS {
+			line("# DNS over TLS needs tls-cert-bundle in the server: clause, e.g.")
+			line("#   tls-cert-bundle: /etc/ssl/certs/ca-certificates.crt")
+		}
+		line("forward-zone:")
+		line("    name: \".\"")
+		for _, s := range servers {
+			if allTLS {
+				line("    forward-addr: %s@853#%s", s.Addr, tlsName(s))
+			} else {
+				line("    forward-addr: %s", s.Addr)
+			}
+		}
+		if allTLS {
+			line("    forward-tls-upstream: yes")
+		} else if dot {
+			line("    # Some servers have no known certificate name, so these are plain DNS.")
+		}
+
+	case SnippetCoreDNS:
+		line("# Corefile server block; merge it into your Corefile.")
+		tlsNames := make(map[string]bool)
+		for _, s := range servers {
+			tlsNames[tlsName(s)] = true
+		}
+		// A forward block verifies a single TLS server name.
+		useTLS := allTLS && len(tlsNames) == 1
+		if dot && !useTLS {
+			line("# A CoreDNS forward block verifies one TLS server name shared by all its servers; these are plain DNS.")
+		}
+		addrs := make([]string, 0, len(servers))
+		for _, s := range servers {
+			if useTLS {
+				addrs = append(addrs, "tls://"+s.Addr)
+			} else {
+				addrs = append(addrs, s.Addr)
+			}
+		}
+		line(". {")
+		line("    forward . %s {", strings.Join(addrs, " "))
+		if useTLS {
+			line("        tls_servername %s", tlsName(servers[0]))
+		}
+		line("        policy sequential")
+		line("    }")
+		line("    cache 30")
+		line("}")
+
+	case SnippetNetworkManager:
+		line("# Merge into the keyfile of your connection in /etc/NetworkManager/system-connections/,")
+		line("# or set the same values with nmcli, then run: nmcli connection up <name>")
+		if dot {
+			line("[connection]")
+			line("# DNS over TLS is handled by systemd-resolved; set the server names in its drop-in.")
+			line("dns-over-tls=2")
+			line("")
+		}
+		for _, family := range []string{"ipv4", "ipv6"} {
+			var addrs []string
+			for _, s := range servers {
+				if s.IPv6() == (family == "ipv6") {
+					addrs = append(addrs, s.Addr+";")
+				}
+			}
+			if len(addrs) == 0 {
+				continue
+			}
+			line("[%s]", family)
+			line("dns=%s", strings.Join(addrs, ""))
+			line("ignore-auto-dns=true")
+			line("")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// runSnippetsCommand implements "dnsbench snippets [run]" and returns the
+// process exit code.
+func runSnippetsCommand(args []string) int {
+	fs := flag.NewFlagSet("snippets", flag.ContinueOnError)
+	dir := fs.String("dir", defaultHistoryDir(), "History directory used to look up run IDs")
+	format := fs.String("format", "all", "Formats to write: all, or a comma-separated list of resolv.conf, systemd-resolved, dnsmasq, unbound, coredns and networkmanager")
+	count := fs.Int("n", 2, "Number of resolvers to configure, the recommended pair first")
+	resolvers := fs.String("resolvers", "", "Comma-separated names or addresses of the resolvers to configure, in order (default: the best of the run)")
+	dot := fs.Bool("dot", false, "Use DNS over TLS where the format supports it")
+	out := fs.String("o", "", "Directory to write one file per format to (default: print to stdout)")
+	fs.Usage = func() {
+		//nolint:errcheck // best-effort help output
+		_, _ = fmt.Fprintf(fs.Output(), `Usage:
+  dnsbench snippets [options] [run]
+
+Print or write resolver configuration for the best resolvers of a run: a JSON
+file written with -output json or the ID of a stored run (default the latest
+stored run). Nothing is applied to this system.
+
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	formats, err := parseSnippetFormats(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if *count < 1 {
+		fmt.Fprintf(os.Stderr, "Error: n must be at least 1\n")
+		return 2
+	}
+
+	source := fs.Arg(0)
+	if source == "" {
+		if source, err = latestRun(*dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	results, _, pairs, err := loadRunResults(source, *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var names []string
+	if *resolvers != "" {
+		names = strings.Split(*resolvers, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+	}
+	servers, err := selectSnippetServers(results, pairs, names, *count)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *out != "" {
+		if err := os.MkdirAll(*out, 0o750); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	for i, f := range formats {
+		snippet := renderSnippet(f, servers, *dot, "run "+filepath.Base(source))
+		if *out == "" {
+			if i > 0 {
+				fmt.Println()
+			}
+			if len(formats) > 1 {
+				fmt.Printf("# ==> %s <==\n", f)
+			}
+			fmt.Print(snippet)
+			continue
+		}
+		path := filepath.Join(*out, snippetFiles[f])
+		if err := os.WriteFile(path, []byte(snippet), 0o600); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+	return 0
+}
+
+// latestRun returns the ID of the most recent stored run in dir.
+func latestRun(dir string) (string, error) {
+	if dir == "" {
+		return "", errors.New("no run given and run history is disabled")
+	}
+	store, err := openHistory(dir)
+	if err != nil {
+		return "", err
+	}
+	runs, err := store.List()
+	if err != nil {
+		return "", err
+	}
+	if len(runs) == 0 {
+		return "", errors.New("no stored runs; give a JSON file written with -output json")
+	}
+	return runs[0].ID, nil
+}
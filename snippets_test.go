@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+func TestParseSnippetFormats(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []SnippetFormat
+		wantErr bool
+	}{
+		{in: "all", want: snippetFormats},
+		{in: "unbound, CoreDNS,unbound", want: []SnippetFormat{SnippetUnbound, SnippetCoreDNS}},
+		{in: "bind", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSnippetFormats(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSnippetFormats(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseSnippetFormats(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectSnippetServers(t *testing.T) {
+	nan := math.NaN()
+	results := []bench.BenchmarkResult{
+		testResult("Cloudflare-1", 10, 10, 10, nan),
+		testResult("Cloudflare-2", 11, 11, 11, nan),
+		testResult("Quad9-1", 20, 20, 20, 20),
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		n     int
+		want  []string
+	}{
+		{name: "Recommended pair", n: 2, want: []string{"Cloudflare-1", "Quad9-1"}},
+		{name: "Pair and ranking", n: 3, want: []string{"Cloudflare-1", "Quad9-1", "Cloudflare-2"}},
+		{name: "Named", names: []string{"quad9-1", "Cloudflare-2"}, n: 2, want: []string{"Quad9-1", "Cloudflare-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, err := selectSnippetServers(results, nil, tt.names, tt.n)
+			if err != nil {
+				t.Fatalf("selectSnippetServers() error = %v", err)
+			}
+			if got := serverNames(servers); !slices.Equal(got, tt.want) {
+				t.Errorf("selectSnippetServers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := selectSnippetServers(results, nil, []string{"Google-1"}, 2); err == nil {
+		t.Errorf("selectSnippetServers() of an unknown resolver error = nil")
+	}
+}
+
+func TestSelectSnippetServers_OutputJSON(t *testing.T) {
+	nan := math.NaN()
+	valid, _ := rankResults([]bench.BenchmarkResult{
+		testResult("Cloudflare-1", 10, 10, 10, nan),
+		testResult("Cloudflare-2", 11, 11, 11, nan),
+		testResult("Quad9-1", 20, 20, 20, 20),
+	}, SortDefault)
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printResultsJSON(f, valid, nil, nil, nil, nil)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, pairs, err := loadRunResults(path, "")
+	if err != nil {
+		t.Fatalf("loadRunResults() error = %v", err)
+	}
+	servers, err := selectSnippetServers(results, pairs, nil, 2)
+	if err != nil {
+		t.Fatalf("selectSnippetServers() error = %v", err)
+	}
+	if got, want := serverNames(servers), []string{"Cloudflare-1", "Quad9-1"}; !slices.Equal(got, want) {
+		t.Errorf("selectSnippetServers() of a -output json file = %v, want %v", got, want)
+	}
+
+	// Without samples or a recorded analysis, the second resolver is still
+	// of another provider.
+	unsampled, _ := rankResults([]bench.BenchmarkResult{
+		testResult("Cloudflare-1", 10, 10),
+		testResult("Cloudflare-2", 11, 11),
+		testResult("Quad9-1", 20, 20),
+	}, SortDefault)
+	for i := range unsampled {
+		unsampled[i].Samples = nil
+	}
+	servers, err = selectSnippetServers(unsampled, nil, nil, 2)
+	if err != nil {
+		t.Fatalf("selectSnippetServers() error = %v", err)
+	}
+	if got, want := serverNames(servers), []string{"Cloudflare-1", "Quad9-1"}; !slices.Equal(got, want) {
+		t.Errorf("selectSnippetServers() without an analysis = %v, want %v", got, want)
+	}
+}
+
+func TestRenderSnippet(t *testing.T) {
+	servers := []bench.DNSServer{
+		{Name: "Cloudflare-1", Addr: "1.1.1.1", Provider: "Cloudflare"},
+		{Name: "Quad9-v6-1", Addr: "2620:fe::fe", Provider: "Quad9"},
+	}
+	internal := append(slices.Clone(servers), bench.DNSServer{Name: "Internal-1", Addr: "10.0.0.53"})
+
+	tests := []struct {
+		format  SnippetFormat
+		servers []bench.DNSServer
+		dot     bool
+		want    []string
+	}{
+		{format: SnippetResolvConf, servers: servers, want: []string{"nameserver 1.1.1.1\nnameserver 2620:fe::fe\n"}},
+		{format: SnippetSystemdResolved, servers: servers, dot: true, want: []string{"DNS=1.1.1.1#cloudflare-dns.com 2620:fe::fe#dns.quad9.net", "DNSOverTLS=yes"}},
+		{format: SnippetSystemdResolved, servers: internal, dot: true, want: []string{" 10.0.0.53\n", "DNSOverTLS=opportunistic"}},
+		{format: SnippetDnsmasq, servers: servers, want: []string{"strict-order\nserver=1.1.1.1\nserver=2620:fe::fe\n"}},
+		{format: SnippetUnbound, servers: servers, dot: true, want: []string{"forward-addr: 1.1.1.1@853#cloudflare-dns.com", "forward-tls-upstream: yes"}},
+		{format: SnippetUnbound, servers: internal, dot: true, want: []string{"forward-addr: 10.0.0.53\n", "plain DNS"}},
+		{format: SnippetCoreDNS, servers: servers, want: []string{"forward . 1.1.1.1 2620:fe::fe {", "policy sequential"}},
+		{format: SnippetCoreDNS, servers: servers[:1], dot: true, want: []string{"forward . tls://1.1.1.1 {", "tls_servername cloudflare-dns.com"}},
+		{format: SnippetNetworkManager, servers: servers, want: []string{"[ipv4]\ndns=1.1.1.1;\n", "[ipv6]\ndns=2620:fe::fe;\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got := renderSnippet(tt.format, tt.servers, tt.dot, "run test")
+			if !strings.HasPrefix(got, "# Generated by dnsbench from run test: Cloudflare-1") {
+				t.Errorf("renderSnippet() does not start with the generated comment:\n%s", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("renderSnippet() does not contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/handsomefox/dnsbench/internal/logattr"
 )
 
 // SSEEvent represents a server-sent event message pushed to UI clients.
 type SSEEvent struct {
-	RunID  string      `json:"runId"`
-	Type   string      `json:"type"`
+	RunID string `json:"runId"`
+	Type  string `json:"type"`
+	// Agent names the vantage point of events relayed from an agent.
+	Agent  string      `json:"agent,omitempty"`
 	Detail interface{} `json:"detail,omitempty"`
 }
 
@@ -118,11 +122,11 @@ func (h *SSEHub) Handle(w http.ResponseWriter, r *http.Request) {
 func writeEvent(w http.ResponseWriter, flusher http.Flusher, evt SSEEvent) {
 	b, err := json.Marshal(evt)
 	if err != nil {
-		slog.Error("failed to encode SSE event", slogErr(err))
+		slog.Error("failed to encode SSE event", logattr.Err(err))
 		return
 	}
 	if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
-		slog.Warn("failed to write SSE event", slogErr(err))
+		slog.Warn("failed to write SSE event", logattr.Err(err))
 		return
 	}
 	flusher.Flush()
@@ -1,47 +1,92 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"log/slog"
-	"math/rand/v2"
+	"math"
 	"os"
-	"runtime"
+	"slices"
 	"sort"
 	"strings"
-	"time"
+
+	"github.com/handsomefox/dnsbench/bench"
 )
 
-func printSummary(results []BenchmarkResult, outputType OutputType) {
+// printSummary prints ranked results. The manifest, if any, is included in
+// JSON output and described after the default summary.
+func printSummary(results []bench.BenchmarkResult, outputType OutputType, sortBy SortOrder, manifest *Manifest) {
 	if len(results) == 0 {
 		fmt.Println("\nNo benchmark results to display")
 		return
 	}
 
-	var valid, failed []BenchmarkResult
+	if manifest != nil && manifest.Partial {
+		printPartialBanner(outputType, results)
+	}
+
+	valid, failed := rankResults(results, sortBy)
+	comparisons, groups := bench.CompareRanking(valid)
+	printByType(outputType, valid, failed, comparisons, groups, manifest)
+	if outputType == OutputDefault && manifest != nil {
+		printManifest(os.Stdout, manifest)
+	}
+}
+
+// printPartialBanner marks the results of an interrupted run. Machine-readable
+// output gets the note on stderr; JSON carries it in summary.partial.
+//
+//nolint:errcheck // printing helper
+func printPartialBanner(outputType OutputType, results []bench.BenchmarkResult) {
+	w := os.Stdout
+	switch outputType {
+	case OutputJSON:
+		return
+	case OutputCSV:
+		w = os.Stderr
+	}
+	_, _ = fmt.Fprintf(w, "\nPARTIAL RESULTS: the run was interrupted after %d resolvers", completedResolvers(results))
+	if n := len(results) - completedResolvers(results); n > 0 {
+		_, _ = fmt.Fprintf(w, "; %d was cut short", n)
+	}
+	_, _ = fmt.Fprintln(w)
+}
+
+// completedResolvers counts the results that were not cut short by cancellation.
+func completedResolvers(results []bench.BenchmarkResult) int {
+	n := 0
 	for _, r := range results {
-		if r.Stats.IsValid() {
-			valid = append(valid, r)
-		} else {
+		if !r.Interrupted() {
+			n++
+		}
+	}
+	return n
+}
+
+// rankResults splits results into ranked valid results, best first, and failed ones.
+func rankResults(results []bench.BenchmarkResult, sortBy SortOrder) (valid, failed []bench.BenchmarkResult) {
+	for _, r := range results {
+		if r.Failed() {
 			failed = append(failed, r)
+		} else {
+			valid = append(valid, r)
 		}
 	}
 
 	sort.Slice(valid, func(i, j int) bool {
+		if sortBy == SortScore && valid[i].Score != valid[j].Score {
+			return valid[i].Score > valid[j].Score
+		}
 		vi, vj := valid[i].Stats.SuccessRate(), valid[j].Stats.SuccessRate()
 		if vi == vj {
 			return valid[i].Stats.Mean < valid[j].Stats.Mean
 		}
 		return vi > vj
 	})
-
-	printByType(outputType, valid, failed)
+	return valid, failed
 }
 
-func printByType(t OutputType, valid, failed []BenchmarkResult) {
+func printByType(t OutputType, valid, failed []bench.BenchmarkResult, comparisons []bench.Comparison, groups []bench.RankGroup, manifest *Manifest) {
 	switch t {
 	case OutputCSV:
 		printResultsCSV(os.Stdout, valid, false)
@@ -50,124 +95,299 @@ func printByType(t OutputType, valid, failed []BenchmarkResult) {
 		printResultsTable(os.Stdout, valid, false)
 		printResultsTable(os.Stderr, failed, true)
 	case OutputJSON:
-		printResultsJSON(valid, failed)
+		printResultsJSON(os.Stdout, valid, failed, comparisons, groups, manifest)
 	default:
-		printDefaultSummary(valid, failed)
+		printDefaultSummary(valid, failed, comparisons, groups, manifest)
 	}
 }
 
 //nolint:errcheck // printing helper
-func printResultsCSV(w io.Writer, results []BenchmarkResult, failed bool) {
+func printResultsCSV(w io.Writer, results []bench.BenchmarkResult, failed bool) {
 	if len(results) == 0 {
 		return
 	}
 	if failed {
 		_, _ = fmt.Fprintln(w, "\nFailed resolvers:")
-		_, _ = fmt.Fprintln(w, "Resolver,Address,Errors,Total")
+		_, _ = fmt.Fprintln(w, "Resolver,Address,Errors,Total,Reason")
 		for _, r := range results {
-			_, _ = fmt.Fprintf(w, "%s,%s,%d,%d\n", r.Server.Name, r.Server.Addr, r.Stats.Errors, r.Stats.Total)
+			_, _ = fmt.Fprintf(w, "%s,%s,%d,%d,%q\n", r.Server.Name, r.Server.Endpoint(), r.Stats.Errors, r.Stats.Total, r.FailureReason())
 		}
 		return
 	}
-	_, _ = fmt.Fprintln(w, "Resolver,Success Rate,Mean (ms),Min (ms),Max (ms),Total Queries")
+	_, _ = fmt.Fprintln(w, "Resolver,Score,Success Rate,First Try Rate,Mean (ms),Median (ms),P95 (ms),Jitter (ms),Min (ms),Max (ms),Mean With Retries (ms),Total Queries,Attempts,RTT (ms),Overhead (ms)")
 	for _, r := range results {
-		_, _ = fmt.Fprintf(w, "%s,%.1f,%.2f,%.2f,%.2f,%d\n",
+		rtt, overhead := "", ""
+		if r.RTT != nil {
+			rtt, overhead = csvFloat(r.RTT.Min), csvFloat(r.RTT.Overhead)
+		}
+		_, _ = fmt.Fprintf(w, "%s,%.1f,%.1f,%.1f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%d,%d,%s,%s\n",
 			r.Server.Name,
+			r.Score,
 			r.Stats.SuccessRate()*100,
+			r.Stats.FirstTrySuccessRate()*100,
 			r.Stats.Mean,
+			r.Stats.Median,
+			r.Stats.P95,
+			r.Stats.Jitter,
 			r.Stats.Min,
 			r.Stats.Max,
-			r.Stats.Total)
+			r.Stats.MeanTotal,
+			r.Stats.Total,
+			r.Stats.Attempts,
+			rtt,
+			overhead)
+	}
+}
+
+// csvFloat formats v with two decimals, leaving the cell empty for NaN.
+func csvFloat(v float64) string {
+	if math.IsNaN(v) {
+		return ""
 	}
+	return fmt.Sprintf("%.2f", v)
 }
 
 //nolint:errcheck // printing helper
-func printResultsTable(w io.Writer, results []BenchmarkResult, failed bool) {
+func printResultsTable(w io.Writer, results []bench.BenchmarkResult, failed bool) {
 	if len(results) == 0 {
 		return
 	}
 	if failed {
+		// IPv6 endpoints are much longer than IPv4 ones.
+		addrWidth := len("Address")
+		for _, r := range results {
+			addrWidth = max(addrWidth, len(r.Server.Endpoint()))
+		}
 		_, _ = fmt.Fprintln(w, "\nFailed resolvers:")
-		_, _ = fmt.Fprintf(w, "%-20s %-15s %10s %10s\n", "Resolver", "Address", "Errors", "Total")
+		_, _ = fmt.Fprintf(w, "%-20s %-*s %10s %10s  %s\n", "Resolver", addrWidth, "Address", "Errors", "Total", "Reason")
 		for _, r := range results {
-			_, _ = fmt.Fprintf(w, "%-20s %-15s %10d %10d\n",
-				truncateString(r.Server.Name, 20), r.Server.Addr, r.Stats.Errors, r.Stats.Total)
+			_, _ = fmt.Fprintf(w, "%-20s %-*s %10d %10d  %s\n",
+				truncateString(r.Server.Name, 20), addrWidth, r.Server.Endpoint(), r.Stats.Errors, r.Stats.Total, r.FailureReason())
 		}
 		return
 	}
-	_, _ = fmt.Fprintf(w, "%-20s %10s %10s %10s %10s %10s\n",
-		"Resolver", "Success%", "Mean(ms)", "Min(ms)", "Max(ms)", "Queries")
-	_, _ = fmt.Fprintf(w, "%s\n", strings.Repeat("-", 80))
+	_, _ = fmt.Fprintf(w, "%-20s %7s %10s %10s %10s %10s %10s %10s %10s %10s %10s\n",
+		"Resolver", "Score", "Success%", "1stTry%", "Mean(ms)", "Median(ms)", "P95(ms)", "Min(ms)", "Max(ms)", "Queries", "Attempts")
+	_, _ = fmt.Fprintf(w, "%s\n", strings.Repeat("-", 127))
 	for _, r := range results {
-		_, _ = fmt.Fprintf(w, "%-20s %9.1f%% %9.2f %9.2f %9.2f %10d\n",
+		_, _ = fmt.Fprintf(w, "%-20s %7.1f %9.1f%% %9.1f%% %10.2f %10.2f %10.2f %10.2f %10.2f %10d %10d\n",
 			truncateString(r.Server.Name, 20),
+			r.Score,
 			r.Stats.SuccessRate()*100,
+			r.Stats.FirstTrySuccessRate()*100,
 			r.Stats.Mean,
+			r.Stats.Median,
+			r.Stats.P95,
 			r.Stats.Min,
 			r.Stats.Max,
-			r.Stats.Total)
+			r.Stats.Total,
+			r.Stats.Attempts)
+	}
+}
+
+//nolint:errcheck // printing helper
+func printComparison(w io.Writer, valid []bench.BenchmarkResult, comparisons []bench.Comparison, groups []bench.RankGroup) {
+	if len(valid) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%-20s %24s %24s\n", "Resolver", "Median(ms) [95% CI]", "Mean(ms) [95% CI]")
+	for _, r := range valid {
+		_, _ = fmt.Fprintf(w, "%-20s %24s %24s\n",
+			truncateString(r.Server.Name, 20),
+			formatEstimate(r.Stats.Median, r.Stats.MedianCI),
+			formatEstimate(r.Stats.Mean, r.Stats.MeanCI))
+	}
+
+	if len(comparisons) > 0 {
+		_, _ = fmt.Fprintln(w, "\nAdjacent ranks (Mann-Whitney U on latency, z-test on success rate):")
+		for _, c := range comparisons {
+			verdict := "tied"
+			if c.Significant {
+				verdict = "different"
+			}
+			_, _ = fmt.Fprintf(w, "  %-20s vs %-20s latency p=%.3f success p=%.3f  %s\n",
+				truncateString(c.Better, 20), truncateString(c.Worse, 20), c.LatencyP, c.SuccessP, verdict)
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "\nRanking (resolvers on one line are not significantly different at p<%.2f):\n", bench.SignificanceLevel)
+	for _, g := range groups {
+		_, _ = fmt.Fprintf(w, "  #%-3d %s\n", g.Rank, strings.Join(g.Resolvers, ", "))
 	}
 }
 
-func printDefaultSummary(valid, failed []BenchmarkResult) {
+func hasColdStats(results []bench.BenchmarkResult) bool {
+	for _, r := range results {
+		if r.Cold != nil {
+			return true
+		}
+	}
+	return false
+}
+
+//nolint:errcheck // printing helper
+func printColdTable(w io.Writer, results []bench.BenchmarkResult) {
+	_, _ = fmt.Fprintf(w, "%-20s %14s %14s %14s %14s\n",
+		"Resolver", "Cold Med(ms)", "Cold Mean(ms)", "Warm Med(ms)", "Penalty(ms)")
+	for _, r := range results {
+		if r.Cold == nil {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %14.2f %14.2f %14.2f %14.2f\n",
+			truncateString(r.Server.Name, 20),
+			r.Cold.Median,
+			r.Cold.Mean,
+			r.Stats.Median,
+			r.Cold.Median-r.Stats.Median)
+	}
+}
+
+func hasRTT(results []bench.BenchmarkResult) bool {
+	for _, r := range results {
+		if r.RTT != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// printRTTTable splits the median latency of each resolver into the network
+// round trips a query needs and the time the resolver itself takes.
+//
+//nolint:errcheck // printing helper
+func printRTTTable(w io.Writer, results []bench.BenchmarkResult) {
+	_, _ = fmt.Fprintf(w, "%-20s %-6s %12s %12s %6s %12s %13s  %s\n",
+		"Resolver", "Method", "RTT Min(ms)", "RTT Med(ms)", "Trips", "DNS Med(ms)", "Overhead(ms)", "Mostly")
+	for _, r := range results {
+		if r.RTT == nil {
+			continue
+		}
+		verdict := "distance"
+		switch share := r.RTT.Share(); {
+		case math.IsNaN(share):
+			verdict = "unknown"
+			if r.RTT.Error != "" {
+				verdict += " (" + r.RTT.Error + ")"
+			}
+		case share < 0.5:
+			verdict = "resolver"
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %-6s %12.2f %12.2f %6d %12.2f %13.2f  %s\n",
+			truncateString(r.Server.Name, 20),
+			r.RTT.Method,
+			r.RTT.Min,
+			r.RTT.Median,
+			r.RTT.RoundTrips,
+			r.Stats.Median,
+			r.RTT.Overhead,
+			verdict)
+	}
+}
+
+func formatEstimate(v float64, ci bench.Interval) string {
+	return fmt.Sprintf("%.2f [%.2f-%.2f]", v, ci.Low, ci.High)
+}
+
+func printDefaultSummary(valid, failed []bench.BenchmarkResult, comparisons []bench.Comparison, groups []bench.RankGroup, manifest *Manifest) {
+	all := append(slices.Clone(valid), failed...)
+	ds := dualStack(all)
+	var network NetworkInfo
+	if manifest != nil {
+		network = manifest.Network
+	}
+	// One line explains a family the network cannot reach; listing each of
+	// its resolvers as failed would bury it.
+	outages := resultOutages(all, network)
+	for _, o := range outages {
+		failed = withoutFamily(failed, o.Family)
+	}
+
 	fmt.Println("\n" + strings.Repeat("=", 80))
 	fmt.Println("DNS BENCHMARK RESULTS - TOP PERFORMERS")
 	fmt.Println(strings.Repeat("=", 80))
 	printResultsTable(os.Stdout, valid, false)
+	if len(valid) > 1 {
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println("\nSTATISTICAL COMPARISON:")
+		fmt.Println(strings.Repeat("-", 80))
+		printComparison(os.Stdout, valid, comparisons, groups)
+	}
+	if hasColdStats(valid) {
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println("\nCOLD FIRST QUERY (first warmup pass):")
+		fmt.Println(strings.Repeat("-", 80))
+		printColdTable(os.Stdout, valid)
+	}
+	if hasRTT(valid) {
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println("\nNETWORK RTT BASELINE (overhead = DNS median - round trips x RTT min):")
+		fmt.Println(strings.Repeat("-", 80))
+		printRTTTable(os.Stdout, valid)
+	}
+	if hasDualStackRows(ds) {
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println("\nDUAL-STACK (fastest IPv4 vs IPv6 endpoint per provider):")
+		fmt.Println(strings.Repeat("-", 80))
+		printDualStackTable(os.Stdout, ds)
+	}
+	if pairs := resolverPairs(valid); pairs != nil {
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println("\nRESOLVER PAIRS (simulated primary/secondary failover and racing, ms):")
+		fmt.Println(strings.Repeat("-", 80))
+		printPairTable(os.Stdout, pairs, 5)
+		fmt.Println(pairRecommendation(pairs))
+	}
 	if len(failed) > 0 {
 		fmt.Println(strings.Repeat("-", 80))
 		fmt.Println("\nFAILED RESOLVERS:")
 		fmt.Println(strings.Repeat("-", 80))
 		printResultsTable(os.Stdout, failed, true)
 	}
+	for _, o := range outages {
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Println("Note: " + brokenNote(o, network))
+	}
 	if len(valid) > 0 {
 		fmt.Println(strings.Repeat("-", 80))
 		fmt.Printf("Summary: %d resolvers tested successfully, %d failed\n", len(valid), len(failed))
-		fmt.Printf("Each resolver processed %d total queries\n", valid[0].Stats.Total)
+		if minQ, maxQ := queryRange(valid); minQ == maxQ {
+			fmt.Printf("Each resolver processed %d total queries\n", minQ)
+		} else {
+			fmt.Printf("Resolvers processed between %d and %d queries\n", minQ, maxQ)
+		}
+		printStopReasons(valid)
 	}
 }
 
-func retryWithBackoff[T any](
-	ctx context.Context,
-	f func(attempt int) (T, error),
-	maxRetries int,
-	initialBackoff time.Duration,
-	maxBackoff time.Duration,
-) (val T, err error) {
-	if maxRetries < 1 {
-		return val, errors.New("maxRetries must be positive")
+func queryRange(results []bench.BenchmarkResult) (lowest, highest int) {
+	lowest, highest = math.MaxInt, 0
+	for _, r := range results {
+		lowest = min(lowest, r.Stats.Total)
+		highest = max(highest, r.Stats.Total)
 	}
+	return lowest, highest
+}
 
-	backoff := min(initialBackoff, maxBackoff)
-
-	for attempt := range maxRetries {
-		if cErr := ctx.Err(); cErr != nil {
-			return val, cErr
-		}
-
-		val, err = f(attempt)
-		if err == nil {
-			return val, nil
-		}
-
-		if attempt == maxRetries-1 {
-			break
+// printStopReasons lists why adaptive sampling stopped for each resolver.
+func printStopReasons(results []bench.BenchmarkResult) {
+	counts := make(map[string][]string)
+	var order []string
+	for _, r := range results {
+		if r.Stopped == "" {
+			continue
 		}
-
-		//nolint:gosec // jitter timing here is non-security critical
-		jitter := time.Duration(rand.N(int(backoff)))
-		wait := backoff/2 + jitter
-
-		select {
-		case <-ctx.Done():
-			return val, ctx.Err()
-		case <-time.After(wait):
+		if _, ok := counts[r.Stopped]; !ok {
+			order = append(order, r.Stopped)
 		}
-
-		backoff = min(backoff*2, maxBackoff)
+		counts[r.Stopped] = append(counts[r.Stopped], fmt.Sprintf("%s (%d)", r.Server.Name, r.Stats.Total))
+	}
+	if len(order) == 0 {
+		return
+	}
+	fmt.Println("Adaptive sampling stop reasons (queries used):")
+	for _, reason := range order {
+		fmt.Printf("  %-9s %s\n", reason+":", strings.Join(counts[reason], ", "))
 	}
-
-	return val, err
 }
 
 func isValidDomain(domain string) bool {
@@ -190,33 +410,23 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen-3] + "..."
 }
 
-func gcAndWait() {
-	runtime.GC()
-	runtime.GC()
-	time.Sleep(50 * time.Millisecond)
-}
-
-func slogErr(err error) slog.Attr {
-	if err != nil {
-		return slog.String("err", err.Error())
-	}
-	return slog.String("err", "<nil>")
-}
-
-func printResultsJSON(valid, failed []BenchmarkResult) {
+func printResultsJSON(w io.Writer, valid, failed []bench.BenchmarkResult, comparisons []bench.Comparison, groups []bench.RankGroup, manifest *Manifest) {
 	type Summary struct {
-		TotalResolvers   int              `json:"total_resolvers"`
-		SuccessResolvers int              `json:"success_resolvers"`
-		FailedResolvers  int              `json:"failed_resolvers"`
-		OverallSuccess   float64          `json:"overall_success_rate"`
-		Fastest          *BenchmarkResult `json:"fastest_resolver,omitempty"`
-		Slowest          *BenchmarkResult `json:"slowest_resolver,omitempty"`
+		TotalResolvers   int                    `json:"total_resolvers"`
+		SuccessResolvers int                    `json:"success_resolvers"`
+		FailedResolvers  int                    `json:"failed_resolvers"`
+		OverallSuccess   float64                `json:"overall_success_rate"`
+		Fastest          *bench.BenchmarkResult `json:"fastest_resolver,omitempty"`
+		Slowest          *bench.BenchmarkResult `json:"slowest_resolver,omitempty"`
+		Partial          bool                   `json:"partial,omitempty"`
+		DualStack        *DualStack             `json:"dual_stack,omitempty"`
+		Pairs            *PairAnalysis          `json:"pairs,omitempty"`
 	}
 
-	all := append([]BenchmarkResult{}, valid...)
+	all := append([]bench.BenchmarkResult{}, valid...)
 	all = append(all, failed...)
 
-	var fastest, slowest *BenchmarkResult
+	var fastest, slowest *bench.BenchmarkResult
 	if len(valid) > 0 {
 		fastest = &valid[0]
 		slowest = &valid[len(valid)-1]
@@ -240,19 +450,31 @@ func printResultsJSON(valid, failed []BenchmarkResult) {
 		OverallSuccess:   overallSuccess * 100,
 		Fastest:          fastest,
 		Slowest:          slowest,
+		Partial:          manifest != nil && manifest.Partial,
+		DualStack:        dualStack(all),
+		Pairs:            resolverPairs(valid),
+	}
+
+	type Ranking struct {
+		Groups      []bench.RankGroup  `json:"groups"`
+		Comparisons []bench.Comparison `json:"comparisons"`
 	}
 
 	output := struct {
-		Summary  Summary           `json:"summary"`
-		Results  []BenchmarkResult `json:"results"`
-		Failures []BenchmarkResult `json:"failures"`
+		Summary  Summary                 `json:"summary"`
+		Ranking  Ranking                 `json:"ranking"`
+		Results  []bench.BenchmarkResult `json:"results"`
+		Failures []bench.BenchmarkResult `json:"failures"`
+		Manifest *Manifest               `json:"manifest,omitempty"`
 	}{
 		Summary:  summary,
+		Ranking:  Ranking{Groups: groups, Comparisons: comparisons},
 		Results:  valid,
 		Failures: failed,
+		Manifest: manifest,
 	}
 
-	enc := json.NewEncoder(os.Stdout)
+	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(output); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to encode json results: %v\n", err)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/handsomefox/dnsbench/bench"
+)
+
+// seq returns n values starting at start, increasing by 1.
+func seq(start float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = start + float64(i)
+	}
+	return out
+}
+
+// testResult returns a result of the resolver name, which is also its
+// address, with one sample per latency; NaN is a query that timed out after
+// a second.
+func testResult(name string, latencies ...float64) bench.BenchmarkResult {
+	samples := make([]bench.Sample, 0, len(latencies))
+	for _, l := range latencies {
+		if math.IsNaN(l) {
+			samples = append(samples, bench.Sample{Domain: "example.com", Total: 1000, Attempts: 1, Error: "timeout"})
+			continue
+		}
+		samples = append(samples, bench.Sample{Domain: "example.com", Latency: l, Total: l, Attempts: 1})
+	}
+	return bench.BenchmarkResult{
+		Server:  bench.DNSServer{Name: name, Addr: name},
+		Stats:   bench.SummarizeSamples(samples),
+		Samples: samples,
+	}
+}
+
+// withAddr returns r measured at addr instead of its name.
+func withAddr(r bench.BenchmarkResult, addr string) bench.BenchmarkResult {
+	r.Server.Addr = addr
+	return r
+}
+
+// deadResult returns a result of a resolver at addr that never answered.
+func deadResult(name, addr string) bench.BenchmarkResult {
+	return bench.BenchmarkResult{Server: bench.DNSServer{Name: name, Addr: addr}, Stats: bench.SummarizeSamples(nil), Failure: "unreachable"}
+}
+
+func TestPrintResultsTable_FailedAlignsIPv6(t *testing.T) {
+	var buf bytes.Buffer
+	printResultsTable(&buf, []bench.BenchmarkResult{
+		deadResult("v4", "192.0.2.1"),
+		deadResult("v6", "2001:db8:ffff:ffff:ffff:ffff:ffff:1"),
+	}, true)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("printResultsTable() printed %d lines, want 4:\n%s", len(lines), buf.String())
+	}
+	col := strings.Index(lines[1], "Errors")
+	for _, line := range lines[2:] {
+		if strings.Index(line, " 0 ") != col+len("Errors")-2 {
+			t.Errorf("printResultsTable() columns are misaligned:\n%s", buf.String())
+		}
+	}
+}
@@ -21,6 +21,9 @@ const fallbackOptions: RunOptions = {
   concurrency: 4,
   warmup: 0,
   onlyMajor: false,
+  retries: 0,
+  backoffMs: 2000,
+  maxBackoffMs: 60000,
 }
 
 function App() {
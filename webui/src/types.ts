@@ -1,20 +1,59 @@
 export type DNSServer = {
   name: string
   addr: string
+  transport?: 'udp' | 'tcp' | 'tls'
+  hostname?: string
+  provider?: string
 }
 
 export type Stats = {
   min: number
   max: number
   mean: number
+  median?: number
+  p95?: number
+  jitter?: number
   count: number
   errors: number
   total: number
+  attempts?: number
+  firstTry?: number
+  meanTotal?: number
+  meanCi?: Interval
+  medianCi?: Interval
+}
+
+export type Interval = {
+  low: number
+  high: number
 }
 
 export type BenchmarkResult = {
   server: DNSServer
   stats: Stats
+  score?: number
+  stopped?: string
+  failure?: string
+  cold?: Stats
+  rtt?: RTT
+}
+
+export type RTT = {
+  method: 'tcp' | 'icmp'
+  min: number | null
+  median: number | null
+  probes: number
+  lost: number
+  roundTrips: number
+  overhead: number | null
+  error?: string
+}
+
+export type ScoreWeights = {
+  successRate: number
+  median: number
+  p95: number
+  jitter: number
 }
 
 export type RunOptions = {
@@ -23,6 +62,23 @@ export type RunOptions = {
   concurrency: number
   warmup: number
   onlyMajor: boolean
+  retries: number
+  backoffMs: number
+  maxBackoffMs: number
+  preflightMs?: number
+  breaker?: number
+  maxQueries?: number
+  maxTimeMs?: number
+  runQueries?: number
+  runTimeMs?: number
+  qps?: number
+  adaptive?: boolean
+  targetCiMs?: number
+  rttProbes?: number
+  rttMethod?: 'tcp' | 'icmp'
+  ip?: 'auto' | '4' | '6' | 'both'
+  qtype?: string
+  weights?: ScoreWeights
 }
 
 export type DefaultsResponse = {
@@ -41,6 +97,7 @@ export type RunRequest = {
 export type SSEMessage = {
   runId?: string
   type: string
+  agent?: string
   detail?: Record<string, unknown>
 }
 
@@ -51,3 +108,121 @@ export type QueryLog = {
   error?: string
   ts: number
 }
+
+export type Progress = {
+  done: number
+  total: number
+  remainingMs: number
+  runRemainingMs: number
+}
+
+export type MonitorPoint = {
+  at: string
+  median: number | null
+  p95: number | null
+  successRate: number
+  failure?: string
+}
+
+export type MonitorResolver = {
+  server: DNSServer
+  latest: Stats
+  window: Stats
+  history: MonitorPoint[]
+}
+
+export type MonitorSnapshot = {
+  started: string
+  cycles: number
+  failedCycles: number
+  lastCycle?: string
+  nextCycle: string
+  lastError?: string
+  window: number
+  resolvers: MonitorResolver[]
+}
+
+export type HistorySummary = {
+  id: string
+  source: 'cli' | 'ui' | 'monitor'
+  started: string
+  finished: string
+  resolvers: number
+  domains: number
+  queries: number
+  failed: number
+  fastest?: string
+}
+
+export type HistoryRecord = {
+  id: string
+  source: 'cli' | 'ui' | 'monitor'
+  started: string
+  finished: string
+  options: RunOptions
+  resolvers: DNSServer[]
+  domains: string[]
+  results: BenchmarkResult[]
+  manifest?: Manifest
+}
+
+export type NetworkInfo = {
+  interface?: string
+  addr?: string
+  addr6?: string
+  gateway?: string
+  systemResolvers?: string[]
+  vpn?: boolean
+}
+
+export type Manifest = {
+  version: string
+  seed: number
+  started: string
+  finished: string
+  hostname: string
+  os: string
+  network: NetworkInfo
+  config: Record<string, unknown>
+  partial?: boolean
+  skipped?: DNSServer[]
+}
+
+export type AgentJob = {
+  id: string
+  created: string
+  request: RunRequest
+  agents?: string[]
+}
+
+export type VantageCell = {
+  median: number | null
+  p95: number | null
+  successRate: number
+  rank?: number
+  failure?: string
+}
+
+export type VantageRow = {
+  server: DNSServer
+  cells: (VantageCell | null)[]
+  best?: string
+  spread: number
+}
+
+export type VantageMatrix = {
+  vantages: string[]
+  resolvers: VantageRow[]
+}
+
+export type AgentJobStatus = AgentJob & {
+  status: Record<string, 'running' | 'done' | 'failed'>
+  matrix: VantageMatrix
+}
+
+export type AgentInfo = {
+  name: string
+  addr: string
+  lastSeen: string
+  job?: string
+}